@@ -0,0 +1,73 @@
+package twilter
+
+import (
+	"context"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"net/http"
+)
+
+// Retweeter retweets tweets by Twitter API.
+// errors are *ClassifiedError except errors of ctx which are returned as they are.
+type Retweeter interface {
+	Retweet(ctx context.Context, tweetID int64) error
+	Unretweet(ctx context.Context, tweetID int64) error
+}
+
+// classifyError returns the error classified by Classify. nil if the request succeeded.
+func classifyError(resp *http.Response, err error) error {
+	if cerr := Classify(resp, err); cerr != nil {
+		return cerr
+	}
+	return nil
+}
+
+// retweeter retweets by statuses/retweet API of v1.1.
+type retweeter struct {
+	client *twitter.Client
+}
+
+// NewRetweeter creates Retweeter of Twitter API v1.1.
+func NewRetweeter(client *twitter.Client) Retweeter {
+	return &retweeter{client: client}
+}
+
+// Retweet retweets the tweet.
+func (r *retweeter) Retweet(ctx context.Context, tweetID int64) error {
+	var resp *http.Response
+	err := DefaultRetryPolicy.Do(ctx, func() (_ *http.Response, err error) {
+		_, resp, err = r.client.Statuses.Retweet(tweetID, &twitter.StatusRetweetParams{
+			TrimUser: &trueValue,
+		})
+		return resp, err
+	})
+	if err != nil && err == ctx.Err() {
+		return err
+	}
+
+	// twitter.APIError is not reliable when error response body format from twitter is not valid.
+	if err == nil && resp.StatusCode >= 300 {
+		err = fmt.Errorf("request to retweet : %v", resp.Status)
+	}
+	return classifyError(resp, err)
+}
+
+// Unretweet unretweets the tweet. even if the tweet is not retweeted, no error occurs.
+func (r *retweeter) Unretweet(ctx context.Context, tweetID int64) error {
+	var resp *http.Response
+	err := DefaultRetryPolicy.Do(ctx, func() (_ *http.Response, err error) {
+		_, resp, err = r.client.Statuses.Unretweet(tweetID, &twitter.StatusUnretweetParams{
+			TrimUser: &trueValue,
+		})
+		return resp, err
+	})
+	if err != nil && err == ctx.Err() {
+		return err
+	}
+
+	// twitter.APIError is not reliable when error response body format from twitter is not valid.
+	if err == nil && resp.StatusCode >= 300 {
+		err = fmt.Errorf("request to unretweet : %v", resp.Status)
+	}
+	return classifyError(resp, err)
+}
@@ -0,0 +1,302 @@
+package twilter
+
+import (
+	"context"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultUserCacheTTL = time.Hour
+	// users/lookup API accepts 100 users at the most
+	lookupSize = 100
+)
+
+// UserCache caches users loaded by users/lookup API for ttl.
+// users are loaded with the twitter.Client in context (see WithClient) only when they are requested.
+// expired users are evicted once every ttl when users are loaded, so users not requested any more do not stay.
+type UserCache struct {
+	ttl   time.Duration
+	mu    sync.Mutex
+	users map[int64]cachedUser
+	// evicted is the time when expired users are evicted last.
+	evicted time.Time
+}
+
+// cachedUser is cached user. user is nil when the user is not found (suspended or deleted).
+type cachedUser struct {
+	user   *twitter.User
+	expire time.Time
+}
+
+// NewUserCache returns UserCache. ttl is 1 hour if 0.
+func NewUserCache(ttl time.Duration) *UserCache {
+	if ttl == 0 {
+		ttl = defaultUserCacheTTL
+	}
+	return &UserCache{
+		ttl:   ttl,
+		users: make(map[int64]cachedUser),
+	}
+}
+
+// Get returns the user. nil when the user is not found.
+func (c *UserCache) Get(ctx context.Context, userId int64) (*twitter.User, error) {
+	users, err := c.Lookup(ctx, []int64{userId})
+	if err != nil {
+		return nil, err
+	}
+	return users[userId], nil
+}
+
+// Lookup returns users of userIds. users which are not cached or expired are loaded by batched users/lookup API.
+// users not found are not included in the result.
+func (c *UserCache) Lookup(ctx context.Context, userIds []int64) (map[int64]*twitter.User, error) {
+	users := make(map[int64]*twitter.User, len(userIds))
+	var missing []int64
+	seen := make(map[int64]bool, len(userIds))
+
+	now := time.Now()
+	c.mu.Lock()
+	for _, id := range userIds {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if cached, ok := c.users[id]; ok && now.Before(cached.expire) {
+			if cached.user != nil {
+				users[id] = cached.user
+			}
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	c.mu.Unlock()
+
+	for len(missing) > 0 {
+		ids := missing
+		if len(ids) > lookupSize {
+			ids = ids[:lookupSize]
+		}
+		missing = missing[len(ids):]
+
+		loaded, err := c.load(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for id, u := range loaded {
+			users[id] = u
+		}
+	}
+	return users, nil
+}
+
+// load loads users by users/lookup API and caches them.
+func (c *UserCache) load(ctx context.Context, userIds []int64) (map[int64]*twitter.User, error) {
+	client := ClientFromContext(ctx)
+	if client == nil {
+		return nil, fmt.Errorf("no twitter client in context")
+	}
+
+	// https://developer.twitter.com/en/docs/accounts-and-users/follow-search-get-users/api-reference/get-users-lookup
+	falseValue := false
+	var (
+		users []twitter.User
+		resp  *http.Response
+	)
+	err := DefaultRetryPolicy.Do(ctx, func() (r *http.Response, err error) {
+		users, resp, err = client.Users.Lookup(&twitter.UserLookupParams{
+			UserID:          userIds,
+			IncludeEntities: &falseValue,
+		})
+		return resp, err
+	})
+
+	// users/lookup returns 404 when none of users are found.
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		err, users = nil, nil
+	} else if err == nil && resp.StatusCode >= 300 {
+		// twitter.APIError is not reliable when error response body format from twitter is not valid.
+		err = fmt.Errorf("request to lookup users : %v", resp.Status)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := make(map[int64]*twitter.User, len(users))
+	now := time.Now()
+	expire := now.Add(c.ttl)
+	c.mu.Lock()
+	if now.Sub(c.evicted) >= c.ttl {
+		for id, cached := range c.users {
+			if !now.Before(cached.expire) {
+				delete(c.users, id)
+			}
+		}
+		c.evicted = now
+	}
+	// cache not found users too not to request them again and again.
+	for _, id := range userIds {
+		c.users[id] = cachedUser{expire: expire}
+	}
+	for i := range users {
+		u := &users[i]
+		c.users[u.ID] = cachedUser{user: u, expire: expire}
+		loaded[u.ID] = u
+	}
+	c.mu.Unlock()
+	return loaded, nil
+}
+
+// AuthorFilter filters tweets by attributes of the author.
+// the author of retweet is the author of the original tweet.
+// AuthorFilter is ContextFilter which loads authors by UserCache.
+type AuthorFilter struct {
+	cache      *UserCache
+	conditions []authorCondition
+}
+
+// authorCondition is a condition for an attribute of author.
+type authorCondition struct {
+	src   string
+	match func(u *twitter.User) bool
+}
+
+// authorBoolAttrs is bool attributes of author.
+var authorBoolAttrs = map[string]func(u *twitter.User) bool{
+	"verified":  func(u *twitter.User) bool { return u.Verified },
+	"protected": func(u *twitter.User) bool { return u.Protected },
+}
+
+// authorIntAttrs is int attributes of author.
+var authorIntAttrs = map[string]func(u *twitter.User) int{
+	"followers":  func(u *twitter.User) int { return u.FollowersCount },
+	"friends":    func(u *twitter.User) int { return u.FriendsCount },
+	"statuses":   func(u *twitter.User) int { return u.StatusesCount },
+	"listed":     func(u *twitter.User) int { return u.ListedCount },
+	"favourites": func(u *twitter.User) int { return u.FavouritesCount },
+}
+
+// NewAuthorFilter returns AuthorFilter which matches when all conditions are true.
+// condition format is "<bool attribute>[=true|false]" or "<int attribute><op><number>" (op : >=, <=, >, <, =, !=).
+// bool attributes : verified, protected. int attributes : followers, friends, statuses, listed, favourites.
+func NewAuthorFilter(cache *UserCache, conditions ...string) (*AuthorFilter, error) {
+	if len(conditions) == 0 {
+		return nil, fmt.Errorf("author : no condition")
+	}
+	f := &AuthorFilter{cache: cache}
+	for _, src := range conditions {
+		cond, err := parseAuthorCondition(src)
+		if err != nil {
+			return nil, err
+		}
+		f.conditions = append(f.conditions, cond)
+	}
+	return f, nil
+}
+
+func parseAuthorCondition(src string) (authorCondition, error) {
+	// bool attributes
+	name, value := src, "true"
+	if idx := strings.Index(src, "="); idx >= 0 {
+		name, value = src[:idx], src[idx+1:]
+	}
+	if attr, ok := authorBoolAttrs[name]; ok {
+		expected, err := strconv.ParseBool(value)
+		if err != nil {
+			return authorCondition{}, fmt.Errorf("author : %q is not bool", value)
+		}
+		return authorCondition{src: src, match: func(u *twitter.User) bool { return attr(u) == expected }}, nil
+	}
+
+	// int attributes. longer operators first.
+	for _, op := range []string{">=", "<=", "!=", ">", "<", "="} {
+		idx := strings.Index(src, op)
+		if idx < 0 {
+			continue
+		}
+		attr, ok := authorIntAttrs[src[:idx]]
+		if !ok {
+			break
+		}
+		n, err := strconv.Atoi(src[idx+len(op):])
+		if err != nil {
+			return authorCondition{}, fmt.Errorf("author : %q is not number", src[idx+len(op):])
+		}
+		var match func(u *twitter.User) bool
+		switch op {
+		case ">=":
+			match = func(u *twitter.User) bool { return attr(u) >= n }
+		case "<=":
+			match = func(u *twitter.User) bool { return attr(u) <= n }
+		case "!=":
+			match = func(u *twitter.User) bool { return attr(u) != n }
+		case ">":
+			match = func(u *twitter.User) bool { return attr(u) > n }
+		case "<":
+			match = func(u *twitter.User) bool { return attr(u) < n }
+		default:
+			match = func(u *twitter.User) bool { return attr(u) == n }
+		}
+		return authorCondition{src: src, match: match}, nil
+	}
+	return authorCondition{}, fmt.Errorf("author : condition %q is invalid", src)
+}
+
+// authorId returns id of the author. the author of retweet is the author of the original tweet.
+func authorId(tweet *twitter.Tweet) int64 {
+	if tweet.RetweetedStatus != nil {
+		tweet = tweet.RetweetedStatus
+	}
+	if tweet.User == nil {
+		return 0
+	}
+	return tweet.User.ID
+}
+
+// Prepare loads all authors in tweets at once.
+func (f *AuthorFilter) Prepare(ctx context.Context, tweets []twitter.Tweet) error {
+	ids := make([]int64, 0, len(tweets))
+	for i := range tweets {
+		if id := authorId(&tweets[i]); id != 0 {
+			ids = append(ids, id)
+		}
+	}
+	if _, err := f.cache.Lookup(ctx, ids); err != nil && ctx.Err() == nil {
+		// Match will retry to load the author and report the error for each tweet.
+		return nil
+	}
+	return ctx.Err()
+}
+
+// Match checks all conditions. not found author does not match.
+func (f *AuthorFilter) Match(ctx context.Context, tweet *twitter.Tweet) (bool, error) {
+	id := authorId(tweet)
+	if id == 0 {
+		return false, nil
+	}
+	user, err := f.cache.Get(ctx, id)
+	if err != nil || user == nil {
+		return false, err
+	}
+	for _, cond := range f.conditions {
+		if !cond.match(user) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// String returns author
+func (f *AuthorFilter) String() string {
+	ss := make([]string, len(f.conditions))
+	for i, cond := range f.conditions {
+		ss[i] = cond.src
+	}
+	return fmt.Sprintf("author(%v)", strings.Join(ss, ","))
+}
@@ -0,0 +1,38 @@
+package twilter
+
+import (
+	"context"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/kawasin73/twilter/twittertest"
+	"testing"
+	"time"
+)
+
+func TestUserCacheEviction(t *testing.T) {
+	server := twittertest.NewServer()
+	defer server.Close()
+	server.AddUser(twitter.User{ID: 10, ScreenName: "alice"})
+	server.AddUser(twitter.User{ID: 20, ScreenName: "bob"})
+	ctx := WithClient(context.Background(), twitter.NewClient(server.Client()))
+
+	cache := NewUserCache(10 * time.Millisecond)
+	if user, err := cache.Get(ctx, 10); err != nil || user == nil || user.ScreenName != "alice" {
+		t.Fatalf("Get() = %v, %v", user, err)
+	}
+	// not found users are cached too.
+	if user, err := cache.Get(ctx, 30); err != nil || user != nil {
+		t.Fatalf("Get() = %v, %v", user, err)
+	}
+	if len(cache.users) != 2 {
+		t.Errorf("users = %v", cache.users)
+	}
+
+	// expired users are evicted when other users are loaded.
+	time.Sleep(20 * time.Millisecond)
+	if user, err := cache.Get(ctx, 20); err != nil || user == nil || user.ScreenName != "bob" {
+		t.Fatalf("Get() = %v, %v", user, err)
+	}
+	if _, ok := cache.users[20]; !ok || len(cache.users) != 1 {
+		t.Errorf("users = %v", cache.users)
+	}
+}
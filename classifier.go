@@ -0,0 +1,182 @@
+package twilter
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// classes of Classifier. Docs, Tokens and Words of Classifier are indexed by them.
+const (
+	Negative = 0
+	Positive = 1
+)
+
+// Classifier is multinomial Naive Bayes model which classifies text into positive or negative.
+// Classifier is saved as a plain JSON file.
+type Classifier struct {
+	// Docs is the number of trained documents of negative and positive.
+	Docs [2]int `json:"docs"`
+	// Tokens is the total number of tokens of negative and positive.
+	Tokens [2]int `json:"tokens"`
+	// Words is the number of each token in negative and positive.
+	Words map[string]*[2]int `json:"words"`
+}
+
+// NewClassifier returns empty Classifier.
+func NewClassifier() *Classifier {
+	return &Classifier{Words: make(map[string]*[2]int)}
+}
+
+// LoadClassifier reads Classifier saved by Classifier.Save.
+func LoadClassifier(r io.Reader) (*Classifier, error) {
+	c := NewClassifier()
+	if err := json.NewDecoder(r).Decode(c); err != nil {
+		return nil, err
+	}
+	if c.Docs[Negative] == 0 || c.Docs[Positive] == 0 {
+		return nil, fmt.Errorf("model must be trained with both positive and negative examples")
+	}
+	return c, nil
+}
+
+// Save writes Classifier as JSON.
+func (c *Classifier) Save(w io.Writer) error {
+	return json.NewEncoder(w).Encode(c)
+}
+
+// Add trains Classifier with the text.
+func (c *Classifier) Add(text string, isPositive bool) {
+	class := Negative
+	if isPositive {
+		class = Positive
+	}
+	c.Docs[class]++
+	for _, token := range Tokenize(text) {
+		counts, ok := c.Words[token]
+		if !ok {
+			counts = new([2]int)
+			c.Words[token] = counts
+		}
+		counts[class]++
+		c.Tokens[class]++
+	}
+}
+
+// AddTweet trains Classifier with the text of the tweet which ClassifierFilter classifies.
+func (c *Classifier) AddTweet(tweet *twitter.Tweet, isPositive bool) {
+	c.Add(originalText(tweet), isPositive)
+}
+
+// Probability returns the probability that the text is positive.
+// unknown tokens are ignored and counts are smoothed by Laplace smoothing.
+func (c *Classifier) Probability(text string) float64 {
+	vocabulary := float64(len(c.Words))
+	total := float64(c.Docs[Negative] + c.Docs[Positive])
+
+	// calculate in log space not to underflow
+	var scores [2]float64
+	for class := range scores {
+		scores[class] = math.Log(float64(c.Docs[class]) / total)
+	}
+	for _, token := range Tokenize(text) {
+		counts, ok := c.Words[token]
+		if !ok {
+			continue
+		}
+		for class := range scores {
+			scores[class] += math.Log((float64(counts[class]) + 1) / (float64(c.Tokens[class]) + vocabulary))
+		}
+	}
+
+	// P(positive) = 1 / (1 + exp(negative - positive))
+	return 1 / (1 + math.Exp(scores[Negative]-scores[Positive]))
+}
+
+// Tokenize splits text into tokens for Classifier.
+// words of alphabets and numbers are lower cased. URLs are removed.
+// CJK texts which have no spaces between words are split into character bigrams.
+func Tokenize(text string) []string {
+	var tokens []string
+	for _, field := range strings.Fields(text) {
+		if strings.HasPrefix(field, "http://") || strings.HasPrefix(field, "https://") {
+			continue
+		}
+
+		var word, cjk []rune
+		flush := func() {
+			if len(word) > 0 {
+				tokens = append(tokens, strings.ToLower(string(word)))
+				word = word[:0]
+			}
+			if len(cjk) == 1 {
+				tokens = append(tokens, string(cjk))
+			}
+			for i := 0; i+1 < len(cjk); i++ {
+				tokens = append(tokens, string(cjk[i:i+2]))
+			}
+			cjk = cjk[:0]
+		}
+		for _, r := range field {
+			switch {
+			case isCJK(r):
+				if len(word) > 0 {
+					flush()
+				}
+				cjk = append(cjk, r)
+			case unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_' || r == '#' && len(word) == 0:
+				if len(cjk) > 0 {
+					flush()
+				}
+				word = append(word, r)
+			default:
+				// punctuations and symbols split tokens
+				flush()
+			}
+		}
+		flush()
+	}
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// ClassifierFilter filters tweets which Classifier judges positive.
+type ClassifierFilter struct {
+	path      string
+	model     *Classifier
+	threshold float64
+}
+
+// NewClassifierFilter loads the model file and returns ClassifierFilter.
+// tweets match when the probability of positive is threshold or more.
+func NewClassifierFilter(path string, threshold float64) (*ClassifierFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	model, err := LoadClassifier(file)
+	if err != nil {
+		return nil, fmt.Errorf("load model %v : %v", path, err)
+	}
+	return &ClassifierFilter{path: path, model: model, threshold: threshold}, nil
+}
+
+// Match ...
+func (f *ClassifierFilter) Match(tweet *twitter.Tweet) bool {
+	return f.model.Probability(originalText(tweet)) >= f.threshold
+}
+
+// String returns classifier
+func (f *ClassifierFilter) String() string {
+	// the path is quoted because it may contain "," or ")".
+	return fmt.Sprintf("classifier(%q,%v)", f.path, f.threshold)
+}
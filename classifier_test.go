@@ -0,0 +1,73 @@
+package twilter
+
+import (
+	"bytes"
+	"github.com/dghubble/go-twitter/twitter"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	for _, test := range []struct {
+		input  string
+		output []string
+	}{
+		{"Hello, World! #Art https://t.co/xxx", []string{"hello", "world", "#art"}},
+		{"イラスト描いた", []string{"イラ", "ラス", "スト", "ト描", "描い", "いた"}},
+		{"新作art2枚", []string{"新作", "art2", "枚"}},
+		{"", nil},
+	} {
+		if tokens := Tokenize(test.input); !reflect.DeepEqual(tokens, test.output) {
+			t.Errorf("Tokenize(%q) = %q, expected %q", test.input, tokens, test.output)
+		}
+	}
+}
+
+func TestClassifier(t *testing.T) {
+	c := NewClassifier()
+	c.Add("new illustration #art", true)
+	c.Add("drawing a sketch of a cat #art", true)
+	c.Add("イラスト描きました", true)
+	c.Add("had ramen for lunch", false)
+	c.Add("train is late again", false)
+	c.Add("今日のお昼ごはん", false)
+
+	// save and load model
+	var buf bytes.Buffer
+	if err := c.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	model, err := LoadClassifier(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		text     string
+		positive bool
+	}{
+		{"sketch of my cat", true},
+		{"新しいイラスト", true},
+		{"lunch was ramen", false},
+		{"お昼はラーメン", false},
+	} {
+		if p := model.Probability(test.text); (p >= 0.5) != test.positive {
+			t.Errorf("Probability(%q) = %v, expected positive %v", test.text, p, test.positive)
+		}
+	}
+}
+
+func TestClassifierAddTweet(t *testing.T) {
+	c := NewClassifier()
+	// the retweet and the original tweet of streaming API have truncated text.
+	c.AddTweet(&twitter.Tweet{
+		Text: "RT @alice: new illus…",
+		RetweetedStatus: &twitter.Tweet{
+			Text:          "new illus…",
+			ExtendedTweet: &twitter.ExtendedTweet{FullText: "new illustration #art"},
+		},
+	}, true)
+	if c.Docs[Positive] != 1 || c.Docs[Negative] != 0 || c.Words["#art"] == nil || c.Words["rt"] != nil {
+		t.Errorf("docs = %v, words = %v", c.Docs, c.Words)
+	}
+}
@@ -5,7 +5,7 @@ go 1.12
 require (
 	github.com/dghubble/go-twitter v0.0.0-20190512073027-53f972dc4b06
 	github.com/dghubble/oauth1 v0.5.0
-	github.com/go-redis/redis v6.15.2+incompatible // indirect
+	github.com/go-redis/redis v6.15.2+incompatible
 	github.com/kawasin73/htask v0.4.1
 	github.com/kawasin73/twilter v0.1.0
 )
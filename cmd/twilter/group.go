@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/dghubble/oauth1"
+	"github.com/go-redis/redis"
+	"github.com/kawasin73/htask"
+	"github.com/kawasin73/twilter"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// taskGroup is a set of tasks of users which changes dynamically (e.g. members of a List, users followed by an account).
+// users are listed again every sync interval. tasks of new users start from now and tasks of removed users are stopped.
+type taskGroup struct {
+	name      string
+	interval  time.Duration
+	listUsers func(ctx context.Context) ([]int64, error)
+	// newTask creates Task of the user which loads tweets posted after since. since is zero on the first sync.
+	newTask func(userId int64, since time.Time) (*Task, error)
+	// tasks is cancel functions of running tasks by user id
+	tasks map[int64]context.CancelFunc
+}
+
+// setupMembersGroup creates taskGroup which monitors each member of the list of members target.
+func setupMembersGroup(ctx context.Context, config *oauth1.Config, token *oauth1.Token, selfId int64, redisClient *redis.Client, t *target, interval, timeout, fallback time.Duration) (*taskGroup, error) {
+	// convert owner/slug to listId not to lose checkpoints when the list is renamed.
+	client := twitter.NewClient(oauthClient(ctx, config, token))
+	idx := strings.Index(t.name, "/")
+	list, err := resolveList(ctx, client, redisClient, t.name[:idx], t.name[idx+1:])
+	if err != nil {
+		return nil, fmt.Errorf("resolve %v : convert list to listId : %v", t.key(), err)
+	}
+	prefix := kindMembers + ":" + strconv.FormatInt(list.ID, 10) + ":"
+
+	return &taskGroup{
+		name:     t.key(),
+		interval: interval,
+		listUsers: func(ctx context.Context) ([]int64, error) {
+			return listMembers(ctx, client, list.ID)
+		},
+		newTask: userTaskFactory(config, token, selfId, redisClient, prefix, t.filters, interval, timeout, t.loaderOption(fallback)),
+		tasks:   make(map[int64]context.CancelFunc),
+	}, nil
+}
+
+// setupFollowingGroup creates taskGroup which monitors each user followed by the account of following target.
+// the account is the dummy account if the target has no name.
+func setupFollowingGroup(ctx context.Context, config *oauth1.Config, token *oauth1.Token, selfId int64, redisClient *redis.Client, t *target, interval, timeout, fallback time.Duration) (*taskGroup, error) {
+	client := twitter.NewClient(oauthClient(ctx, config, token))
+	userId := selfId
+	if t.name != "" {
+		user, err := resolveUser(ctx, client, redisClient, t.name)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %v : convert screenName to userId : %v", t.key(), err)
+		}
+		userId = user.ID
+	}
+	prefix := kindFollow + ":" + strconv.FormatInt(userId, 10) + ":"
+
+	return &taskGroup{
+		name:     t.key(),
+		interval: interval,
+		listUsers: func(ctx context.Context) ([]int64, error) {
+			return friendIds(ctx, client, userId)
+		},
+		newTask: userTaskFactory(config, token, selfId, redisClient, prefix, t.filters, interval, timeout, t.loaderOption(fallback)),
+		tasks:   make(map[int64]context.CancelFunc),
+	}, nil
+}
+
+// userTaskFactory returns function which creates Task of user timeline. checkpoints are stored with the key prefix.
+// the time a user is added is stored with the key too, so the task loads tweets posted after it after restart.
+func userTaskFactory(config *oauth1.Config, token *oauth1.Token, selfId int64, redisClient *redis.Client, prefix string, filters []twilter.Filter, interval, timeout time.Duration, option *twilter.LoaderOption) func(userId int64, since time.Time) (*Task, error) {
+	return func(userId int64, since time.Time) (*Task, error) {
+		source := backendSource(&twilter.UserTimelineSource{UserID: userId}, oauthClient(context.Background(), config, token))
+		key := prefix + strconv.FormatInt(userId, 10)
+		if redisClient != nil {
+			if since.IsZero() {
+				ms, err := redisClient.Get(key + ":since").Int64()
+				if err != nil && err != redis.Nil {
+					return nil, err
+				} else if err == nil {
+					since = time.Unix(0, ms*int64(time.Millisecond))
+				}
+			} else if err := redisClient.Set(key+":since", since.UnixNano()/int64(time.Millisecond), 0).Err(); err != nil {
+				return nil, err
+			}
+		}
+		// each loader has its own copy of option.
+		taskOption := *option
+		if since.After(taskOption.Since) {
+			taskOption.Since = since
+		}
+		return setupSourceTask(config, token, selfId, redisClient, source, key, filters, interval, timeout, &taskOption)
+	}
+}
+
+// Run syncs users every syncInterval until ctx is done.
+func (g *taskGroup) Run(ctx context.Context, sche *htask.Scheduler, syncInterval time.Duration) {
+	g.sync(ctx, sche, true)
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			g.sync(ctx, sche, false)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sync starts tasks of new users and stops tasks of removed users.
+// on the first sync, tasks start from their checkpoints or fallback like other targets.
+func (g *taskGroup) sync(ctx context.Context, sche *htask.Scheduler, first bool) {
+	userIds, err := g.listUsers(ctx)
+	if err != nil {
+		// keep current tasks and retry next time
+		log.Printf("failed to sync %v : %v\n", g.name, err)
+		return
+	}
+
+	// stop tasks of removed users
+	current := make(map[int64]bool, len(userIds))
+	for _, id := range userIds {
+		current[id] = true
+	}
+	removed := 0
+	for id, cancel := range g.tasks {
+		if !current[id] {
+			cancel()
+			delete(g.tasks, id)
+			removed++
+		}
+	}
+
+	// start tasks of new users
+	var added []int64
+	for _, id := range userIds {
+		if _, ok := g.tasks[id]; !ok {
+			added = append(added, id)
+		}
+	}
+	now := time.Now()
+	started := 0
+	for i, id := range added {
+		var since time.Time
+		if !first {
+			// start from now not to retweet old tweets of the new user even if re-added and the old checkpoint is stored.
+			// the time is not a checkpoint of a real tweet, so no gap is reported until the first tweet.
+			since = now
+		}
+		task, err := g.newTask(id, since)
+		if err != nil {
+			log.Printf("failed to create task of user (%d) in %v : %v\n", id, g.name, err)
+			continue
+		}
+
+		// spread the first execution over the interval not to request all at once.
+		tctx, cancel := context.WithCancel(ctx)
+		at := now.Add(g.interval * time.Duration(i+1) / time.Duration(len(added)+1))
+		if err = task.StartAt(tctx, sche, at); err != nil {
+			cancel()
+			log.Printf("failed to start task of user (%d) in %v : %v\n", id, g.name, err)
+			continue
+		}
+		g.tasks[id] = cancel
+		started++
+	}
+
+	log.Printf("synced %v : %d users (+%d, -%d)\n", g.name, len(g.tasks), started, removed)
+}
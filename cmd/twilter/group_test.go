@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"github.com/kawasin73/htask"
+	"github.com/kawasin73/twilter"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTaskGroupSync(t *testing.T) {
+	var wg sync.WaitGroup
+	sche := htask.NewScheduler(&wg, 0)
+	defer wg.Wait()
+	defer sche.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	users := []int64{1, 2}
+	created := make(map[int64]*Task)
+	since := make(map[int64]time.Time)
+	g := &taskGroup{
+		name:     "members:test",
+		interval: time.Hour,
+		listUsers: func(ctx context.Context) ([]int64, error) {
+			return users, nil
+		},
+		newTask: func(userId int64, s time.Time) (*Task, error) {
+			since[userId] = s
+			task, err := setupSourceTask(nil, nil, 0, nil, &twilter.UserTimelineSource{UserID: userId}, "test", nil, time.Hour, time.Minute, &twilter.LoaderOption{Fallback: time.Hour})
+			created[userId] = task
+			return task, err
+		},
+		tasks: make(map[int64]context.CancelFunc),
+	}
+
+	g.sync(ctx, sche, true)
+	if len(g.tasks) != 2 || !since[1].IsZero() || !since[2].IsZero() {
+		t.Fatalf("first sync : tasks = %v", g.tasks)
+	}
+
+	// user 1 is removed and user 3 is added
+	users = []int64{2, 3}
+	before := time.Now()
+	g.sync(ctx, sche, false)
+	if _, ok := g.tasks[1]; ok {
+		t.Error("task of removed user is not stopped")
+	}
+	if _, ok := g.tasks[2]; !ok || len(g.tasks) != 2 {
+		t.Errorf("second sync : tasks = %v", g.tasks)
+	}
+	// the new user starts from now without a checkpoint not to report gaps.
+	if since[3].Before(before) || created[3].idStore.get() != 0 {
+		t.Errorf("new user starts from %v (checkpoint %v), want now (%v)", since[3], created[3].idStore.get(), before)
+	}
+}
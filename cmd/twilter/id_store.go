@@ -2,7 +2,6 @@ package main
 
 import (
 	"github.com/go-redis/redis"
-	"strconv"
 )
 
 type idStore struct {
@@ -11,8 +10,9 @@ type idStore struct {
 	latestId int64
 }
 
-func createIdStore(client *redis.Client, targetId int64) (*idStore, error) {
-	targetIdStr := strconv.FormatInt(targetId, 10)
+// createIdStore loads latest id of the key. key is user id for user timeline.
+func createIdStore(client *redis.Client, key string) (*idStore, error) {
+	targetIdStr := key
 	var latestId int64
 	if client != nil {
 		// get latest id from redis store
@@ -41,3 +41,23 @@ func (l *idStore) update(latestId int64) error {
 func (l *idStore) get() int64 {
 	return l.latestId
 }
+
+// feedIdStore keeps ids of feed entries without date in the Redis hash of the key.
+type feedIdStore struct {
+	client *redis.Client
+	key    string
+}
+
+func (s *feedIdStore) Get(guid string) (int64, bool, error) {
+	id, err := s.client.HGet(s.key, guid).Int64()
+	if err == redis.Nil {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	return id, true, nil
+}
+
+func (s *feedIdStore) Set(guid string, id int64) error {
+	return s.client.HSet(s.key, guid, id).Err()
+}
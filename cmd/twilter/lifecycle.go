@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/kawasin73/twilter"
+	"log"
+	"strings"
+	"time"
+)
+
+// targetState is the lifecycle state of a target.
+type targetState int
+
+const (
+	// stateUnresolved is the target whose name is not resolved to id yet.
+	stateUnresolved targetState = iota
+	// stateActive is the target which is monitored.
+	stateActive
+	// stateProtected is the protected user who is not followed by the dummy account.
+	stateProtected
+	// stateSuspended is the suspended user.
+	stateSuspended
+	// stateDeleted is the deleted user or list.
+	stateDeleted
+)
+
+var targetStateNames = []string{"unresolved", "active", "protected", "suspended", "deleted"}
+
+// String returns the name of the state.
+func (s targetState) String() string {
+	return targetStateNames[s]
+}
+
+// stateOf returns the state of the target which failed with err. ok is false if err is not about the target.
+func stateOf(err error) (state targetState, ok bool) {
+	cerr := twilter.Classify(nil, err)
+	if cerr == nil {
+		return stateActive, true
+	}
+	switch cerr.Class {
+	case twilter.TargetProtected:
+		return stateProtected, true
+	case twilter.TargetSuspended:
+		return stateSuspended, true
+	case twilter.TargetNotFound:
+		return stateDeleted, true
+	}
+	return 0, false
+}
+
+// resolveInterval is the interval between retries to resolve targets which failed to be resolved.
+var resolveInterval = 30 * time.Minute
+
+// refreshInterval is the interval between re-reading users of targets given by screen name.
+var refreshInterval = time.Hour
+
+// retryResolve calls resolve every resolveInterval until it succeeds or ctx is done.
+// the target stays unresolved meanwhile and other targets keep running.
+func retryResolve(ctx context.Context, name string, resolve func() error) {
+	ticker := time.NewTicker(resolveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if err := resolve(); err != nil {
+			log.Printf("%v : %v : failed to resolve : %v\n", name, stateUnresolved, err)
+			continue
+		}
+		log.Printf("%v : resolved\n", name)
+		return
+	}
+}
+
+// setState changes the state of the task and logs the transition.
+func (t *Task) setState(state targetState) {
+	if t.state != state {
+		log.Printf("%v : %v -> %v\n", t.loader.Source(), t.state, state)
+		t.state = state
+	}
+}
+
+// refresh re-reads the user of the target by id to follow the change of screen name and to know the state of the account.
+// returns false if the target should not be loaded now. the task is paused then.
+func (t *Task) refresh(ctx context.Context, client *twitter.Client) bool {
+	user, err := showUserByID(ctx, client, t.userId)
+	if err != nil {
+		if state, ok := stateOf(err); ok {
+			t.setState(state)
+		}
+		if t.handleError(err) != actionRetry {
+			return false
+		}
+		// load the timeline anyway
+		return true
+	}
+	t.refreshedAt = time.Now()
+
+	if !strings.EqualFold(user.ScreenName, t.screenName) {
+		log.Printf("%v : @%v is renamed to @%v\n", t.loader.Source(), t.screenName, user.ScreenName)
+		t.screenName = user.ScreenName
+	}
+	if user.Protected && !user.Following && user.ID != t.selfId {
+		t.setState(stateProtected)
+		t.pausedUntil = time.Now().Add(pauseDuration)
+		log.Printf("%v : @%v is protected and not followed. pause until %v\n", t.loader.Source(), user.ScreenName, t.pausedUntil.Format(time.RFC3339))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/kawasin73/twilter"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc responds requests without network.
+type roundTripFunc func(req *http.Request) *http.Response
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req), nil
+}
+
+func jsonResponse(code int, body string) *http.Response {
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	return &http.Response{StatusCode: code, Status: http.StatusText(code), Header: header, Body: ioutil.NopCloser(strings.NewReader(body))}
+}
+
+func TestTaskRefresh(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		resp       *http.Response
+		ok         bool
+		state      targetState
+		screenName string
+	}{
+		{"renamed", jsonResponse(200, `{"id":1,"screen_name":"new_name"}`), true, stateActive, "new_name"},
+		{"protected", jsonResponse(200, `{"id":1,"screen_name":"old_name","protected":true,"following":false}`), false, stateProtected, "old_name"},
+		{"followed protected", jsonResponse(200, `{"id":1,"screen_name":"old_name","protected":true,"following":true}`), true, stateActive, "old_name"},
+		{"suspended", jsonResponse(403, `{"errors":[{"code":63,"message":"User has been suspended."}]}`), false, stateSuspended, "old_name"},
+		{"deleted", jsonResponse(404, `{"errors":[{"code":50,"message":"User not found."}]}`), false, stateDeleted, "old_name"},
+	} {
+		var query string
+		client := twitter.NewClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+			query = req.URL.RawQuery
+			return test.resp
+		})})
+		task := &Task{
+			loader:     twilter.NewSourceLoader(&twilter.UserTimelineSource{UserID: 1}, nil),
+			state:      stateActive,
+			userId:     1,
+			screenName: "old_name",
+		}
+
+		ok := task.refresh(context.Background(), client)
+		if ok != test.ok || task.state != test.state || task.screenName != test.screenName {
+			t.Errorf("%v : ok = %v, state = %v, screenName = %v", test.name, ok, task.state, task.screenName)
+		}
+		if paused := time.Now().Before(task.pausedUntil); paused == test.ok {
+			t.Errorf("%v : pausedUntil = %v", test.name, task.pausedUntil)
+		}
+		if !strings.Contains(query, "user_id=1") {
+			t.Errorf("%v : query = %v", test.name, query)
+		}
+	}
+}
@@ -8,11 +8,16 @@ import (
 	"github.com/dghubble/oauth1"
 	"github.com/go-redis/redis"
 	"github.com/kawasin73/htask"
+	"github.com/kawasin73/twilter"
+	"io"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -46,13 +51,22 @@ func setupRedis(redisUrl string) (*redis.Client, error) {
 	return redisClient, nil
 }
 
-// checkTwitterCredentials check credentials is valid.
-func checkTwitterCredentials(ctx context.Context, config *oauth1.Config, token *oauth1.Token) error {
-	httpClient := config.Client(ctx, token)
+// rateLimiter shares rate limits of Twitter API among all tasks.
+var rateLimiter = twilter.NewRateLimiter(nil)
+
+// oauthClient returns http.Client authorized by token. requests wait for rate limits by rateLimiter.
+func oauthClient(ctx context.Context, config *oauth1.Config, token *oauth1.Token) *http.Client {
+	ctx = context.WithValue(ctx, oauth1.HTTPClient, &http.Client{Transport: rateLimiter})
+	return config.Client(ctx, token)
+}
+
+// checkTwitterCredentials check credentials is valid and returns the authenticated user.
+func checkTwitterCredentials(ctx context.Context, config *oauth1.Config, token *oauth1.Token) (*twitter.User, error) {
+	httpClient := oauthClient(ctx, config, token)
 	client := twitter.NewClient(httpClient)
 	trueValue := true
 	falseValue := false
-	_, resp, err := client.Accounts.VerifyCredentials(&twitter.AccountVerifyParams{
+	user, resp, err := client.Accounts.VerifyCredentials(&twitter.AccountVerifyParams{
 		IncludeEntities: &falseValue,
 		IncludeEmail:    &falseValue,
 		SkipStatus:      &trueValue,
@@ -61,16 +75,60 @@ func checkTwitterCredentials(ctx context.Context, config *oauth1.Config, token *
 	if err == nil && resp.StatusCode >= 300 {
 		err = fmt.Errorf("request to verify credentials : %v", resp.Status)
 	}
-	return err
+	return user, err
+}
+
+// mastodonSelfId is the id of the Mastodon account of mastodonClient.
+var mastodonSelfId int64
+
+// setupMastodon creates mastodonClient and checks the access token.
+func setupMastodon(ctx context.Context, server, accessToken string) error {
+	client := &twilter.MastodonClient{HTTP: &http.Client{}, Server: server, AccessToken: accessToken}
+	account, err := client.VerifyCredentials(ctx)
+	if err != nil {
+		return err
+	}
+	if mastodonSelfId, err = strconv.ParseInt(account.ID, 10, 64); err != nil {
+		return fmt.Errorf("account id is not number : %v", account.ID)
+	}
+	log.Printf("mastodon is enabled : @%v@%v\n", account.Acct, server)
+	mastodonClient = client
+	return nil
 }
 
 func main() {
+	// subcommands
+	if len(os.Args) > 1 && os.Args[1] == "train" {
+		if err := runTrain(os.Args[2:]); err != nil {
+			log.Println("failed to train :", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplay(os.Args[2:]); err != nil {
+			log.Println("failed to replay :", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// exit with status 1 after all deferred cleanups if stopped by error.
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
 	var (
 		consumerKey    = os.Getenv("TWITTER_CONSUMER_KEY")
 		consumerSecret = os.Getenv("TWITTER_CONSUMER_SECRET")
 		accessToken    = os.Getenv("TWITTER_ACCESS_TOKEN")
 		accessSecret   = os.Getenv("TWITTER_ACCESS_TOKEN_SECRET")
 		redisUrl       = os.Getenv("REDIS_URL")
+		mastodonServer = os.Getenv("MASTODON_SERVER")
+		mastodonToken  = os.Getenv("MASTODON_ACCESS_TOKEN")
 	)
 
 	// setup command line option flags
@@ -78,7 +136,13 @@ func main() {
 	flagInterval := flag.Int("interval", 10, "interval between monitoring (minutes)")
 	flagFallback := flag.Int("fallback", 10, "start filtering tweets fallback minutes ago if no checkpoint (minutes)")
 	flagTimeout := flag.Int("timeout", 5, "timeout for each monitoring + retweet loop (minutes)")
-	flag.Var(flagTargets, "target", "list of targets. target format = \"<screen_name>:<filter>[/<filter>]\"  filter format = \"<filter_name>[(<attribute>[,<attribute>])]\"")
+	flagSync := flag.Int("sync", 60, "interval between syncing users of members and following targets (minutes)")
+	flagStream := flag.Bool("stream", false, "watch user targets by streaming API instead of polling. polling is used only to fill the gap after reconnection. members and following targets are polled")
+	flagMetrics := flag.String("metrics", "", "address to serve metrics at /debug/vars (e.g. \":8080\"). disabled if empty")
+	flag.BoolVar(&backfillGaps, "backfill", false, "retweet tweets not loaded because of too many tweets since the last monitoring by search API (only user targets, last 7 days)")
+	flag.StringVar(&apiVersion, "api", apiV1, "version of Twitter API to load user timelines and to retweet (1.1 or 2)")
+	flagReload := flag.Int("reload", 30, "interval between checking modification of wordlist and blocklist files (seconds)")
+	flag.Var(flagTargets, "target", "list of targets. target format = \"[<source>:]<name>:<filter>[/<filter>]\"  source = user, likes, list and members (name = <owner>/<slug>), search (name = \\\"<query>\\\"), following (name is optional), home and mentions (no name), mastodon (name = <user>[@<server>]), feed (name = \\\"<url>\\\")  options = \"<name>?<key>=<value>[&<key>=<value>]\"  filter format = \"<filter_name>[(<attribute>[,<attribute>])]\"")
 
 	flag.Parse()
 
@@ -86,10 +150,27 @@ func main() {
 	interval := time.Duration(*flagInterval) * time.Minute
 	fallback := time.Duration(*flagFallback) * time.Minute
 	timeout := time.Duration(*flagTimeout) * time.Minute
+	reload := time.Duration(*flagReload) * time.Second
+	syncInterval := time.Duration(*flagSync) * time.Minute
 	if len(flagTargets) == 0 {
 		log.Println("target must not be empty")
 		return
 	}
+	if apiVersion != apiV1 && apiVersion != apiV2 {
+		log.Printf("unknown api version : %v\n", apiVersion)
+		return
+	}
+
+	// stop external processes of filters on shutdown
+	defer func() {
+		for _, t := range flagTargets {
+			walkFilters(t.filters, func(f twilter.Filter) {
+				if c, ok := f.(io.Closer); ok {
+					_ = c.Close()
+				}
+			})
+		}
+	}()
 
 	// setup wait group
 	var wg sync.WaitGroup
@@ -103,11 +184,27 @@ func main() {
 	config := oauth1.NewConfig(consumerKey, consumerSecret)
 	token := oauth1.NewToken(accessToken, accessSecret)
 	// check credentials
-	if err := checkTwitterCredentials(ctx, config, token); err != nil {
+	self, err := checkTwitterCredentials(ctx, config, token)
+	if err != nil {
 		log.Println("failed to verify twitter credentials :", err)
 		return
 	}
 
+	// setup mastodon client
+	if mastodonServer != "" {
+		if err = setupMastodon(ctx, mastodonServer, mastodonToken); err != nil {
+			log.Println("failed to verify mastodon credentials :", err)
+			return
+		}
+	} else {
+		for _, t := range flagTargets {
+			if t.kind == kindMastodon {
+				log.Println("MASTODON_SERVER must be set for mastodon targets")
+				return
+			}
+		}
+	}
+
 	// setup redis client
 	redisClient, err := setupRedis(redisUrl)
 	if err != nil {
@@ -122,30 +219,126 @@ func main() {
 	sche := htask.NewScheduler(&wg, 0)
 	defer sche.Close()
 
+	streamTasks := make(map[int64]*Task)
 	for _, t := range flagTargets {
+		// members and following targets are expanded to tasks of users.
+		if t.kind == kindMembers || t.kind == kindFollow {
+			setupGroup := setupMembersGroup
+			if t.kind == kindFollow {
+				setupGroup = setupFollowingGroup
+			}
+			startGroup := func(t *target) error {
+				group, err := setupGroup(ctx, config, token, self.ID, redisClient, t, interval, timeout, fallback)
+				if err != nil {
+					return err
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					group.Run(ctx, sche, syncInterval)
+				}()
+				return nil
+			}
+			if err := startGroup(t); err != nil {
+				// retry later not to stop other targets.
+				log.Println("failed to create task group :", err)
+				wg.Add(1)
+				go func(t *target) {
+					defer wg.Done()
+					retryResolve(ctx, t.key(), func() error { return startGroup(t) })
+				}(t)
+			}
+			continue
+		}
+
 		// create task
-		task, err := setupTask(ctx, config, token, redisClient, t, interval, timeout, fallback)
+		task, err := setupTask(ctx, config, token, self.ID, redisClient, t, interval, timeout, fallback)
 		if err != nil {
-			log.Panic("failed to create task :", err)
+			// retry later not to stop other targets. resolved tasks are polled even with -stream.
+			log.Println("failed to create task :", err)
+			wg.Add(1)
+			go func(t *target) {
+				defer wg.Done()
+				retryResolve(ctx, t.key(), func() error {
+					task, err := setupTask(ctx, config, token, self.ID, redisClient, t, interval, timeout, fallback)
+					if err != nil {
+						return err
+					}
+					return task.Start(ctx, sche)
+				})
+			}(t)
+			continue
+		}
+
+		// user targets are watched by streaming API.
+		if userId, ok := userOf(task.loader.Source()); ok && *flagStream {
+			streamTasks[userId] = task
+			continue
 		}
 
 		// start task.
-		err = task.Start(ctx, sche)
-		if err != nil {
-			log.Panic("failed to start task", err)
+		if err = task.Start(ctx, sche); err != nil {
+			log.Println("failed to start task :", err)
 		}
 	}
 
+	// start streaming
+	if len(streamTasks) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// the streaming connection is not limited by rateLimiter. reconnection has its own backoff.
+			runStream(ctx, &wg, config.Client(ctx, token), streamTasks, nil)
+		}()
+	}
+
+	// serve metrics
+	if *flagMetrics != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveMetrics(ctx, *flagMetrics)
+		}()
+	}
+
+	// watch modification of word lists
+	for _, list := range wordLists {
+		wg.Add(1)
+		go func(list *twilter.WordList) {
+			defer wg.Done()
+			list.Watch(ctx, reload)
+		}(list)
+	}
+
 	// setup signal.
 	signal.Ignore()
 	chsig := make(chan os.Signal, 1)
-	// watch SIGINT
-	signal.Notify(chsig, os.Interrupt)
+	// watch SIGINT and SIGHUP
+	signal.Notify(chsig, os.Interrupt, syscall.SIGHUP)
 
-	// wait until signal come.
-	select {
-	case <-chsig:
+	// wait until SIGINT come or errorPolicy stops the process.
+	for {
+		var sig os.Signal
+		select {
+		case sig = <-chsig:
+		case err := <-chFatal:
+			log.Println("shutdown by error :", err)
+			exitCode = 1
+			return
+		}
+		if sig == syscall.SIGHUP {
+			// reload word lists
+			for _, list := range wordLists {
+				if err := list.Reload(); err != nil {
+					log.Printf("failed to reload %v : %v\n", list.Path(), err)
+				} else {
+					log.Printf("reloaded %v (%d terms)\n", list.Path(), list.Len())
+				}
+			}
+			continue
+		}
 		// signal (SIGINT) has come.
 		log.Println("shutdown...")
+		return
 	}
 }
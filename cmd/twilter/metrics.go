@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"github.com/kawasin73/twilter"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// metrics of each source. exposed at /debug/vars.
+var (
+	// gapMetrics counts gaps of tweets not loaded.
+	gapMetrics           = expvar.NewMap("gaps")
+	pageMetrics          = expvar.NewMap("pages")
+	apiCallMetrics       = expvar.NewMap("api_calls")
+	scannedMetrics       = expvar.NewMap("scanned")
+	matchedMetrics       = expvar.NewMap("matched")
+	rateLimitMetrics     = expvar.NewMap("rate_limit_sleep_seconds")
+	rateRemainingMetrics = expvar.NewMap("rate_limit_remaining")
+)
+
+// recordLoadStats adds LoadStats of the source to metrics.
+func recordLoadStats(source twilter.Source, stats *twilter.LoadStats) {
+	key := source.String()
+	pageMetrics.Add(key, int64(stats.Pages))
+	apiCallMetrics.Add(key, int64(stats.APICalls))
+	scannedMetrics.Add(key, int64(stats.Scanned))
+	matched := 0
+	for _, n := range stats.Matched {
+		matched += n
+	}
+	matchedMetrics.Add(key, int64(matched))
+	rateLimitMetrics.AddFloat(key, stats.RateLimitSleep.Seconds())
+	if stats.RateLimitRemaining >= 0 {
+		remaining := new(expvar.Int)
+		remaining.Set(int64(stats.RateLimitRemaining))
+		rateRemainingMetrics.Set(key, remaining)
+	}
+}
+
+// logLoadStats logs LoadStats with the number of matched tweets of each filter.
+func logLoadStats(source twilter.Source, filters []twilter.Filter, stats *twilter.LoadStats) {
+	matched := make([]string, len(stats.Matched))
+	for i, n := range stats.Matched {
+		matched[i] = fmt.Sprintf("%v=%d", filters[i], n)
+	}
+	log.Printf("%v : load %d pages (%d calls), scan %d items, match [%v], rate limit sleep %v, remaining %d\n",
+		source, stats.Pages, stats.APICalls, stats.Scanned, strings.Join(matched, " "), stats.RateLimitSleep, stats.RateLimitRemaining)
+}
+
+// serveMetrics serves expvar metrics at http://<addr>/debug/vars until ctx is done.
+func serveMetrics(ctx context.Context, addr string) {
+	server := &http.Server{Addr: addr, Handler: expvar.Handler()}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Println("failed to serve metrics :", err)
+	}
+}
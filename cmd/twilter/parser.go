@@ -3,9 +3,29 @@ package main
 import (
 	"fmt"
 	"github.com/kawasin73/twilter"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// userCache is shared by all author filters.
+var userCache = twilter.NewUserCache(0)
+
+// wordLists is loaded word lists. filters of the same file share the list.
+var wordLists = make(map[string]*twilter.WordList)
+
+func loadWordList(path string) (*twilter.WordList, error) {
+	if list, ok := wordLists[path]; ok {
+		return list, nil
+	}
+	list, err := twilter.LoadWordList(path)
+	if err != nil {
+		return nil, err
+	}
+	wordLists[path] = list
+	return list, nil
+}
+
 func unwrapArgs(args string) (string, error) {
 	// remove ( and )
 	if len(args) < 3 || args[0] != '(' || args[len(args)-1] != ')' {
@@ -34,6 +54,14 @@ func splitArgs(args string, sep string) ([]string, error) {
 				}
 			}
 
+		case '"':
+			// skip quoted string which may include separators or parentheses.
+			end, err := skipQuoted(args, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+
 		case '(':
 			depth++
 
@@ -54,6 +82,28 @@ func splitArgs(args string, sep string) ([]string, error) {
 	return values, nil
 }
 
+// unquoteArg unquotes the argument if it is quoted.
+func unquoteArg(arg string) string {
+	if unquoted, err := strconv.Unquote(arg); err == nil {
+		return unquoted
+	}
+	return arg
+}
+
+// skipQuoted returns index of closing quote of the quoted string starting at head.
+func skipQuoted(args string, head int) (int, error) {
+	for i := head + 1; i < len(args); i++ {
+		switch args[i] {
+		case '\\':
+			// skip escaped character
+			i++
+		case '"':
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("quoted string not terminated : %v", args[head:])
+}
+
 func parseFilters(value string, sep string) ([]twilter.Filter, error) {
 	// parse multi filters separated by sep
 	values, err := splitArgs(value, sep)
@@ -90,6 +140,105 @@ func parseFilter(value string) (twilter.Filter, error) {
 		// "qt"
 		return twilter.QTFilter{}, nil
 
+	case value == "sensitive":
+		// "sensitive"
+		return twilter.SensitiveFilter{}, nil
+
+	case strings.HasPrefix(value, "expr"):
+		// "expr(\"<expression>\")"
+		args, err := unwrapArgs(value[4:])
+		if err != nil {
+			return nil, err
+		}
+		src, err := strconv.Unquote(args)
+		if err != nil {
+			return nil, fmt.Errorf("expr must be quoted string : %v", args)
+		}
+		return twilter.NewExprFilter(src)
+
+	case strings.HasPrefix(value, "exec"):
+		// "exec(\"<command>\"[,fail=open|closed][,timeout=<duration>])"
+		args, err := unwrapArgs(value[4:])
+		if err != nil {
+			return nil, err
+		}
+		values, err := splitArgs(args, ",")
+		if err != nil {
+			return nil, err
+		}
+		command, err := strconv.Unquote(values[0])
+		if err != nil {
+			return nil, fmt.Errorf("exec command must be quoted string : %v", values[0])
+		}
+		option := new(twilter.ExecOption)
+		for _, v := range values[1:] {
+			switch {
+			case v == "fail=open":
+				option.FailOpen = true
+			case v == "fail=closed":
+				option.FailOpen = false
+			case strings.HasPrefix(v, "timeout="):
+				if option.Timeout, err = time.ParseDuration(v[len("timeout="):]); err != nil {
+					return nil, fmt.Errorf("exec timeout is invalid : %v", err)
+				}
+			default:
+				return nil, fmt.Errorf("exec option \"%v\" is invalid", v)
+			}
+		}
+		return twilter.NewExecFilter(command, option)
+
+	case strings.HasPrefix(value, "author"):
+		// "author(<condition>[,<condition>[,...]])"
+		if args, err := unwrapArgs(value[6:]); err != nil {
+			return nil, err
+		} else if conditions, err := splitArgs(args, ","); err != nil {
+			return nil, err
+		} else if filter, err := twilter.NewAuthorFilter(userCache, conditions...); err != nil {
+			return nil, err
+		} else {
+			return twilter.FromContextFilter(filter), nil
+		}
+
+	case strings.HasPrefix(value, "classifier"):
+		// "classifier(<model file>[,<threshold>])"
+		args, err := unwrapArgs(value[10:])
+		if err != nil {
+			return nil, err
+		}
+		values, err := splitArgs(args, ",")
+		if err != nil {
+			return nil, err
+		}
+		threshold := 0.5
+		if len(values) > 2 {
+			return nil, fmt.Errorf("classifier takes model file and threshold")
+		} else if len(values) == 2 {
+			if threshold, err = strconv.ParseFloat(values[1], 64); err != nil {
+				return nil, fmt.Errorf("classifier threshold is invalid : %v", err)
+			}
+		}
+		return twilter.NewClassifierFilter(unquoteArg(values[0]), threshold)
+
+	case strings.HasPrefix(value, "wordlist"):
+		// "wordlist(<path>)"
+		if args, err := unwrapArgs(value[8:]); err != nil {
+			return nil, err
+		} else if list, err := loadWordList(unquoteArg(args)); err != nil {
+			return nil, err
+		} else {
+			return twilter.WordListFilter{List: list}, nil
+		}
+
+	case strings.HasPrefix(value, "blocklist"):
+		// "blocklist(<path>)"
+		if args, err := unwrapArgs(value[9:]); err != nil {
+			return nil, err
+		} else if list, err := loadWordList(unquoteArg(args)); err != nil {
+			return nil, err
+		} else {
+			return twilter.BlockListFilter{List: list}, nil
+		}
+
 	case strings.HasPrefix(value, "not"):
 		// "not(<filter>)"
 		args, err := unwrapArgs(value[3:])
@@ -100,7 +249,7 @@ func parseFilter(value string) (twilter.Filter, error) {
 		if err != nil {
 			return nil, err
 		}
-		return twilter.NotFilter{filter}, nil
+		return twilter.NotFilter{Original: filter}, nil
 
 	case strings.HasPrefix(value, "and"):
 		// "and(<filter>[,<filter>[,...]])"
@@ -109,7 +258,7 @@ func parseFilter(value string) (twilter.Filter, error) {
 		} else if filters, err := parseFilters(args, ","); err != nil {
 			return nil, err
 		} else {
-			return twilter.AndFilter{filters}, nil
+			return twilter.AndFilter{Filters: filters}, nil
 		}
 
 	case strings.HasPrefix(value, "or"):
@@ -119,7 +268,7 @@ func parseFilter(value string) (twilter.Filter, error) {
 		} else if filters, err := parseFilters(args, ","); err != nil {
 			return nil, err
 		} else {
-			return twilter.OrFilter{filters}, nil
+			return twilter.OrFilter{Filters: filters}, nil
 		}
 
 	default:
@@ -128,10 +277,248 @@ func parseFilter(value string) (twilter.Filter, error) {
 	}
 }
 
-// target is pair of screenName and filters.
+// walkFilters calls fn for all filters including filters nested in not, and, or.
+func walkFilters(filters []twilter.Filter, fn func(f twilter.Filter)) {
+	for _, f := range filters {
+		fn(f)
+		switch f := f.(type) {
+		case twilter.NotFilter:
+			walkFilters([]twilter.Filter{f.Original}, fn)
+		case twilter.AndFilter:
+			walkFilters(f.Filters, fn)
+		case twilter.OrFilter:
+			walkFilters(f.Filters, fn)
+		}
+	}
+}
+
+// kinds of target
+const (
+	kindUser     = "user"
+	kindHome     = "home"
+	kindMentions = "mentions"
+	kindList     = "list"
+	kindLikes    = "likes"
+	kindSearch   = "search"
+	kindMembers  = "members"
+	kindFollow   = "following"
+	kindMastodon = "mastodon"
+	kindFeed     = "feed"
+)
+
+// target is pair of source and filters.
 type target struct {
-	screenName string
-	filters    []twilter.Filter
+	kind string
+	// name is screen_name for user and likes, owner/slug for list and members, query for search,
+	// screen_name or empty (the dummy account) for following, empty for home and mentions, acct (<user>[@<server>]) for mastodon, url for feed.
+	name    string
+	filters []twilter.Filter
+	// option is parameters of loading tweets set by target options. Fallback is not set.
+	option twilter.LoaderOption
+}
+
+// key returns unique key of target.
+func (t *target) key() string {
+	if t.name == "" {
+		return t.kind
+	}
+	return t.kind + ":" + t.name
+}
+
+// loaderOption returns a copy of option of the target with fallback.
+func (t *target) loaderOption(fallback time.Duration) *twilter.LoaderOption {
+	option := t.option
+	option.Fallback = fallback
+	return &option
+}
+
+// splitOptions splits "<name>?<options>" into name and options.
+func splitOptions(value string) (name, options string) {
+	if idx := strings.Index(value, "?"); idx >= 0 {
+		return value[:idx], value[idx+1:]
+	}
+	return value, ""
+}
+
+// quotedName is the name of quoted names of targets.
+var quotedName = map[string]string{kindSearch: "query", kindFeed: "url"}
+
+// parseTarget splits target into kind, name, options and filters.
+//
+//	"<screen_name>:<filters>", "user:<screen_name>:<filters>", "likes:<screen_name>:<filters>",
+//	"list:<owner>/<slug>:<filters>", "members:<owner>/<slug>:<filters>", "following:[<screen_name>:]<filters>", "home:<filters>", "mentions:<filters>", "search:\"<query>\":<filters>",
+//	"mastodon:<user>[@<server>]:<filters>", "feed:\"<url>\":<filters>"
+//
+// options follow the name (or the kind if no name) as "?<key>=<value>[&<key>=<value>]" (e.g. "user:<screen_name>?replies=false:<filters>").
+//
+// kinds shadow users of the same screen name. "<kind>:..." is always parsed as the kind and rejected if invalid as the kind,
+// so such users must be "user:<screen_name>:<filters>".
+func parseTarget(value string) (kind, name, options, filters string, err error) {
+	kind, name, options, filters, err = splitTarget(value)
+	if err != nil {
+		head, _ := splitOptions(value[:strings.Index(value+":", ":")])
+		if reservedKinds[head] {
+			err = fmt.Errorf("%v (use \"user:%v:<filters>\" for the user @%v)", err, head, head)
+		}
+	}
+	return kind, name, options, filters, err
+}
+
+// reservedKinds is the kinds which are not parsed as screen names.
+var reservedKinds = map[string]bool{
+	kindUser: true, kindHome: true, kindMentions: true, kindList: true, kindLikes: true,
+	kindSearch: true, kindMembers: true, kindFollow: true, kindMastodon: true, kindFeed: true,
+}
+
+// splitTarget splits target into kind, name, options and filters. see parseTarget.
+func splitTarget(value string) (kind, name, options, filters string, err error) {
+	idx := strings.Index(value, ":")
+	if idx < 0 {
+		return "", "", "", "", fmt.Errorf("target has no screenName nor filter")
+	}
+	head, rest := value[:idx], value[idx+1:]
+	head, options = splitOptions(head)
+
+	switch head {
+	case kindHome, kindMentions:
+		return head, "", options, rest, nil
+
+	case kindFollow:
+		// screen_name is optional. filters may include ":" in quotes or parentheses.
+		values, err := splitArgs(rest, ":")
+		if err != nil {
+			return "", "", "", "", err
+		}
+		if len(values) < 2 {
+			return head, "", options, rest, nil
+		}
+		var nameOptions string
+		name, nameOptions = splitOptions(values[0])
+		if name == "" {
+			return "", "", "", "", fmt.Errorf("following target has empty screenName")
+		}
+		if nameOptions != "" {
+			options = nameOptions
+		}
+		return head, name, options, rest[len(values[0])+1:], nil
+
+	case kindSearch, kindFeed:
+		// query and url are quoted because they may contain ":"
+		if !strings.HasPrefix(rest, "\"") {
+			return "", "", "", "", fmt.Errorf("%v target must be %v:\"<%v>\":<filters>", head, head, quotedName[head])
+		}
+		end, err := skipQuoted(rest, 0)
+		if err != nil {
+			return "", "", "", "", err
+		}
+		name, err = strconv.Unquote(rest[:end+1])
+		if err != nil {
+			return "", "", "", "", fmt.Errorf("%v %v is invalid : %v", head, quotedName[head], err)
+		}
+		rest = rest[end+1:]
+		if strings.HasPrefix(rest, "?") {
+			idx = strings.Index(rest, ":")
+			if idx < 0 {
+				return "", "", "", "", fmt.Errorf("%v target has no filter", head)
+			}
+			options, rest = rest[1:idx], rest[idx:]
+		}
+		if name == "" || rest == "" || rest[0] != ':' {
+			return "", "", "", "", fmt.Errorf("%v target has no %v nor filter", head, quotedName[head])
+		}
+		return head, name, options, rest[1:], nil
+
+	case kindUser, kindLikes, kindList, kindMembers, kindMastodon:
+		idx = strings.Index(rest, ":")
+		if idx <= 0 {
+			return "", "", "", "", fmt.Errorf("%v target has no name nor filter", head)
+		}
+		name, options = splitOptions(rest[:idx])
+		isList := head == kindList || head == kindMembers
+		if slash := strings.Index(name, "/"); isList && (slash <= 0 || slash == len(name)-1) {
+			return "", "", "", "", fmt.Errorf("%v target must be \"%v:<owner>/<slug>\" : %v", head, head, name)
+		}
+		if name == "" {
+			return "", "", "", "", fmt.Errorf("%v target has no name", head)
+		}
+		return head, name, options, rest[idx+1:], nil
+
+	default:
+		if head == "" {
+			return "", "", "", "", fmt.Errorf("target has no screenName")
+		}
+		return kindUser, head, options, rest, nil
+	}
+}
+
+// parseTargetOptions parses options "<key>=<value>[&<key>=<value>]" of target into option.
+//
+//	rts=true|false        include retweets (user and list)
+//	replies=true|false    include replies (user and home)
+//	trim_user=true|false  trim user objects (user, home and mentions)
+//	since=<YYYY-MM-DD>    load tweets posted since the date (UTC) instead of fallback
+//	until=<YYYY-MM-DD>    load tweets posted before the date (UTC)
+//	max_id=<id>           load tweets whose id is max_id or less
+//
+// until is converted to the id of kind (status id for mastodon, tweet id for others).
+func parseTargetOptions(kind, options string, option *twilter.LoaderOption) error {
+	if options == "" {
+		return nil
+	}
+	for _, pair := range strings.Split(options, "&") {
+		idx := strings.Index(pair, "=")
+		if idx <= 0 {
+			return fmt.Errorf("target option \"%v\" must be <key>=<value>", pair)
+		}
+		key, value := pair[:idx], pair[idx+1:]
+		switch key {
+		case "rts", "replies", "trim_user":
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("target option %v is invalid : %v", key, err)
+			}
+			switch key {
+			case "rts":
+				option.IncludeRetweets = &b
+			case "replies":
+				exclude := !b
+				option.ExcludeReplies = &exclude
+			case "trim_user":
+				option.TrimUser = &b
+			}
+
+		case "since", "until":
+			date, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return fmt.Errorf("target option %v must be YYYY-MM-DD : %v", key, err)
+			}
+			minID := twilter.SnowflakeID
+			switch kind {
+			case kindMastodon:
+				minID = twilter.MastodonID
+			case kindFeed:
+				minID = twilter.FeedID
+			}
+			if key == "since" {
+				option.Since = date
+			} else if id := minID(date) - 1; id > 0 {
+				option.MaxID = id
+			} else {
+				return fmt.Errorf("target option until is before the first tweet : %v", value)
+			}
+
+		case "max_id":
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				return fmt.Errorf("target option max_id is invalid : %v", value)
+			}
+			option.MaxID = id
+
+		default:
+			return fmt.Errorf("target option \"%v\" is invalid", key)
+		}
+	}
+	return nil
 }
 
 // targetValue stores targets.
@@ -140,35 +527,42 @@ type targetValue map[string]*target
 // String returns string output.
 func (tv targetValue) String() string {
 	str := ""
-	for name, t := range tv {
-		str += fmt.Sprintf("%s:%v,", name, t.filters)
+	for key, t := range tv {
+		str += fmt.Sprintf("%s:%v,", key, t.filters)
 	}
 	return str
 }
 
 // Set convert string to target and set or merge it in map.
 func (tv targetValue) Set(value string) error {
-	// get screen_name
-	idx := strings.Index(value, ":")
-	if idx < 0 {
-		return fmt.Errorf("target has no screenName nor filter")
+	// get kind, name and options
+	kind, name, options, value, err := parseTarget(value)
+	if err != nil {
+		return err
 	}
-	screenName := value[:idx]
 
 	// get filters
-	filters, err := parseFilters(value[idx+1:], "/")
+	filters, err := parseFilters(value, "/")
 	if err != nil {
 		return err
 	}
 
 	// get target
-	t, ok := tv[screenName]
+	newTarget := &target{kind: kind, name: name}
+	t, ok := tv[newTarget.key()]
 	if !ok {
-		// create new target
-		t = &target{
-			screenName: screenName,
-		}
-		tv[screenName] = t
+		t = newTarget
+	}
+
+	// set options. options of the same target are merged.
+	option := t.option
+	if err = parseTargetOptions(kind, options, &option); err != nil {
+		return err
+	}
+	t.option = option
+	if !ok {
+		// add new target
+		tv[t.key()] = t
 	}
 
 	// set filters
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"github.com/kawasin73/twilter"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseFilters(t *testing.T) {
@@ -41,6 +47,7 @@ func TestParseFilters(t *testing.T) {
 				}},
 			},
 		}},
+		{"sensitive", []twilter.Filter{twilter.SensitiveFilter{}}},
 	} {
 		filters, err := parseFilters(test.input, "/")
 		if err != nil {
@@ -50,3 +57,155 @@ func TestParseFilters(t *testing.T) {
 		}
 	}
 }
+
+func TestParseFilterString(t *testing.T) {
+	for _, test := range []struct {
+		input  string
+		output string
+	}{
+		{`expr("favorite_count > 50")`, `[expr("favorite_count > 50")]`},
+		{`expr("contains(text, \"a/b,c)\")")/rt`, `[expr("contains(text, \"a/b,c)\")") rt]`},
+		{`and(expr("len(text) > 10"),photo)`, `[and(expr("len(text) > 10"),photo)]`},
+		{`author(verified,followers>=100)/and(rt,author(protected=false))`, `[author(verified,followers>=100) and(rt,author(protected=false))]`},
+	} {
+		filters, err := parseFilters(test.input, "/")
+		if err != nil {
+			t.Errorf("\"%v\" failed : %v", test.input, err)
+		} else if s := fmt.Sprint(filters); s != test.output {
+			t.Errorf("\"%v\" not equal : %v, expected %v", test.input, s, test.output)
+		}
+	}
+
+	for _, input := range []string{`expr(favorite_count)`, `expr("favorite_count")`, `expr("a)`, `author()`, `author(followers>=a)`, `author(name=a)`} {
+		if _, err := parseFilters(input, "/"); err == nil {
+			t.Errorf("\"%v\" must fail", input)
+		}
+	}
+}
+
+func TestTargetValue(t *testing.T) {
+	tv := make(targetValue)
+	for _, input := range []string{
+		"kawasin73:photo",
+		"kawasin73:rt",
+		"user:home:video",
+		"home:photo",
+		"mentions:rt",
+		"list:kawasin73/artists:photo",
+		"likes:kawasin73:video",
+		"members:kawasin73/artists:photo/rt",
+		"following:video",
+		`following:kawasin73:expr("text == \"a:b\"")`,
+		`search:"#art filter:images":photo`,
+		`search:"from:foo \"a:b\"":rt`,
+		"user:kawasin73?replies=false&rts=false:video",
+		"mentions?trim_user=false:photo",
+		"following:kawasin73?since=2019-05-01:rt",
+		`search:"#art"?max_id=1000:video`,
+		"mastodon:alice@example.social?until=2019-05-01:not(sensitive)",
+		`feed:"https://blog.example.com/feed.xml"?until=2019-05-01:photo`,
+	} {
+		if err := tv.Set(input); err != nil {
+			t.Errorf("\"%v\" failed : %v", input, err)
+		}
+	}
+	for _, test := range []struct {
+		key     string
+		kind    string
+		name    string
+		filters string
+	}{
+		{"user:kawasin73", kindUser, "kawasin73", "[photo rt video]"},
+		{"user:home", kindUser, "home", "[video]"},
+		{"home", kindHome, "", "[photo]"},
+		{"mentions", kindMentions, "", "[rt photo]"},
+		{"list:kawasin73/artists", kindList, "kawasin73/artists", "[photo]"},
+		{"likes:kawasin73", kindLikes, "kawasin73", "[video]"},
+		{"members:kawasin73/artists", kindMembers, "kawasin73/artists", "[photo rt]"},
+		{"following", kindFollow, "", "[video]"},
+		{"following:kawasin73", kindFollow, "kawasin73", `[expr("text == \"a:b\"") rt]`},
+		{"search:#art filter:images", kindSearch, "#art filter:images", "[photo]"},
+		{`search:from:foo "a:b"`, kindSearch, `from:foo "a:b"`, "[rt]"},
+		{"search:#art", kindSearch, "#art", "[video]"},
+		{"mastodon:alice@example.social", kindMastodon, "alice@example.social", "[not(sensitive)]"},
+		{"feed:https://blog.example.com/feed.xml", kindFeed, "https://blog.example.com/feed.xml", "[photo]"},
+	} {
+		target, ok := tv[test.key]
+		if !ok {
+			t.Errorf("target \"%v\" not found", test.key)
+		} else if target.kind != test.kind || target.name != test.name || fmt.Sprint(target.filters) != test.filters {
+			t.Errorf("target \"%v\" = %v %v %v", test.key, target.kind, target.name, target.filters)
+		}
+	}
+
+	// options
+	if option := tv["user:kawasin73"].option; option.ExcludeReplies == nil || !*option.ExcludeReplies || option.IncludeRetweets == nil || *option.IncludeRetweets || option.TrimUser != nil {
+		t.Errorf("options of user = %+v", option)
+	}
+	if option := tv["mentions"].option; option.TrimUser == nil || *option.TrimUser {
+		t.Errorf("options of mentions = %+v", option)
+	}
+	if option := tv["following:kawasin73"].option; !option.Since.Equal(time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("options of following = %+v", option)
+	}
+	if option := tv["search:#art"].option; option.MaxID != 1000 {
+		t.Errorf("options of search = %+v", option)
+	}
+	if option := tv["mastodon:alice@example.social"].option; option.MaxID != twilter.MastodonID(time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC))-1 {
+		t.Errorf("options of mastodon = %+v", option)
+	}
+	if option := tv["feed:https://blog.example.com/feed.xml"].option; option.MaxID != twilter.FeedID(time.Date(2019, 5, 1, 0, 0, 0, 0, time.UTC))-1 {
+		t.Errorf("options of feed = %+v", option)
+	}
+
+	for _, input := range []string{"user:?rts=false:photo", "kawasin73?rts=no:photo", "kawasin73?foo=1:photo", "kawasin73?since=2019/05/01:photo", "kawasin73?until=2001-01-01:photo", `search:"art"?rts=false`, "photo", ":photo", "list:kawasin73:photo", "list:kawasin73/:photo", "likes:photo", "members:kawasin73:photo", "following::photo", "search:art:photo", "mastodon:photo", `search:"art:photo`, `search:"":photo`, `search:"art"photo`, "feed:https://blog.example.com/feed.xml:photo", `feed:"":photo`} {
+		if err := tv.Set(input); err == nil {
+			t.Errorf("\"%v\" must fail", input)
+		}
+	}
+
+	// kinds are not parsed as screen names. the error tells the form of the user.
+	for _, test := range []struct {
+		input string
+		hint  string
+	}{
+		{"likes:photo", "user:likes:<filters>"},
+		{"list:photo", "user:list:<filters>"},
+		{"search?rts=false:photo", "user:search:<filters>"},
+	} {
+		if err := tv.Set(test.input); err == nil || !strings.Contains(err.Error(), test.hint) {
+			t.Errorf("\"%v\" : err = %v", test.input, err)
+		}
+	}
+}
+
+func TestParseClassifierString(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	model := twilter.NewClassifier()
+	model.Add("new illustration #art", true)
+	model.Add("had ramen for lunch", false)
+	path := filepath.Join(dir, "art,v2).json")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = model.Save(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the path is quoted to be parsed again.
+	filters, err := parseFilters(fmt.Sprintf("classifier(%q,0.8)", path), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := fmt.Sprint(filters[0])
+	if filters, err = parseFilters(s, "/"); err != nil || fmt.Sprint(filters[0]) != s {
+		t.Errorf("%v is parsed to %v : %v", s, filters, err)
+	}
+}
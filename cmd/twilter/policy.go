@@ -0,0 +1,84 @@
+package main
+
+import (
+	"github.com/kawasin73/twilter"
+	"log"
+	"time"
+)
+
+// action is what the daemon does when a request to Twitter API fails.
+type action int
+
+const (
+	// actionRetry stops the current monitoring and retries at the next interval.
+	actionRetry action = iota
+	// actionSkip skips the tweet and goes on.
+	actionSkip
+	// actionPause stops monitoring the target for a while.
+	actionPause
+	// actionStop stops the process.
+	actionStop
+)
+
+// errorPolicy is the action for each class of errors. Unknown and classes not in the table are retried.
+var errorPolicy = map[twilter.ErrorClass]action{
+	twilter.Transient:           actionRetry,
+	twilter.RateLimited:         actionPause,
+	twilter.AuthInvalid:         actionStop,
+	twilter.TargetProtected:     actionPause,
+	twilter.TargetSuspended:     actionPause,
+	twilter.TargetNotFound:      actionPause,
+	twilter.TweetDeleted:        actionSkip,
+	twilter.RetweetNotPermitted: actionSkip,
+	twilter.AlreadyRetweeted:    actionSkip,
+}
+
+// pauseDuration is how long a target is paused for errors of the target itself (protected, suspended, not found).
+var pauseDuration = 6 * time.Hour
+
+// chFatal receives the error which stops the process.
+var chFatal = make(chan error, 1)
+
+// decide returns the action for err and the time until which the target is paused.
+func decide(err error) (action, time.Time) {
+	cerr := twilter.Classify(nil, err)
+	if cerr == nil {
+		return actionRetry, time.Time{}
+	}
+	act, ok := errorPolicy[cerr.Class]
+	if !ok {
+		return actionRetry, time.Time{}
+	}
+	if act != actionPause {
+		return act, time.Time{}
+	}
+	if cerr.Class == twilter.RateLimited {
+		// wait for the rate limit to be reset (e.g. the daily limit of retweets).
+		return act, cerr.ResetAt
+	}
+	return act, time.Now().Add(pauseDuration)
+}
+
+// stopProcess requests main to stop the process.
+func stopProcess(err error) {
+	select {
+	case chFatal <- err:
+	default:
+		// already requested
+	}
+}
+
+// handleError applies the action of errorPolicy for err of the task and returns the action.
+func (t *Task) handleError(err error) action {
+	act, until := decide(err)
+	source := t.loader.Source()
+	switch act {
+	case actionPause:
+		t.pausedUntil = until
+		log.Printf("%v : pause until %v : %v\n", source, until.Format(time.RFC3339), err)
+	case actionStop:
+		log.Printf("%v : stop the process : %v\n", source, err)
+		stopProcess(err)
+	}
+	return act
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"github.com/kawasin73/twilter"
+	"testing"
+	"time"
+)
+
+func TestDecide(t *testing.T) {
+	resetAt := time.Now().Add(time.Minute)
+	for _, test := range []struct {
+		err   error
+		act   action
+		pause bool
+	}{
+		{fmt.Errorf("unknown"), actionRetry, false},
+		{&twilter.ClassifiedError{Class: twilter.Transient, Err: fmt.Errorf("503")}, actionRetry, false},
+		{&twilter.ClassifiedError{Class: twilter.TweetDeleted, Err: fmt.Errorf("144")}, actionSkip, false},
+		{&twilter.ClassifiedError{Class: twilter.AlreadyRetweeted, Err: fmt.Errorf("327")}, actionSkip, false},
+		{&twilter.ClassifiedError{Class: twilter.TargetProtected, Err: fmt.Errorf("401")}, actionPause, true},
+		{&twilter.ClassifiedError{Class: twilter.RateLimited, ResetAt: resetAt, Err: fmt.Errorf("185")}, actionPause, true},
+		{&twilter.ClassifiedError{Class: twilter.AuthInvalid, Err: fmt.Errorf("89")}, actionStop, false},
+	} {
+		act, until := decide(test.err)
+		if act != test.act || until.IsZero() == test.pause {
+			t.Errorf("decide(%v) = %v, %v", test.err, act, until)
+		}
+		if cerr, ok := test.err.(*twilter.ClassifiedError); ok && cerr.Class == twilter.RateLimited && !until.Equal(resetAt) {
+			t.Errorf("rate limited until %v", until)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/dghubble/oauth1"
+	"github.com/kawasin73/twilter"
+	"io"
+	"log"
+	"math"
+	"os"
+)
+
+// runReplay runs replay subcommand which runs filters over tweets files (data export or JSONL) without network access.
+// matched tweets are written as JSONL and retweeted by the dummy account with -retweet.
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	flagFilters := fs.String("filter", "", "filters in the same format as targets (e.g. \"photo/rt\")")
+	flagOptions := fs.String("options", "", "target options (e.g. \"rts=false&since=2019-01-01\")")
+	flagOutput := fs.String("o", "-", "output JSONL file of matched tweets. \"-\" is stdout")
+	flagRetweet := fs.Bool("retweet", false, "retweet matched tweets by the dummy account of TWITTER_* environment variables")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: twilter replay [options] <tweets file>...")
+		fmt.Fprintln(fs.Output(), "  tweets file is tweet.js (or tweets.js) of Twitter data export, JSON array or JSONL of tweet objects")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no tweets file")
+	}
+	if *flagFilters == "" {
+		return fmt.Errorf("filter must not be empty")
+	}
+	filters, err := parseFilters(*flagFilters, "/")
+	if err != nil {
+		return fmt.Errorf("parse filter : %v", err)
+	}
+	var option twilter.LoaderOption
+	if err = parseTargetOptions(kindUser, *flagOptions, &option); err != nil {
+		return err
+	}
+	// load all tweets of the file. pages are never exhausted by the limit of APIs.
+	option.Fallback = -1
+	option.MaxIteration = math.MaxInt32
+
+	var output io.Writer = os.Stdout
+	if *flagOutput != "-" {
+		file, err := os.Create(*flagOutput)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		output = file
+	}
+	w := bufio.NewWriter(output)
+	defer w.Flush()
+
+	ctx := context.Background()
+	var rt twilter.Retweeter
+	if *flagRetweet {
+		config := oauth1.NewConfig(os.Getenv("TWITTER_CONSUMER_KEY"), os.Getenv("TWITTER_CONSUMER_SECRET"))
+		token := oauth1.NewToken(os.Getenv("TWITTER_ACCESS_TOKEN"), os.Getenv("TWITTER_ACCESS_TOKEN_SECRET"))
+		if _, err = checkTwitterCredentials(ctx, config, token); err != nil {
+			return fmt.Errorf("verify twitter credentials : %v", err)
+		}
+		rt = twilter.NewRetweeter(twitter.NewClient(oauthClient(ctx, config, token)))
+	}
+
+	for _, path := range fs.Args() {
+		opt := option
+		if err = replayFile(ctx, twilter.NewSourceLoader(&twilter.FileSource{Path: path}, &opt), filters, w, rt); err != nil {
+			return fmt.Errorf("replay %v : %v", path, err)
+		}
+	}
+	return w.Flush()
+}
+
+// replayFile writes tweets matched by filters oldest first and retweets them if rt is not nil.
+func replayFile(ctx context.Context, loader *twilter.Loader, filters []twilter.Filter, w io.Writer, rt twilter.Retweeter) error {
+	encoder := json.NewEncoder(w)
+	it := loader.Stream(ctx, nil, 0, filters)
+	for it.Next() {
+		tweet := it.Tweet()
+		if err := encoder.Encode(tweet); err != nil {
+			return err
+		}
+		if rt == nil {
+			continue
+		}
+		if err := rt.Retweet(ctx, tweet.ID); err != nil {
+			if act, _ := decide(err); act != actionSkip {
+				return fmt.Errorf("retweet (%d) : %v", tweet.ID, err)
+			}
+			log.Println("skip to retweet :", tweet.ID, err)
+		} else {
+			log.Println("retweeted :", tweet.ID)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	stats := it.Stats()
+	logLoadStats(loader.Source(), filters, &stats)
+	return nil
+}
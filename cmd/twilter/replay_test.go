@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/kawasin73/twilter"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeRetweeter records retweeted ids and fails with the error of each id.
+type fakeRetweeter struct {
+	retweeted []int64
+	errors    map[int64]error
+}
+
+func (r *fakeRetweeter) Retweet(ctx context.Context, tweetID int64) error {
+	if err, ok := r.errors[tweetID]; ok {
+		return err
+	}
+	r.retweeted = append(r.retweeted, tweetID)
+	return nil
+}
+
+func (r *fakeRetweeter) Unretweet(ctx context.Context, tweetID int64) error {
+	return nil
+}
+
+func TestReplayFile(t *testing.T) {
+	filters, err := parseFilters(`photo/expr("favorite_count >= 10")`, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newLoader := func() *twilter.Loader {
+		source := &twilter.FileSource{Path: filepath.Join("..", "..", "testdata", "tweet.js")}
+		return twilter.NewSourceLoader(source, &twilter.LoaderOption{Fallback: -1})
+	}
+
+	var buf bytes.Buffer
+	rt := &fakeRetweeter{errors: map[int64]error{
+		1096765000000000002: &twilter.ClassifiedError{Class: twilter.AlreadyRetweeted, Err: fmt.Errorf("already retweeted")},
+	}}
+	if err := replayFile(context.Background(), newLoader(), filters, &buf, rt); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var ids []int64
+	for _, line := range lines {
+		var tweet twitter.Tweet
+		if err := json.Unmarshal([]byte(line), &tweet); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, tweet.ID)
+	}
+	if fmt.Sprint(ids) != "[1096765000000000002 1096765000000000003]" || fmt.Sprint(rt.retweeted) != "[1096765000000000003]" {
+		t.Errorf("written = %v, retweeted = %v", ids, rt.retweeted)
+	}
+
+	// errors except skipped classes stop the replay.
+	rt = &fakeRetweeter{errors: map[int64]error{
+		1096765000000000002: &twilter.ClassifiedError{Class: twilter.RateLimited, Err: fmt.Errorf("rate limited")},
+	}}
+	if err := replayFile(context.Background(), newLoader(), filters, &bytes.Buffer{}, rt); err == nil || len(rt.retweeted) != 0 {
+		t.Errorf("replayFile() = %v, retweeted = %v", err, rt.retweeted)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/go-redis/redis"
+	"github.com/kawasin73/twilter"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// API versions of -api flag.
+const (
+	apiV1 = "1.1"
+	apiV2 = "2"
+)
+
+// apiVersion is the version of Twitter API to load user timelines and to retweet.
+// other APIs (lookup, lists, likes, search and streaming) are always v1.1.
+var apiVersion = apiV1
+
+// backendSource converts the source to the source of apiVersion. sources not supported by v2 are returned as they are.
+func backendSource(source twilter.Source, httpClient *http.Client) twilter.Source {
+	if s, ok := source.(*twilter.UserTimelineSource); ok && apiVersion == apiV2 {
+		return &twilter.V2UserTweetsSource{Client: twilter.NewV2Client(httpClient), UserID: s.UserID}
+	}
+	return source
+}
+
+// userOf returns the user of the user timeline source of any API version.
+func userOf(source twilter.Source) (int64, bool) {
+	switch s := source.(type) {
+	case *twilter.UserTimelineSource:
+		return s.UserID, true
+	case *twilter.V2UserTweetsSource:
+		return s.UserID, true
+	}
+	return 0, false
+}
+
+// mastodonClient is the client of the Mastodon account which boosts statuses of mastodon targets.
+// nil if Mastodon is not configured.
+var mastodonClient *twilter.MastodonClient
+
+// resolveSource creates Source of the target and returns it with the key of id store.
+func resolveSource(ctx context.Context, client *twitter.Client, redisClient *redis.Client, t *target) (twilter.Source, string, error) {
+	switch t.kind {
+	case kindHome:
+		return &twilter.HomeTimelineSource{}, kindHome, nil
+
+	case kindMentions:
+		return &twilter.MentionsSource{}, kindMentions, nil
+
+	case kindSearch:
+		return &twilter.SearchSource{Query: t.name}, kindSearch + ":" + t.name, nil
+
+	case kindFeed:
+		if u, err := url.Parse(t.name); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, "", fmt.Errorf("feed url must be http or https : %v", t.name)
+		}
+		source := &twilter.FeedSource{URL: t.name, Client: http.DefaultClient}
+		if redisClient != nil {
+			// entries without date keep their ids after restart.
+			source.IDs = &feedIdStore{client: redisClient, key: "feed-ids:" + t.name}
+		}
+		return source, kindFeed + ":" + t.name, nil
+
+	case kindList:
+		// convert owner/slug to listId not to lose checkpoint when the list is renamed.
+		idx := strings.Index(t.name, "/")
+		list, err := resolveList(ctx, client, redisClient, t.name[:idx], t.name[idx+1:])
+		if err != nil {
+			return nil, "", fmt.Errorf("convert list to listId : %v", err)
+		}
+		return &twilter.ListSource{ListID: list.ID}, kindList + ":" + strconv.FormatInt(list.ID, 10), nil
+
+	case kindMastodon:
+		if mastodonClient == nil {
+			return nil, "", fmt.Errorf("mastodon is not configured")
+		}
+		account, err := mastodonClient.LookupAccount(ctx, t.name)
+		if err != nil {
+			return nil, "", fmt.Errorf("convert acct to account id : %v", err)
+		}
+		accountId, err := strconv.ParseInt(account.ID, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("account id of %v is not number : %v", t.name, account.ID)
+		}
+		return &twilter.MastodonAccountSource{Client: mastodonClient, AccountID: accountId, Acct: t.name}, kindMastodon + ":" + account.ID, nil
+
+	case kindLikes:
+		user, err := resolveUser(ctx, client, redisClient, t.name)
+		if err != nil {
+			return nil, "", fmt.Errorf("convert screenName to userId : %v", err)
+		}
+		return &twilter.LikesSource{UserID: user.ID}, kindLikes + ":" + strconv.FormatInt(user.ID, 10), nil
+
+	default:
+		user, err := resolveUser(ctx, client, redisClient, t.name)
+		if err != nil {
+			return nil, "", fmt.Errorf("convert screenName to userId : %v", err)
+		}
+		// key is userId for compatibility
+		return &twilter.UserTimelineSource{UserID: user.ID}, strconv.FormatInt(user.ID, 10), nil
+	}
+}
+
+// showUser gets the user by screenName.
+func showUser(ctx context.Context, client *twitter.Client, screenName string) (*twitter.User, error) {
+	return lookupUser(ctx, client, &twitter.UserShowParams{ScreenName: screenName})
+}
+
+// showUserByID gets the user by userId.
+func showUserByID(ctx context.Context, client *twitter.Client, userId int64) (*twitter.User, error) {
+	return lookupUser(ctx, client, &twitter.UserShowParams{UserID: userId})
+}
+
+// lookupUser gets the user by users/show API. the error is *twilter.ClassifiedError to know the state of the user.
+func lookupUser(ctx context.Context, client *twitter.Client, params *twitter.UserShowParams) (*twitter.User, error) {
+	falseValue := false
+	params.IncludeEntities = &falseValue
+	var (
+		user *twitter.User
+		resp *http.Response
+	)
+	err := twilter.DefaultRetryPolicy.Do(ctx, func() (r *http.Response, err error) {
+		user, resp, err = client.Users.Show(params)
+		return resp, err
+	})
+
+	// twitter.APIError is not reliable when error response body format from twitter is not valid.
+	if err == nil && resp.StatusCode >= 300 {
+		err = fmt.Errorf("request to show user : %v", resp.Status)
+	}
+	if err != nil {
+		return nil, twilter.Classify(resp, err)
+	}
+	return user, nil
+}
+
+// showList gets the list by owner and slug.
+func showList(ctx context.Context, client *twitter.Client, owner, slug string) (*twitter.List, error) {
+	return lookupList(ctx, client, &twitter.ListsShowParams{OwnerScreenName: owner, Slug: slug})
+}
+
+// showListByID gets the list by listId.
+func showListByID(ctx context.Context, client *twitter.Client, listId int64) (*twitter.List, error) {
+	return lookupList(ctx, client, &twitter.ListsShowParams{ListID: listId})
+}
+
+// lookupList gets the list by lists/show API. the error is *twilter.ClassifiedError.
+func lookupList(ctx context.Context, client *twitter.Client, params *twitter.ListsShowParams) (*twitter.List, error) {
+	var (
+		list *twitter.List
+		resp *http.Response
+	)
+	err := twilter.DefaultRetryPolicy.Do(ctx, func() (r *http.Response, err error) {
+		list, resp, err = client.Lists.Show(params)
+		return resp, err
+	})
+
+	// twitter.APIError is not reliable when error response body format from twitter is not valid.
+	if err == nil && resp.StatusCode >= 300 {
+		err = fmt.Errorf("request to show list : %v", resp.Status)
+	}
+	if err != nil {
+		return nil, twilter.Classify(resp, err)
+	}
+	return list, nil
+}
+
+// resolveUser resolves screenName given by a target to the user.
+// the resolved userId is stored, and the user is read by the id after that. so the target stays the same account
+// even if the account changes its screen name and another account takes the old screen name.
+func resolveUser(ctx context.Context, client *twitter.Client, redisClient *redis.Client, screenName string) (*twitter.User, error) {
+	store, err := createIdStore(redisClient, "resolved:user:"+strings.ToLower(screenName))
+	if err != nil {
+		return nil, fmt.Errorf("create id store : %v", err)
+	}
+	if userId := store.get(); userId != 0 {
+		// renames are reported by Task.refresh
+		return showUserByID(ctx, client, userId)
+	}
+
+	user, err := showUser(ctx, client, screenName)
+	if err != nil {
+		return nil, err
+	}
+	if err = store.update(user.ID); err != nil {
+		log.Println("failed to save resolved id :", err)
+	}
+	return user, nil
+}
+
+// resolveList resolves owner/slug given by a target to the list. the resolved listId is stored like resolveUser.
+func resolveList(ctx context.Context, client *twitter.Client, redisClient *redis.Client, owner, slug string) (*twitter.List, error) {
+	name := owner + "/" + slug
+	store, err := createIdStore(redisClient, "resolved:list:"+strings.ToLower(name))
+	if err != nil {
+		return nil, fmt.Errorf("create id store : %v", err)
+	}
+	if listId := store.get(); listId != 0 {
+		list, err := showListByID(ctx, client, listId)
+		if err != nil {
+			return nil, err
+		}
+		if list.User != nil && !strings.EqualFold(list.User.ScreenName+"/"+list.Slug, name) {
+			log.Printf("list %v (%d) is renamed to %v/%v\n", name, listId, list.User.ScreenName, list.Slug)
+		}
+		return list, nil
+	}
+
+	list, err := showList(ctx, client, owner, slug)
+	if err != nil {
+		return nil, err
+	}
+	if err = store.update(list.ID); err != nil {
+		log.Println("failed to save resolved id :", err)
+	}
+	return list, nil
+}
+
+// listMembers gets ids of all members of the list.
+func listMembers(ctx context.Context, client *twitter.Client, listId int64) ([]int64, error) {
+	var (
+		ids       []int64
+		cursor    int64 = -1
+		trueValue       = true
+	)
+	for cursor != 0 {
+		var (
+			members *twitter.Members
+			resp    *http.Response
+		)
+		err := twilter.DefaultRetryPolicy.Do(ctx, func() (r *http.Response, err error) {
+			members, resp, err = client.Lists.Members(&twitter.ListsMembersParams{
+				ListID:     listId,
+				Count:      5000,
+				Cursor:     cursor,
+				SkipStatus: &trueValue,
+			})
+			return resp, err
+		})
+
+		// twitter.APIError is not reliable when error response body format from twitter is not valid.
+		if err == nil && resp.StatusCode >= 300 {
+			err = fmt.Errorf("request to list members : %v", resp.Status)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, u := range members.Users {
+			ids = append(ids, u.ID)
+		}
+		cursor = members.NextCursor
+	}
+	return ids, nil
+}
+
+// friendIds gets ids of all users followed by the user.
+func friendIds(ctx context.Context, client *twitter.Client, userId int64) ([]int64, error) {
+	var (
+		ids    []int64
+		cursor int64 = -1
+	)
+	for cursor != 0 {
+		var (
+			friends *twitter.FriendIDs
+			resp    *http.Response
+		)
+		err := twilter.DefaultRetryPolicy.Do(ctx, func() (r *http.Response, err error) {
+			friends, resp, err = client.Friends.IDs(&twitter.FriendIDParams{
+				UserID: userId,
+				Count:  5000,
+				Cursor: cursor,
+			})
+			return resp, err
+		})
+
+		// twitter.APIError is not reliable when error response body format from twitter is not valid.
+		if err == nil && resp.StatusCode >= 300 {
+			err = fmt.Errorf("request to friend ids : %v", resp.Status)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, friends.IDs...)
+		cursor = friends.NextCursor
+	}
+	return ids, nil
+}
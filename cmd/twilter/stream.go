@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/kawasin73/twilter"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// runStream receives tweets of users from streaming API and dispatches them to the tasks of the users.
+// tasks are executed by polling on each connection to load tweets posted while disconnected.
+// tasks run in their own goroutines added to wg, so the stream is read while the gap is filled.
+func runStream(ctx context.Context, wg *sync.WaitGroup, httpClient *http.Client, tasks map[int64]*Task, option *twilter.StreamOption) {
+	follow := make([]int64, 0, len(tasks))
+	workers := make(map[int64]*streamWorker, len(tasks))
+	for userId, task := range tasks {
+		follow = append(follow, userId)
+		w := &streamWorker{task: task, wake: make(chan struct{}, 1)}
+		workers[userId] = w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run(ctx)
+		}()
+	}
+	stream := twilter.NewFilterStream(httpClient, follow, option)
+
+	onConnect := func() {
+		log.Printf("stream connected. fill the gap of %d users\n", len(tasks))
+		for _, w := range workers {
+			w.push(nil)
+		}
+	}
+
+	onTweet := func(tweet *twitter.Tweet) {
+		// statuses/filter also delivers retweets and replies of the users' tweets by other users.
+		if tweet.User == nil {
+			return
+		}
+		if w, ok := workers[tweet.User.ID]; ok {
+			w.push(tweet)
+		}
+	}
+
+	if err := stream.Run(ctx, onConnect, onTweet); err != nil && err != context.Canceled {
+		log.Println("failed to stream :", err)
+	}
+}
+
+// streamWorker executes the task and handles tweets of the task in order without blocking the stream.
+// gap fills requested while a gap fill is waiting are executed once.
+type streamWorker struct {
+	task   *Task
+	mu     sync.Mutex
+	fill   bool
+	tweets []*twitter.Tweet
+	wake   chan struct{}
+}
+
+// push queues the tweet. nil requests to fill the gap.
+func (w *streamWorker) push(tweet *twitter.Tweet) {
+	w.mu.Lock()
+	if tweet == nil {
+		w.fill = true
+	} else {
+		w.tweets = append(w.tweets, tweet)
+	}
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run executes queued gap fills and tweets until ctx is done.
+// the gap is filled before queued tweets which are skipped by the checkpoint if loaded by the gap fill.
+// a failed gap fill is retried after the interval of the task and checkpoints are not saved by tweets until it succeeds.
+func (w *streamWorker) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		}
+		w.mu.Lock()
+		fill, tweets := w.fill, w.tweets
+		w.fill, w.tweets = false, nil
+		w.mu.Unlock()
+
+		if fill && !w.task.fillGap(ctx) {
+			time.AfterFunc(w.task.interval, func() {
+				w.push(nil)
+			})
+		}
+		for _, tweet := range tweets {
+			w.task.Handle(ctx, tweet)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"github.com/dghubble/go-twitter/twitter"
+	"testing"
+	"time"
+)
+
+func TestStreamWorker(t *testing.T) {
+	server, task, closeFn := setupFakeTask(t)
+	defer closeFn()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ids := postTweets(server, true, true)
+
+	w := &streamWorker{task: task, wake: make(chan struct{}, 1)}
+	go w.run(ctx)
+
+	// the stream is not blocked while the task is running.
+	task.mu.Lock()
+	done := make(chan struct{})
+	go func() {
+		w.push(nil)
+		w.push(&twitter.Tweet{ID: ids[0], User: &twitter.User{ID: 10}})
+		w.push(nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("push is blocked by the running task")
+	}
+	task.mu.Unlock()
+
+	// the gap is filled and the tweet loaded by the gap fill is not retweeted twice.
+	deadline := time.Now().Add(time.Second)
+	for len(server.Retweeted()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if retweeted := server.Retweeted(); len(retweeted) != 2 || retweeted[0] != ids[0] || retweeted[1] != ids[1] {
+		t.Errorf("retweeted = %v", retweeted)
+	}
+}
@@ -9,65 +9,91 @@ import (
 	"github.com/kawasin73/htask"
 	"github.com/kawasin73/twilter"
 	"log"
+	"sync"
 	"time"
 )
 
+// backfillGaps enables to backfill gaps of tweets by search API.
+var backfillGaps bool
+
 type Task struct {
+	// mu serializes Exec and Handle not to retweet the same tweet twice and to keep the checkpoint consistent.
+	mu          sync.Mutex
 	oauthConfig *oauth1.Config
 	oauthToken  *oauth1.Token
+	selfId      int64
 	loader      *twilter.Loader
 	idStore     *idStore
 	filters     []twilter.Filter
 	interval    time.Duration
 	timeout     time.Duration
+	// pausedUntil is the time until which the task is paused by errorPolicy.
+	pausedUntil time.Time
+	// retryId is the id of the oldest tweet which failed to be retweeted.
+	// the checkpoint is kept below it until Exec loads it again, so tweets handled later do not skip it.
+	retryId int64
+	// gapPending is set while tweets posted during the stream disconnection are not loaded by Exec.
+	// Handle does not save checkpoints while it is set not to skip the tweets.
+	gapPending bool
+	state      targetState
+	// userId and screenName are the user of the target given by screen name. userId is 0 for other targets.
+	userId      int64
+	screenName  string
+	refreshedAt time.Time
+}
+
+func setupTask(ctx context.Context, config *oauth1.Config, token *oauth1.Token, selfId int64, redisClient *redis.Client, t *target, interval, timeout, fallback time.Duration) (*Task, error) {
+	// create source of the target
+	httpClient := oauthClient(ctx, config, token)
+	source, key, err := resolveSource(ctx, twitter.NewClient(httpClient), redisClient, t)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %v : %v", t.key(), err)
+	}
+	source = backendSource(source, httpClient)
+
+	// search API can not search tweets older than SearchWindow.
+	if t.kind == kindSearch {
+		fallback = twilter.SearchWindow
+	}
+
+	task, err := setupSourceTask(config, token, selfId, redisClient, source, key, t.filters, interval, timeout, t.loaderOption(fallback))
+	if err != nil {
+		return nil, err
+	}
+
+	// users given by screen name are re-read by id to follow renames.
+	switch source := source.(type) {
+	case *twilter.UserTimelineSource:
+		task.userId, task.screenName = source.UserID, t.name
+	case *twilter.V2UserTweetsSource:
+		task.userId, task.screenName = source.UserID, t.name
+	case *twilter.LikesSource:
+		task.userId, task.screenName = source.UserID, t.name
+	case *twilter.MastodonAccountSource:
+		// skip own statuses of the Mastodon account.
+		task.selfId = mastodonSelfId
+	}
+	return task, nil
 }
 
-func setupTask(ctx context.Context, config *oauth1.Config, token *oauth1.Token, redisClient *redis.Client, t *target, interval, timeout, fallback time.Duration) (*Task, error) {
+// setupSourceTask creates Task of the source. key is the key of id store.
+func setupSourceTask(config *oauth1.Config, token *oauth1.Token, selfId int64, redisClient *redis.Client, source twilter.Source, key string, filters []twilter.Filter, interval, timeout time.Duration, option *twilter.LoaderOption) (*Task, error) {
 	// initialize task
 	task := &Task{
 		oauthConfig: config,
 		oauthToken:  token,
-		filters:     t.filters,
+		selfId:      selfId,
+		filters:     filters,
 		interval:    interval,
 		timeout:     timeout,
+		state:       stateActive,
 	}
 
-	// convert screenName to userId
-	falseValue := false
-	twitterClient := task.twitterClient(ctx)
-retry:
-	user, resp, err := twitterClient.Users.Show(&twitter.UserShowParams{
-		ScreenName:      t.screenName,
-		IncludeEntities: &falseValue,
-	})
-
-	// check rate limited
-	if limited, sleep := twilter.IsRateLimit(resp); limited {
-		timer := time.NewTimer(sleep)
-		select {
-		case <-timer.C:
-			// sleep and retry
-			goto retry
-		case <-ctx.Done():
-			timer.Stop()
-			return nil, ctx.Err()
-		}
-	}
-
-	// twitter.APIError is not reliable when error response body format from twitter is not valid.
-	if err == nil && resp.StatusCode >= 300 {
-		err = fmt.Errorf("request to show user : %v", resp.Status)
-	}
-	if err != nil {
-		return nil, fmt.Errorf("convert screenName to userId : %v", err)
-	}
-	targetId := user.ID
-
 	// create loader
-	task.loader = twilter.NewLoader(targetId, &twilter.LoaderOption{Fallback: fallback})
+	task.loader = twilter.NewSourceLoader(source, option)
 
 	// load latestId from Redis
-	is, err := createIdStore(redisClient, targetId)
+	is, err := createIdStore(redisClient, key)
 	if err != nil {
 		return nil, fmt.Errorf("create id store : %v", err)
 	}
@@ -77,7 +103,12 @@ retry:
 }
 
 func (t *Task) Start(ctx context.Context, sche *htask.Scheduler) error {
-	return sche.Set(ctx.Done(), time.Now(), t.buildTask(ctx, sche))
+	return t.StartAt(ctx, sche, time.Now())
+}
+
+// StartAt starts the task at the time. the task stops when ctx is done.
+func (t *Task) StartAt(ctx context.Context, sche *htask.Scheduler, at time.Time) error {
+	return sche.Set(ctx.Done(), at, t.buildTask(ctx, sche))
 }
 
 func (t *Task) buildTask(ctx context.Context, sche *htask.Scheduler) func(_ time.Time) {
@@ -91,12 +122,19 @@ func (t *Task) buildTask(ctx context.Context, sche *htask.Scheduler) func(_ time
 
 // twitterClient create new twitter.Client
 func (t *Task) twitterClient(ctx context.Context) *twitter.Client {
-	httpClient := t.oauthConfig.Client(ctx, t.oauthToken)
+	httpClient := oauthClient(ctx, t.oauthConfig, t.oauthToken)
 	return twitter.NewClient(httpClient)
 }
 
 // Exec executes task. load and filter tweets and retweet filtered tweets.
 func (t *Task) Exec(ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if time.Now().Before(t.pausedUntil) {
+		return
+	}
+
 	log.Println("start loading...")
 	// set timeout to context
 	tctx, cancel := context.WithDeadline(ctx, time.Now().Add(t.timeout))
@@ -104,103 +142,250 @@ func (t *Task) Exec(ctx context.Context) {
 
 	// setup twitter client
 	client := t.twitterClient(tctx)
+	rt := t.retweeter(tctx, client)
 
-	// load tweets
-	tweets, latest, err := t.loader.Load(tctx, client, t.idStore.get(), t.filters)
-	if err != nil {
-		log.Println("failed to load tweets :", err)
+	if t.userId != 0 && time.Since(t.refreshedAt) >= refreshInterval && !t.refresh(tctx, client) {
 		return
 	}
-	log.Printf("load %d items\n", len(tweets))
-
-	// retweet tweets
-	var trueValue = true
-	for i := len(tweets) - 1; i >= 0; i-- {
-		tw := &tweets[i]
-
-		if tw.Retweeted {
-			// if already retweeted then unretweet and retweet again.
-			// TODO: handle rate limit error
-			log.Printf("tweet (%d) is already retweeted. so unretweet.\n", tw.ID)
-
-		retryUnretweet:
-			_, resp, err := client.Statuses.Unretweet(tw.ID, &twitter.StatusUnretweetParams{
-				TrimUser: &trueValue,
-			})
-
-			// check rate limited
-			if limited, sleep := twilter.IsRateLimit(resp); limited {
-				timer := time.NewTimer(sleep)
-				select {
-				case <-timer.C:
-					// sleep and retry
-					goto retryUnretweet
-				case <-ctx.Done():
-					timer.Stop()
-					log.Println("unretweet timeout")
-					return
-				}
-			}
 
-			// twitter.APIError is not reliable when error response body format from twitter is not valid.
-			if err == nil && resp.StatusCode >= 300 {
-				err = fmt.Errorf("request to unretweet : %v", resp.Status)
-			}
-			// even if the tweet is not retweeted, no error occurs.
-			if err != nil {
-				log.Println("failed to unretweet :", err)
-				return
-			}
+	// load and retweet tweets oldest first
+	it := t.loader.Stream(tctx, client, t.idStore.get(), t.filters)
+	defer func() {
+		// report statistics even if retweet failed
+		stats := it.Stats()
+		logLoadStats(t.loader.Source(), t.filters, &stats)
+		recordLoadStats(t.loader.Source(), &stats)
+	}()
+	next := it.Next()
+	if gap := it.Gap(); gap != nil {
+		// tweets in the gap are older than loaded tweets.
+		t.handleGap(tctx, client, rt, gap)
+	}
+	for ; next; next = it.Next() {
+		tw := it.Tweet()
+
+		if tw.User != nil && tw.User.ID == t.selfId {
+			// skip own tweets and retweets in home timeline not to retweet them again.
+			continue
 		}
 
-		// retweet
-	retryRetweet:
-		_, resp, err := client.Statuses.Retweet(tw.ID, &twitter.StatusRetweetParams{
-			TrimUser: &trueValue,
-		})
-
-		// check rate limited
-		if limited, sleep := twilter.IsRateLimit(resp); limited {
-			timer := time.NewTimer(sleep)
-			select {
-			case <-timer.C:
-				// sleep and retry
-				goto retryRetweet
-			case <-ctx.Done():
-				timer.Stop()
-				log.Println("retweet timeout")
-				return
-			}
+		if t.retryId != 0 && tw.ID >= t.retryId {
+			// the failed tweet is loaded again by this Exec.
+			t.retryId = 0
 		}
+		if !t.retweet(ctx, rt, tw) {
+			return
+		}
+	}
+	if ferr, ok := it.Err().(*twilter.FilterError); ok {
+		// retweet tweets older than the failed tweet and retry the failed tweet next time.
+		log.Println("failed to filter tweets :", ferr)
+	} else if err := it.Err(); err != nil {
+		log.Println("failed to load tweets :", err)
+		if state, ok := stateOf(err); ok {
+			t.setState(state)
+		}
+		t.handleError(err)
+		return
+	}
+	t.setState(stateActive)
 
-		// twitter.APIError is not reliable when error response body format from twitter is not valid.
-		if err == nil && resp.StatusCode >= 300 {
-			err = fmt.Errorf("request to retweet : %v", resp.Status)
+	// update latestId
+	checkpoint := it.Checkpoint()
+	if t.retryId != 0 && checkpoint >= t.retryId {
+		// the failed tweet is deleted or not matched any more.
+		t.retryId = 0
+	}
+	t.saveCheckpoint(checkpoint)
+	if it.Err() == nil {
+		// all tweets since the checkpoint are loaded.
+		t.gapPending = false
+	}
+}
+
+// fillGap executes the task to load tweets posted while the stream is disconnected. returns false if the gap is not filled.
+func (t *Task) fillGap(ctx context.Context) bool {
+	t.mu.Lock()
+	t.gapPending = true
+	t.mu.Unlock()
+
+	t.Exec(ctx)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !t.gapPending
+}
+
+// saveCheckpoint updates latestId to id if it is newer. latestId is not updated to retryId or newer,
+// and not to retryId - 1 either because checkpoints must be ids of loaded tweets to detect gaps.
+func (t *Task) saveCheckpoint(id int64) {
+	if t.retryId != 0 && id >= t.retryId {
+		return
+	}
+	if id <= t.idStore.get() {
+		return
+	}
+	if err := t.idStore.update(id); err != nil {
+		log.Println("failed to save latest id :", err)
+	}
+}
+
+// handleGap reports the gap of tweets not loaded and retweets tweets in the gap found by search API if backfillGaps is set.
+// search API finds only tweets of the last 7 days.
+func (t *Task) handleGap(ctx context.Context, client *twitter.Client, rt twilter.Retweeter, gap *twilter.GapError) {
+	source := t.loader.Source()
+	log.Printf("%v : %v\n", source, gap)
+	gapMetrics.Add(source.String(), 1)
+
+	if !backfillGaps {
+		return
+	}
+	userId, ok := userOf(source)
+	if !ok {
+		log.Printf("%v : backfill is supported only for user targets\n", source)
+		return
+	}
+	user, err := userCache.Get(twilter.WithClient(ctx, client), userId)
+	if err != nil || user == nil {
+		log.Printf("%v : failed to get screenName to backfill : %v\n", source, err)
+		return
+	}
+
+	loader := twilter.NewSourceLoader(&twilter.SearchSource{Query: "from:" + user.ScreenName}, nil)
+	count := 0
+	it := loader.Stream(ctx, client, gap.SinceID, t.filters)
+	for it.Next() {
+		tw := it.Tweet()
+		if tw.ID >= gap.MaxID {
+			// loaded by the timeline
+			break
+		}
+		if !t.retweet(ctx, rt, tw) {
+			return
 		}
+		count++
+	}
+	if err := it.Err(); err != nil {
+		log.Printf("%v : failed to backfill : %v\n", source, err)
+	}
+	log.Printf("%v : backfill %d items by search\n", source, count)
+}
+
+// Handle filters the tweet received from streaming API and retweets it if matched.
+// the tweet is ignored if it is older than the checkpoint because it is already loaded by Exec.
+// if the retweet fails, the checkpoint is kept below the tweet and Exec retries it.
+func (t *Task) Handle(ctx context.Context, tweet *twitter.Tweet) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if tweet.ID <= t.idStore.get() || !t.loader.Accepts(tweet) || time.Now().Before(t.pausedUntil) {
+		// excluded retweets and replies and tweets out of since and until are skipped like Exec.
+		return
+	}
+
+	// set timeout to context
+	tctx, cancel := context.WithDeadline(ctx, time.Now().Add(t.timeout))
+	defer cancel()
+
+	// setup twitter client
+	client := t.twitterClient(tctx)
+	tctx = twilter.WithClient(tctx, client)
+
+	// filter the tweet
+	if err := twilter.PrepareFilters(tctx, t.filters, []twitter.Tweet{*tweet}); err != nil {
+		log.Println("failed to prepare filters :", err)
+		return
+	}
+	matched := false
+	for _, filter := range t.filters {
+		ok, err := twilter.MatchContext(tctx, filter, tweet)
 		if err != nil {
-			if twilter.IsAlreadyRetweeted(err) || twilter.IsRetweetNotPermitted(err) {
-				// retweet failed. but skip this tweet.
-				log.Println("retweet failed :", err)
-				log.Println("skip to retweet :", tw.ID)
-			} else {
-				log.Println("failed to retweet :", err)
-				return
-			}
-		} else {
-			log.Println("retweeted :", tw.ID)
-			log.Println("text      :", tw.Text)
+			log.Println("failed to filter tweet :", &twilter.FilterError{TweetID: tweet.ID, Filter: filter, Err: err})
+			return
+		} else if ok {
+			matched = true
+			break
 		}
+	}
 
-		// update latestId
-		if err = t.idStore.update(tw.ID); err != nil {
-			log.Println("failed to save latest id :", err)
+	if t.gapPending {
+		// the gap fill loads tweets since the checkpoint including this tweet again.
+		if matched {
+			t.tryRetweet(ctx, t.retweeter(tctx, client), tweet)
 		}
+		return
+	}
+	if matched {
+		t.retweet(ctx, t.retweeter(tctx, client), tweet)
+	} else {
+		t.saveCheckpoint(tweet.ID)
 	}
+}
 
-	// update latestId
-	if latest != nil {
-		if err = t.idStore.update(latest.ID); err != nil {
-			log.Println("failed to save latest id :", err)
+// retweeter creates Retweeter of the API version of the deployment. statuses of Mastodon are boosted by the Mastodon account
+// and entries of feeds are posted as link tweets by the dummy account.
+func (t *Task) retweeter(ctx context.Context, client *twitter.Client) twilter.Retweeter {
+	switch source := t.loader.Source().(type) {
+	case *twilter.MastodonAccountSource:
+		return twilter.NewMastodonBooster(source.Client)
+	case *twilter.FeedSource:
+		return twilter.NewFeedPoster(client, source)
+	}
+	if apiVersion == apiV2 {
+		return twilter.NewV2Retweeter(twilter.NewV2Client(oauthClient(ctx, t.oauthConfig, t.oauthToken)), t.selfId)
+	}
+	return twilter.NewRetweeter(client)
+}
+
+// retweet retweets the tweet and updates latestId. returns false if the tweet should be retried later.
+func (t *Task) retweet(ctx context.Context, rt twilter.Retweeter, tw *twitter.Tweet) bool {
+	if !t.tryRetweet(ctx, rt, tw) {
+		if t.retryId == 0 || tw.ID < t.retryId {
+			t.retryId = tw.ID
+		}
+		return false
+	}
+	t.saveCheckpoint(tw.ID)
+	return true
+}
+
+// tryRetweet retweets the tweet. returns false if the tweet should be retried later.
+func (t *Task) tryRetweet(ctx context.Context, rt twilter.Retweeter, tw *twitter.Tweet) bool {
+	if tw.Retweeted {
+		// if already retweeted then unretweet and retweet again.
+		log.Printf("tweet (%d) is already retweeted. so unretweet.\n", tw.ID)
+
+		err := rt.Unretweet(ctx, tw.ID)
+		if err != nil && err == ctx.Err() {
+			log.Println("unretweet timeout")
+			return false
+		}
+		if err != nil {
+			log.Println("failed to unretweet :", err)
+			if t.handleError(err) != actionSkip {
+				return false
+			}
+		}
+	}
+
+	// retweet
+	err := rt.Retweet(ctx, tw.ID)
+	if err != nil && err == ctx.Err() {
+		log.Println("retweet timeout")
+		return false
+	}
+	if err != nil {
+		if t.handleError(err) == actionSkip {
+			// retweet failed. but skip this tweet (already retweeted, not permitted or deleted).
+			log.Println("retweet failed :", err)
+			log.Println("skip to retweet :", tw.ID)
+		} else {
+			log.Println("failed to retweet :", err)
+			return false
 		}
+	} else {
+		log.Println("retweeted :", tw.ID)
+		log.Println("text      :", tw.Text)
 	}
+	return true
 }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/dghubble/oauth1"
+	"github.com/kawasin73/twilter"
+	"github.com/kawasin73/twilter/twittertest"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// setupFakeTask starts the fake Twitter API and sets up the task of the user target @alice which retweets photos.
+// requests of the daemon are sent to the fake server until closed by the returned function.
+func setupFakeTask(t *testing.T) (*twittertest.Server, *Task, func()) {
+	server := twittertest.NewServer()
+	server.SetSelf(twitter.User{ID: 1, ScreenName: "dummy"})
+	server.AddUser(twitter.User{ID: 10, ScreenName: "alice"})
+
+	limiter := rateLimiter
+	rateLimiter = twilter.NewRateLimiter(server.Transport())
+	closeFn := func() {
+		rateLimiter = limiter
+		server.Close()
+	}
+
+	config, token := oauth1.NewConfig("key", "secret"), oauth1.NewToken("token", "secret")
+	ctx := context.Background()
+	self, err := checkTwitterCredentials(ctx, config, token)
+	if err != nil {
+		closeFn()
+		t.Fatal(err)
+	}
+	target := &target{kind: kindUser, name: "alice", filters: []twilter.Filter{twilter.PhotoFilter{}}}
+	task, err := setupTask(ctx, config, token, self.ID, nil, target, time.Minute, 5*time.Second, time.Hour)
+	if err != nil {
+		closeFn()
+		t.Fatal(err)
+	}
+	return server, task, closeFn
+}
+
+// postTweets adds tweets of @alice posted now. tweets of true are photos.
+func postTweets(server *twittertest.Server, photos ...bool) []int64 {
+	var ids []int64
+	for _, photo := range photos {
+		now := time.Now()
+		tweet := twitter.Tweet{
+			ID:        twilter.SnowflakeID(now) + int64(len(ids)),
+			CreatedAt: now.UTC().Format(time.RubyDate),
+			Text:      fmt.Sprintf("tweet %d", len(ids)),
+			User:      &twitter.User{ID: 10},
+		}
+		if photo {
+			tweet.ExtendedEntities = &twitter.ExtendedEntity{Media: []twitter.MediaEntity{{Type: "photo"}}}
+		}
+		server.AddTweets(tweet)
+		ids = append(ids, tweet.ID)
+	}
+	return ids
+}
+
+func TestTaskExec(t *testing.T) {
+	server, task, closeFn := setupFakeTask(t)
+	defer closeFn()
+	ctx := context.Background()
+
+	ids := postTweets(server, true, false, true)
+	task.Exec(ctx)
+	if retweeted := server.Retweeted(); fmt.Sprint(retweeted) != fmt.Sprint([]int64{ids[0], ids[2]}) {
+		t.Errorf("retweeted = %v, expected %v", retweeted, ids)
+	}
+	if task.idStore.get() != ids[2] {
+		t.Errorf("checkpoint = %v, expected %v", task.idStore.get(), ids[2])
+	}
+
+	// the next run starts from the checkpoint. deleted and already retweeted tweets are skipped.
+	ids = postTweets(server, true, true, true)
+	server.DeleteTweet(ids[0])
+	server.Inject(twittertest.Error(twittertest.RetweetPath+fmt.Sprint(ids[1])+".json", http.StatusForbidden, 327, "You have already retweeted this Tweet."))
+	task.Exec(ctx)
+	if retweeted := server.Retweeted(); len(retweeted) != 3 || retweeted[2] != ids[2] {
+		t.Errorf("retweeted = %v", retweeted)
+	}
+	if task.idStore.get() != ids[2] {
+		t.Errorf("checkpoint = %v, expected %v", task.idStore.get(), ids[2])
+	}
+}
+
+func TestTaskExecFaults(t *testing.T) {
+	server, task, closeFn := setupFakeTask(t)
+	defer closeFn()
+	ctx := context.Background()
+	ids := postTweets(server, true)
+
+	// invalid token stops the process and the tweet is retried next time.
+	server.Inject(twittertest.Error(twittertest.RetweetPath+fmt.Sprint(ids[0])+".json", http.StatusUnauthorized, 89, "Invalid or expired token."))
+	task.Exec(ctx)
+	select {
+	case err := <-chFatal:
+		if cerr, ok := err.(*twilter.ClassifiedError); !ok || cerr.Class != twilter.AuthInvalid {
+			t.Errorf("fatal error = %v", err)
+		}
+	default:
+		t.Errorf("the process is not stopped")
+	}
+	if len(server.Retweeted()) != 0 || task.idStore.get() != 0 {
+		t.Errorf("retweeted = %v, checkpoint = %v", server.Retweeted(), task.idStore.get())
+	}
+	task.Exec(ctx)
+	if retweeted := server.Retweeted(); len(retweeted) != 1 || task.idStore.get() != ids[0] {
+		t.Errorf("retweeted = %v, checkpoint = %v", retweeted, task.idStore.get())
+	}
+
+	// rate limit of the timeline pauses the task until reset.
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	server.Inject(twittertest.RateLimited(twittertest.UserTimelinePath, reset))
+	task.Exec(ctx)
+	if !task.pausedUntil.Equal(reset) {
+		t.Errorf("pausedUntil = %v, expected %v", task.pausedUntil, reset)
+	}
+}
+
+func TestTaskHandle(t *testing.T) {
+	server, task, closeFn := setupFakeTask(t)
+	defer closeFn()
+	ctx := context.Background()
+	ids := postTweets(server, true, false, true)
+	photo := &twitter.ExtendedEntity{Media: []twitter.MediaEntity{{Type: "photo"}}}
+
+	// the failed retweet keeps the checkpoint while later tweets are handled. retryId - 1 is not a loaded tweet.
+	checkpoint := task.idStore.get()
+	server.Inject(twittertest.Error(twittertest.RetweetPath+fmt.Sprint(ids[0])+".json", http.StatusUnauthorized, 89, "Invalid or expired token."))
+	task.Handle(ctx, &twitter.Tweet{ID: ids[0], User: &twitter.User{ID: 10}, ExtendedEntities: photo})
+	<-chFatal
+	task.Handle(ctx, &twitter.Tweet{ID: ids[1], User: &twitter.User{ID: 10}})
+	task.Handle(ctx, &twitter.Tweet{ID: ids[2], User: &twitter.User{ID: 10}, ExtendedEntities: photo})
+	if retweeted := server.Retweeted(); fmt.Sprint(retweeted) != fmt.Sprint([]int64{ids[2]}) || task.idStore.get() != checkpoint {
+		t.Errorf("retweeted = %v, checkpoint = %v", retweeted, task.idStore.get())
+	}
+
+	// Exec retries the failed tweet. the retweeted tweet is loaded again too and retweeted again after unretweet.
+	task.Exec(ctx)
+	if retweeted := server.Retweeted(); len(retweeted) != 3 || retweeted[1] != ids[0] || task.idStore.get() != ids[2] {
+		t.Errorf("retweeted = %v, checkpoint = %v", retweeted, task.idStore.get())
+	}
+}
+
+func TestTaskHandleGapPending(t *testing.T) {
+	server, task, closeFn := setupFakeTask(t)
+	defer closeFn()
+	ctx := context.Background()
+	ids := postTweets(server, true, true)
+	photo := &twitter.ExtendedEntity{Media: []twitter.MediaEntity{{Type: "photo"}}}
+
+	// tweets are retweeted without advancing the checkpoint over the gap not filled.
+	task.gapPending = true
+	task.Handle(ctx, &twitter.Tweet{ID: ids[1], User: &twitter.User{ID: 10}, ExtendedEntities: photo})
+	if retweeted := server.Retweeted(); fmt.Sprint(retweeted) != fmt.Sprint([]int64{ids[1]}) || task.idStore.get() != 0 {
+		t.Errorf("retweeted = %v, checkpoint = %v", retweeted, task.idStore.get())
+	}
+
+	// the gap fill loads the tweet in the gap.
+	if !task.fillGap(ctx) || task.gapPending {
+		t.Error("the gap is not filled")
+	}
+	if retweeted := server.Retweeted(); len(retweeted) != 3 || retweeted[1] != ids[0] || task.idStore.get() != ids[1] {
+		t.Errorf("retweeted = %v, checkpoint = %v", retweeted, task.idStore.get())
+	}
+
+	// replies excluded by the target are skipped.
+	excludeReplies := true
+	task.loader = twilter.NewSourceLoader(task.loader.Source(), &twilter.LoaderOption{ExcludeReplies: &excludeReplies})
+	ids = postTweets(server, true)
+	task.Handle(ctx, &twitter.Tweet{ID: ids[0], User: &twitter.User{ID: 10}, InReplyToStatusID: 1, ExtendedEntities: photo})
+	if retweeted := server.Retweeted(); len(retweeted) != 3 || task.idStore.get() == ids[0] {
+		t.Errorf("retweeted = %v, checkpoint = %v", retweeted, task.idStore.get())
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/kawasin73/twilter"
+	"log"
+	"os"
+)
+
+// example is a line of labelled tweets file. either text or tweet is required.
+type example struct {
+	Label string         `json:"label"`
+	Text  string         `json:"text"`
+	Tweet *twitter.Tweet `json:"tweet"`
+}
+
+// train trains the model with the example. the text of tweet is the same text as classifier filter classifies.
+func (e *example) train(model *twilter.Classifier, isPositive bool) {
+	if e.Text != "" || e.Tweet == nil {
+		model.Add(e.Text, isPositive)
+	} else {
+		model.AddTweet(e.Tweet, isPositive)
+	}
+}
+
+// runTrain runs train subcommand which builds the model of classifier filter from labelled tweets files.
+func runTrain(args []string) error {
+	fs := flag.NewFlagSet("train", flag.ExitOnError)
+	flagPositive := fs.String("positive", "positive", "label of positive examples. other labels are negative")
+	flagOutput := fs.String("o", "model.json", "output model file")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: twilter train [options] <labelled tweets file (JSONL)>...")
+		fmt.Fprintln(fs.Output(), "  each line is {\"label\": \"<label>\", \"text\": \"<text>\"} or {\"label\": \"<label>\", \"tweet\": <tweet object>}")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no labelled tweets file")
+	}
+
+	model := twilter.NewClassifier()
+	for _, path := range fs.Args() {
+		if err := trainFile(model, path, *flagPositive); err != nil {
+			return fmt.Errorf("train %v : %v", path, err)
+		}
+	}
+	positive, negative := model.Docs[twilter.Positive], model.Docs[twilter.Negative]
+	if positive == 0 || negative == 0 {
+		return fmt.Errorf("both positive and negative examples are required : %d positive, %d negative", positive, negative)
+	}
+
+	// save model
+	file, err := os.Create(*flagOutput)
+	if err != nil {
+		return err
+	}
+	if err = model.Save(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	log.Printf("trained %d positive and %d negative examples (%d words) into %v\n", positive, negative, len(model.Words), *flagOutput)
+	return nil
+}
+
+func trainFile(model *twilter.Classifier, path string, positiveLabel string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// a line can be a large tweet object
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e example
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("line %d : %v", line, err)
+		}
+		e.train(model, e.Label == positiveLabel)
+	}
+	return scanner.Err()
+}
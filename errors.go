@@ -1,44 +1,256 @@
 package twilter
 
 import (
+	"fmt"
 	"github.com/dghubble/go-twitter/twitter"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 )
 
 // https://developer.twitter.com/en/docs/basics/response-codes.html
 const (
+	codeNoUserMatches       = 17
+	codeCouldNotAuth        = 32
+	codePageNotExist        = 34
+	codeUserNotFound        = 50
+	codeUserSuspended       = 63
+	codeRateLimitExceeded   = 88
+	codeInvalidToken        = 89
+	codeOverCapacity        = 130
+	codeInternalError       = 131
+	codeBlocked             = 136
+	codeStatusNotFound      = 144
+	codeNotAuthorized       = 179
+	codeOverDailyLimit      = 185
+	codeDuplicateStatus     = 187
+	codeBadAuthData         = 215
+	codeAccountLocked       = 326
 	codeAlreadyRetweeted    = 327
 	codeRetweetNotPermitted = 328
+	codeTweetUnavailable    = 421
+	codeTweetViolated       = 422
 )
 
-// IsAlreadyRetweeted checks the error is "already retweeted" error
-func IsAlreadyRetweeted(err error) bool {
-	if apierr, ok := err.(*twitter.APIError); ok {
-		for _, e := range apierr.Errors {
-			if e.Code == codeAlreadyRetweeted {
-				return true
+// ErrorClass is the class of errors of Twitter API.
+type ErrorClass int
+
+// classes of errors
+const (
+	// Unknown is the error which is not classified.
+	Unknown ErrorClass = iota
+	// Transient is the temporary error (5xx, over capacity, network error) which may succeed when retried.
+	Transient
+	// RateLimited is the error of rate limit including the daily limit of retweets.
+	RateLimited
+	// AuthInvalid is the error of invalid or expired credentials.
+	AuthInvalid
+	// TargetProtected is the error of protected users or users who block the account.
+	TargetProtected
+	// TargetSuspended is the error of suspended users.
+	TargetSuspended
+	// TargetNotFound is the error of users or lists which do not exist.
+	TargetNotFound
+	// TweetDeleted is the error of tweets which are deleted or unavailable.
+	TweetDeleted
+	// RetweetNotPermitted is the error of tweets which can not be retweeted.
+	RetweetNotPermitted
+	// AlreadyRetweeted is the error of tweets which are already retweeted.
+	AlreadyRetweeted
+)
+
+var errorClassNames = []string{"unknown", "transient", "rate limited", "auth invalid", "target protected", "target suspended", "target not found", "tweet deleted", "retweet not permitted", "already retweeted"}
+
+// String returns the name of the class.
+func (c ErrorClass) String() string {
+	if c < 0 || int(c) >= len(errorClassNames) {
+		return "class(" + strconv.Itoa(int(c)) + ")"
+	}
+	return errorClassNames[c]
+}
+
+// classByCode is the class of each error code of Twitter API.
+var classByCode = map[int]ErrorClass{
+	codeNoUserMatches:       TargetNotFound,
+	codeCouldNotAuth:        AuthInvalid,
+	codePageNotExist:        TargetNotFound,
+	codeUserNotFound:        TargetNotFound,
+	codeUserSuspended:       TargetSuspended,
+	codeRateLimitExceeded:   RateLimited,
+	codeInvalidToken:        AuthInvalid,
+	codeOverCapacity:        Transient,
+	codeInternalError:       Transient,
+	codeBlocked:             TargetProtected,
+	codeStatusNotFound:      TweetDeleted,
+	codeNotAuthorized:       TargetProtected,
+	codeOverDailyLimit:      RateLimited,
+	codeBadAuthData:         AuthInvalid,
+	codeAccountLocked:       AuthInvalid,
+	codeAlreadyRetweeted:    AlreadyRetweeted,
+	codeRetweetNotPermitted: RetweetNotPermitted,
+	codeTweetUnavailable:    TweetDeleted,
+	codeTweetViolated:       TweetDeleted,
+}
+
+// defaultRateLimitWindow is the window of rate limits used when the response has no X-Rate-Limit-Reset.
+const defaultRateLimitWindow = 15 * time.Minute
+
+// ClassifiedError is the error of a request to Twitter API with its class.
+type ClassifiedError struct {
+	Class ErrorClass
+	// ResetAt is the time when the rate limit is reset. set only if Class is RateLimited.
+	ResetAt time.Time
+	// StatusCode is the http status code. 0 if no response.
+	StatusCode int
+	Err        error
+}
+
+// Error returns error message
+func (e *ClassifiedError) Error() string {
+	return e.Err.Error()
+}
+
+// Classify classifies the result of a request to Twitter API by Twitter error codes and http status code.
+// returns nil if the request succeeded. err may be *ClassifiedError, then it is returned as it is.
+func Classify(resp *http.Response, err error) *ClassifiedError {
+	if cerr, ok := err.(*ClassifiedError); ok {
+		return cerr
+	}
+	if err == nil {
+		if resp == nil || resp.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("%v", resp.Status)
+	}
+	cerr := &ClassifiedError{Class: Unknown, Err: err}
+	if resp != nil {
+		cerr.StatusCode = resp.StatusCode
+	}
+
+	// error codes are more specific than status codes.
+	for _, code := range errorCodes(err) {
+		if class, ok := classByCode[code]; ok {
+			cerr.Class = class
+			break
+		}
+	}
+	if cerr.Class == Unknown {
+		cerr.Class = classByV2Error(err)
+	}
+	if cerr.Class == Unknown {
+		cerr.Class = classByStatus(resp, err)
+	}
+	if cerr.Class == RateLimited {
+		cerr.ResetAt = time.Now().Add(defaultRateLimitWindow)
+		if resp != nil {
+			if reset, err := strconv.ParseInt(resp.Header.Get("X-Rate-Limit-Reset"), 10, 64); err == nil {
+				cerr.ResetAt = time.Unix(reset, 0)
 			}
 		}
 	}
-	return false
+	return cerr
 }
 
-// IsRetweetNotPermitted checks the error is "not permitted" error
-func IsRetweetNotPermitted(err error) bool {
-	if apierr, ok := err.(*twitter.APIError); ok {
-		for _, e := range apierr.Errors {
-			if e.Code == codeRetweetNotPermitted {
-				return true
-			}
+// classByStatus classifies the error without Twitter error code.
+func classByStatus(resp *http.Response, err error) ErrorClass {
+	if resp == nil {
+		// connection refused, reset, timeout and so on. http.Client wraps them with *url.Error.
+		if _, ok := err.(*url.Error); ok {
+			return Transient
+		}
+		return Unknown
+	}
+	switch code := resp.StatusCode; {
+	case code >= 500:
+		return Transient
+	case code == 420 || code == 429:
+		return RateLimited
+	case code == http.StatusForbidden && resp.Header.Get("X-Rate-Limit-Remaining") == "0":
+		return RateLimited
+	case code == http.StatusUnauthorized:
+		// timelines of protected users respond 401 without error code. invalid credentials have error codes.
+		return TargetProtected
+	case code == http.StatusNotFound:
+		return TargetNotFound
+	}
+	return Unknown
+}
+
+// FilterError is returned by Loader.Load when ContextFilter fails.
+// the tweet and tweets newer than the tweet must not be marked as loaded to retry them later.
+type FilterError struct {
+	TweetID int64
+	Filter  Filter
+	Err     error
+}
+
+// Error returns error message
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("filter %v failed on tweet (%d) : %v", e.Filter, e.TweetID, e.Err)
+}
+
+// GapError reports that tweets since the checkpoint are not loaded fully
+// because Source has more tweets than Loader can load (MaxIteration pages) or than API returns (e.g. 3200 tweets).
+// tweets whose id is between SinceID and MaxID (exclusive) may be lost.
+type GapError struct {
+	SinceID int64
+	// MaxID is the id of the oldest loaded tweet.
+	MaxID int64
+}
+
+// Error returns error message
+func (e *GapError) Error() string {
+	return fmt.Sprintf("tweets between (%d) and (%d) are not loaded", e.SinceID, e.MaxID)
+}
+
+// errorCodes returns Twitter error codes of err.
+// go-twitter returns twitter.APIError as a value, but a pointer is accepted too.
+func errorCodes(err error) []int {
+	if cerr, ok := err.(*ClassifiedError); ok {
+		err = cerr.Err
+	}
+	var apierr twitter.APIError
+	switch e := err.(type) {
+	case twitter.APIError:
+		apierr = e
+	case *twitter.APIError:
+		apierr = *e
+	default:
+		return nil
+	}
+	codes := make([]int, len(apierr.Errors))
+	for i, e := range apierr.Errors {
+		codes[i] = e.Code
+	}
+	return codes
+}
+
+// hasCode checks the error has the Twitter error code.
+func hasCode(err error, code int) bool {
+	for _, c := range errorCodes(err) {
+		if c == code {
+			return true
 		}
 	}
 	return false
 }
 
+// IsAlreadyRetweeted checks the error is "already retweeted" error
+func IsAlreadyRetweeted(err error) bool {
+	return hasCode(err, codeAlreadyRetweeted)
+}
+
+// IsRetweetNotPermitted checks the error is "not permitted" error
+func IsRetweetNotPermitted(err error) bool {
+	return hasCode(err, codeRetweetNotPermitted)
+}
+
 func IsRateLimit(resp *http.Response) (limited bool, sleep time.Duration) {
+	if resp == nil {
+		return false, 0
+	}
 	// Twitter API returns 403, 420, 429 http status code when rate limited.
 	// https://developer.twitter.com/en/docs/basics/response-codes.html
 	code := resp.StatusCode
@@ -0,0 +1,67 @@
+package twilter
+
+import (
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func apiError(code int) error {
+	return twitter.APIError{Errors: []twitter.ErrorDetail{{Code: code, Message: "error"}}}
+}
+
+func TestClassify(t *testing.T) {
+	reset := time.Now().Add(5 * time.Minute).Truncate(time.Second)
+	limited := statusResponse(http.StatusTooManyRequests)
+	limited.Header.Set("X-Rate-Limit-Remaining", "0")
+	limited.Header.Set("X-Rate-Limit-Reset", fmt.Sprint(reset.Unix()))
+
+	for _, test := range []struct {
+		name  string
+		resp  *http.Response
+		err   error
+		class ErrorClass
+	}{
+		{"network error", nil, &url.Error{Op: "Get", URL: "https://api.twitter.com", Err: fmt.Errorf("connection reset")}, Transient},
+		{"over capacity", statusResponse(503), apiError(130), Transient},
+		{"server error", statusResponse(502), nil, Transient},
+		{"rate limit", limited, apiError(88), RateLimited},
+		{"daily limit", statusResponse(403), apiError(185), RateLimited},
+		{"invalid token", statusResponse(401), apiError(89), AuthInvalid},
+		{"protected timeline", statusResponse(401), nil, TargetProtected},
+		{"protected tweet", statusResponse(403), &twitter.APIError{Errors: []twitter.ErrorDetail{{Code: 179}}}, TargetProtected},
+		{"suspended", statusResponse(403), apiError(63), TargetSuspended},
+		{"user not found", statusResponse(404), apiError(50), TargetNotFound},
+		{"page not found", statusResponse(404), nil, TargetNotFound},
+		{"tweet deleted", statusResponse(404), apiError(144), TweetDeleted},
+		{"retweet not permitted", statusResponse(403), apiError(328), RetweetNotPermitted},
+		{"already retweeted", statusResponse(403), apiError(327), AlreadyRetweeted},
+		{"duplicate status", statusResponse(403), apiError(187), Unknown},
+		{"unknown", statusResponse(400), fmt.Errorf("bad request"), Unknown},
+	} {
+		cerr := Classify(test.resp, test.err)
+		if cerr == nil || cerr.Class != test.class {
+			t.Errorf("%v : Classify() = %+v", test.name, cerr)
+			continue
+		}
+		if test.class == RateLimited && test.resp == limited && !cerr.ResetAt.Equal(reset) {
+			t.Errorf("%v : ResetAt = %v", test.name, cerr.ResetAt)
+		}
+		if Classify(nil, cerr) != cerr {
+			t.Errorf("%v : ClassifiedError is classified again", test.name)
+		}
+	}
+
+	if cerr := Classify(statusResponse(200), nil); cerr != nil {
+		t.Errorf("success is classified as %v", cerr)
+	}
+	if limited, _ := IsRateLimit(nil); limited {
+		t.Errorf("IsRateLimit(nil) = true")
+	}
+	if !IsAlreadyRetweeted(Classify(statusResponse(403), apiError(327))) || IsRetweetNotPermitted(apiError(327)) {
+		t.Errorf("IsAlreadyRetweeted or IsRetweetNotPermitted is wrong")
+	}
+}
@@ -0,0 +1,324 @@
+package twilter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultExecTimeout = 10 * time.Second
+)
+
+// ExecOption ...
+type ExecOption struct {
+	// Timeout is the time limit to receive all verdicts of a batch.
+	Timeout time.Duration
+	// FailOpen makes tweets match when the process fails. tweets does not match by default (fail closed).
+	FailOpen bool
+}
+
+// ExecFilter filters tweets by the external long-lived process.
+//
+// the process receives each tweet as a JSON line on stdin and
+// writes a verdict JSON line `{"id": <tweet id>, "match": <bool>}` on stdout for each tweet.
+// verdicts may be written in any order.
+// a page of timeline is sent at once by Prepare not to pay a round trip per tweet.
+//
+// the process is killed when it times out or breaks the protocol, and is restarted on the next batch.
+// tweets whose verdict is not received are evaluated by the fail open/closed policy.
+type ExecFilter struct {
+	command  string
+	args     []string
+	timeout  time.Duration
+	failOpen bool
+
+	mu       sync.Mutex
+	proc     *execProcess
+	verdicts map[int64]bool
+}
+
+// execProcess is a running process.
+type execProcess struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan []byte // closed when stdout is closed
+}
+
+// execVerdict is a line written by the process.
+type execVerdict struct {
+	ID    int64 `json:"id"`
+	Match bool  `json:"match"`
+}
+
+// NewExecFilter returns ExecFilter. command is split into the program and arguments like shell (see splitCommand).
+// the process is not started until the first tweet comes.
+func NewExecFilter(command string, option *ExecOption) (*ExecFilter, error) {
+	fields, err := splitCommand(command)
+	if err != nil {
+		return nil, fmt.Errorf("exec : %v", err)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("exec : command is empty")
+	}
+
+	// set default options
+	if option == nil {
+		option = new(ExecOption)
+	}
+	if option.Timeout == 0 {
+		option.Timeout = defaultExecTimeout
+	}
+
+	return &ExecFilter{
+		command:  command,
+		args:     fields,
+		timeout:  option.Timeout,
+		failOpen: option.FailOpen,
+	}, nil
+}
+
+// splitCommand splits command into words by spaces like shell. characters in single quotes are literal,
+// and backslash escapes the next character outside quotes and ", \ and $ in double quotes.
+// other features of shell (e.g. variables, globs and pipes) are not supported.
+func splitCommand(command string) ([]string, error) {
+	var (
+		words []string
+		word  []rune
+		quote rune
+		// inWord is true after a character of the word including empty quotes.
+		inWord  bool
+		escaped bool
+	)
+	for _, c := range command {
+		switch {
+		case escaped:
+			if quote == '"' && c != '"' && c != '\\' && c != '$' {
+				word = append(word, '\\')
+			}
+			word = append(word, c)
+			escaped = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word = append(word, c)
+			}
+		case c == '\\':
+			escaped, inWord = true, true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				word = append(word, c)
+			}
+		case c == '\'' || c == '"':
+			quote, inWord = c, true
+		case unicode.IsSpace(c):
+			if inWord {
+				words = append(words, string(word))
+				word, inWord = nil, false
+			}
+		default:
+			word = append(word, c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in command : %v", command)
+	} else if escaped {
+		return nil, fmt.Errorf("command ends with backslash : %v", command)
+	}
+	if inWord {
+		words = append(words, string(word))
+	}
+	return words, nil
+}
+
+// Prepare sends all tweets to the process and stores verdicts for Match.
+func (f *ExecFilter) Prepare(ctx context.Context, tweets []twitter.Tweet) error {
+	verdicts, err := f.request(ctx, tweets)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.verdicts = verdicts
+	f.mu.Unlock()
+	return nil
+}
+
+// Match returns the verdict prepared by Prepare. if not prepared, the tweet is sent to the process alone.
+func (f *ExecFilter) Match(tweet *twitter.Tweet) bool {
+	f.mu.Lock()
+	verdict, ok := f.verdicts[tweet.ID]
+	f.mu.Unlock()
+	if ok {
+		return verdict
+	}
+
+	verdicts, err := f.request(context.Background(), []twitter.Tweet{*tweet})
+	if err != nil {
+		return f.failOpen
+	}
+	return verdicts[tweet.ID]
+}
+
+// String returns exec
+func (f *ExecFilter) String() string {
+	return fmt.Sprintf("exec(%q)", f.command)
+}
+
+// Close kills the process.
+func (f *ExecFilter) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.kill()
+	return nil
+}
+
+// request sends tweets and receives verdicts. verdicts of all tweets are set even if the process fails.
+// returns error only when ctx is done.
+func (f *ExecFilter) request(ctx context.Context, tweets []twitter.Tweet) (map[int64]bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	verdicts := make(map[int64]bool, len(tweets))
+	if len(tweets) == 0 {
+		return verdicts, nil
+	}
+
+	err := f.exchange(ctx, tweets, verdicts)
+	if err != nil {
+		// the process may be broken and responses would be mixed up. restart on the next batch.
+		log.Printf("exec %q failed : %v\n", f.command, err)
+		f.kill()
+	}
+
+	// apply fail policy to tweets which has no verdict
+	for i := range tweets {
+		if _, ok := verdicts[tweets[i].ID]; !ok {
+			verdicts[tweets[i].ID] = f.failOpen
+		}
+	}
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	return verdicts, nil
+}
+
+// exchange writes tweets and reads verdicts into verdicts. f.mu must be locked.
+func (f *ExecFilter) exchange(ctx context.Context, tweets []twitter.Tweet, verdicts map[int64]bool) error {
+	if f.proc == nil {
+		if err := f.start(); err != nil {
+			return err
+		}
+	}
+	proc := f.proc
+
+	pending := make(map[int64]struct{}, len(tweets))
+	for i := range tweets {
+		pending[tweets[i].ID] = struct{}{}
+	}
+
+	// write tweets in another goroutine not to dead lock when the process writes while we are writing.
+	chWrite := make(chan error, 1)
+	go func() {
+		w := bufio.NewWriter(proc.stdin)
+		enc := json.NewEncoder(w)
+		for i := range tweets {
+			if err := enc.Encode(&tweets[i]); err != nil {
+				chWrite <- err
+				return
+			}
+		}
+		chWrite <- w.Flush()
+	}()
+
+	timer := time.NewTimer(f.timeout)
+	defer timer.Stop()
+
+	for len(pending) > 0 {
+		select {
+		case err := <-chWrite:
+			if err != nil {
+				return fmt.Errorf("write tweets : %v", err)
+			}
+		case line, ok := <-proc.lines:
+			if !ok {
+				return fmt.Errorf("process exited")
+			}
+			var v execVerdict
+			if err := json.Unmarshal(line, &v); err != nil {
+				return fmt.Errorf("invalid verdict %q : %v", line, err)
+			}
+			if _, ok := pending[v.ID]; ok {
+				delete(pending, v.ID)
+				verdicts[v.ID] = v.Match
+			}
+		case <-timer.C:
+			return fmt.Errorf("timeout (%v)", f.timeout)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// start starts the process. f.mu must be locked.
+func (f *ExecFilter) start() error {
+	cmd := exec.Command(f.args[0], f.args[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("start process : %v", err)
+	}
+
+	// read stdout until the process exits.
+	lines := make(chan []byte)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			line := make([]byte, len(scanner.Bytes()))
+			copy(line, scanner.Bytes())
+			lines <- line
+		}
+	}()
+
+	f.proc = &execProcess{cmd: cmd, stdin: stdin, lines: lines}
+	return nil
+}
+
+// kill kills the process if running. f.mu must be locked.
+func (f *ExecFilter) kill() {
+	if f.proc == nil {
+		return
+	}
+	proc := f.proc
+	f.proc = nil
+	_ = proc.stdin.Close()
+	_ = proc.cmd.Process.Kill()
+	// drain stdout to let the reader goroutine exit and reap the process.
+	go func() {
+		for range proc.lines {
+		}
+		_ = proc.cmd.Wait()
+	}()
+}
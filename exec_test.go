@@ -0,0 +1,114 @@
+package twilter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExecHelperProcess is not a test but the external process used by TestExecFilter.
+func TestExecHelperProcess(t *testing.T) {
+	if os.Getenv("TWILTER_EXEC_HELPER") != "1" {
+		return
+	}
+	mode := os.Args[len(os.Args)-1]
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var tweet twitter.Tweet
+		if err := json.Unmarshal(scanner.Bytes(), &tweet); err != nil {
+			os.Exit(1)
+		}
+		switch {
+		case mode == "hang":
+			time.Sleep(time.Hour)
+		case mode == "crash" && strings.Contains(tweet.Text, "crash"):
+			os.Exit(1)
+		}
+		fmt.Printf("{\"id\":%d,\"match\":%v}\n", tweet.ID, strings.Contains(tweet.Text, "art"))
+	}
+	os.Exit(0)
+}
+
+func newHelperExecFilter(t *testing.T, mode string, option *ExecOption) *ExecFilter {
+	os.Setenv("TWILTER_EXEC_HELPER", "1")
+	f, err := NewExecFilter(fmt.Sprintf("%v -test.run=TestExecHelperProcess -- %v", os.Args[0], mode), option)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestSplitCommand(t *testing.T) {
+	for _, test := range []struct {
+		command string
+		words   string
+	}{
+		{"python3  classify.py -v", `["python3" "classify.py" "-v"]`},
+		{`python3 "/path/to/my model.py" 'a "b"'`, `["python3" "/path/to/my model.py" "a \"b\""]`},
+		{`echo a\ b "c\"d\n" '' x""y`, `["echo" "a b" "c\"d\\n" "" "xy"]`},
+		{"  ", "[]"},
+	} {
+		words, err := splitCommand(test.command)
+		if err != nil || fmt.Sprintf("%q", words) != test.words {
+			t.Errorf("splitCommand(%v) = %q, %v", test.command, words, err)
+		}
+	}
+	for _, command := range []string{`echo "a`, `echo 'a`, `echo a\`} {
+		if _, err := splitCommand(command); err == nil {
+			t.Errorf("splitCommand(%v) must fail", command)
+		}
+	}
+}
+
+func TestExecFilter(t *testing.T) {
+	tweets := []twitter.Tweet{{ID: 1, Text: "my art"}, {ID: 2, Text: "lunch"}, {ID: 3, Text: "crash"}}
+
+	t.Run("batch", func(t *testing.T) {
+		f := newHelperExecFilter(t, "echo", nil)
+		defer f.Close()
+		if err := f.Prepare(context.Background(), tweets); err != nil {
+			t.Fatal(err)
+		}
+		for i, expected := range []bool{true, false, false} {
+			if result := f.Match(&tweets[i]); result != expected {
+				t.Errorf("tweet %d = %v, expected %v", tweets[i].ID, result, expected)
+			}
+		}
+		// not prepared tweet is sent alone
+		if !f.Match(&twitter.Tweet{ID: 4, Text: "art"}) {
+			t.Errorf("not prepared tweet must match")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		f := newHelperExecFilter(t, "hang", &ExecOption{Timeout: 100 * time.Millisecond, FailOpen: true})
+		defer f.Close()
+		if err := f.Prepare(context.Background(), tweets); err != nil {
+			t.Fatal(err)
+		}
+		if !f.Match(&tweets[1]) {
+			t.Errorf("fail open filter must match on timeout")
+		}
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		f := newHelperExecFilter(t, "crash", &ExecOption{Timeout: time.Second})
+		defer f.Close()
+		if err := f.Prepare(context.Background(), tweets); err != nil {
+			t.Fatal(err)
+		}
+		if f.Match(&tweets[2]) {
+			t.Errorf("fail closed filter must not match on crash")
+		}
+		// process is restarted
+		if !f.Match(&twitter.Tweet{ID: 5, Text: "art"}) {
+			t.Errorf("restarted process must match")
+		}
+	})
+}
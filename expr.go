@@ -0,0 +1,747 @@
+package twilter
+
+import (
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"strconv"
+	"strings"
+)
+
+// ExprFilter filters tweets by the predicate expression over tweet fields.
+//
+// expression is compiled and type checked once by NewExprFilter.
+// Match only calls the compiled closures, so no reflection and no parsing happens on the hot path.
+// expression has no loops, no assignments and no function call to outside,
+// so the evaluation always finishes in time proportional to the size of expression.
+//
+//	favorite_count > 50 && user.followers_count < 1000 && len(entities.hashtags) >= 2
+//
+// see exprFields for available fields and exprFuncs for available functions.
+type ExprFilter struct {
+	src  string
+	eval func(tweet *twitter.Tweet) bool
+}
+
+// NewExprFilter compiles src and returns ExprFilter.
+func NewExprFilter(src string) (*ExprFilter, error) {
+	p := &exprParser{lexer: exprLexer{src: src}}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %v", p.tok)
+	}
+	if node.typ != typeBool {
+		return nil, fmt.Errorf("expr : result must be bool but %v", node.typ)
+	}
+	return &ExprFilter{src: src, eval: node.b}, nil
+}
+
+// Match returns the result of expression
+func (f *ExprFilter) Match(tweet *twitter.Tweet) bool {
+	return f.eval(tweet)
+}
+
+// String returns expr
+func (f *ExprFilter) String() string {
+	return fmt.Sprintf("expr(%v)", strconv.Quote(f.src))
+}
+
+// exprType is type of value in expression.
+type exprType int
+
+const (
+	typeInt exprType = iota
+	typeBool
+	typeString
+	typeList
+)
+
+func (t exprType) String() string {
+	switch t {
+	case typeInt:
+		return "int"
+	case typeBool:
+		return "bool"
+	case typeString:
+		return "string"
+	case typeList:
+		return "list"
+	default:
+		return "unknown"
+	}
+}
+
+// exprNode is compiled expression. only the closure of typ is set.
+type exprNode struct {
+	typ exprType
+	i   func(tweet *twitter.Tweet) int64
+	b   func(tweet *twitter.Tweet) bool
+	s   func(tweet *twitter.Tweet) string
+	l   func(tweet *twitter.Tweet) []string
+}
+
+func intField(fn func(tweet *twitter.Tweet) int64) *exprNode {
+	return &exprNode{typ: typeInt, i: fn}
+}
+
+func boolField(fn func(tweet *twitter.Tweet) bool) *exprNode {
+	return &exprNode{typ: typeBool, b: fn}
+}
+
+func stringField(fn func(tweet *twitter.Tweet) string) *exprNode {
+	return &exprNode{typ: typeString, s: fn}
+}
+
+func listField(fn func(tweet *twitter.Tweet) []string) *exprNode {
+	return &exprNode{typ: typeList, l: fn}
+}
+
+// exprFields is fields of tweet which expression can refer.
+// fields of nested objects are joined by ".". missing objects (nil) are evaluated as zero value.
+var exprFields = map[string]*exprNode{
+	"id":                      intField(func(t *twitter.Tweet) int64 { return t.ID }),
+	"text":                    stringField(tweetText),
+	"lang":                    stringField(func(t *twitter.Tweet) string { return t.Lang }),
+	"source":                  stringField(func(t *twitter.Tweet) string { return t.Source }),
+	"favorite_count":          intField(func(t *twitter.Tweet) int64 { return int64(t.FavoriteCount) }),
+	"retweet_count":           intField(func(t *twitter.Tweet) int64 { return int64(t.RetweetCount) }),
+	"quote_count":             intField(func(t *twitter.Tweet) int64 { return int64(t.QuoteCount) }),
+	"reply_count":             intField(func(t *twitter.Tweet) int64 { return int64(t.ReplyCount) }),
+	"possibly_sensitive":      boolField(func(t *twitter.Tweet) bool { return t.PossiblySensitive }),
+	"retweeted":               boolField(func(t *twitter.Tweet) bool { return t.Retweeted }),
+	"favorited":               boolField(func(t *twitter.Tweet) bool { return t.Favorited }),
+	"truncated":               boolField(func(t *twitter.Tweet) bool { return t.Truncated }),
+	"in_reply_to_status_id":   intField(func(t *twitter.Tweet) int64 { return t.InReplyToStatusID }),
+	"in_reply_to_user_id":     intField(func(t *twitter.Tweet) int64 { return t.InReplyToUserID }),
+	"in_reply_to_screen_name": stringField(func(t *twitter.Tweet) string { return t.InReplyToScreenName }),
+	"quoted_status_id":        intField(func(t *twitter.Tweet) int64 { return t.QuotedStatusID }),
+	"is_retweet":              boolField(func(t *twitter.Tweet) bool { return t.RetweetedStatus != nil }),
+	"is_quote":                boolField(func(t *twitter.Tweet) bool { return t.QuotedStatusID > 0 }),
+	"is_reply":                boolField(func(t *twitter.Tweet) bool { return t.InReplyToStatusID > 0 }),
+
+	// user
+	"user.id":               intField(func(t *twitter.Tweet) int64 { return tweetUser(t).ID }),
+	"user.screen_name":      stringField(func(t *twitter.Tweet) string { return tweetUser(t).ScreenName }),
+	"user.name":             stringField(func(t *twitter.Tweet) string { return tweetUser(t).Name }),
+	"user.lang":             stringField(func(t *twitter.Tweet) string { return tweetUser(t).Lang }),
+	"user.followers_count":  intField(func(t *twitter.Tweet) int64 { return int64(tweetUser(t).FollowersCount) }),
+	"user.friends_count":    intField(func(t *twitter.Tweet) int64 { return int64(tweetUser(t).FriendsCount) }),
+	"user.statuses_count":   intField(func(t *twitter.Tweet) int64 { return int64(tweetUser(t).StatusesCount) }),
+	"user.favourites_count": intField(func(t *twitter.Tweet) int64 { return int64(tweetUser(t).FavouritesCount) }),
+	"user.listed_count":     intField(func(t *twitter.Tweet) int64 { return int64(tweetUser(t).ListedCount) }),
+	"user.verified":         boolField(func(t *twitter.Tweet) bool { return tweetUser(t).Verified }),
+	"user.protected":        boolField(func(t *twitter.Tweet) bool { return tweetUser(t).Protected }),
+
+	// entities are converted to list of string.
+	"entities.hashtags": listField(func(t *twitter.Tweet) []string {
+		var values []string
+		for _, e := range tweetEntities(t).Hashtags {
+			values = append(values, e.Text)
+		}
+		return values
+	}),
+	"entities.urls": listField(func(t *twitter.Tweet) []string {
+		var values []string
+		for _, e := range tweetEntities(t).Urls {
+			values = append(values, e.ExpandedURL)
+		}
+		return values
+	}),
+	"entities.user_mentions": listField(func(t *twitter.Tweet) []string {
+		var values []string
+		for _, e := range tweetEntities(t).UserMentions {
+			values = append(values, e.ScreenName)
+		}
+		return values
+	}),
+	"entities.media": listField(func(t *twitter.Tweet) []string {
+		var values []string
+		for _, e := range tweetMedia(t) {
+			values = append(values, e.Type)
+		}
+		return values
+	}),
+}
+
+// exprTweetFields is fields which has tweet object. fields of the nested tweet are referred with the prefix.
+var exprTweetFields = map[string]func(t *twitter.Tweet) *twitter.Tweet{
+	"retweeted_status.": func(t *twitter.Tweet) *twitter.Tweet { return t.RetweetedStatus },
+	"quoted_status.":    func(t *twitter.Tweet) *twitter.Tweet { return t.QuotedStatus },
+}
+
+var (
+	emptyUser     = &twitter.User{}
+	emptyEntities = &twitter.Entities{}
+	emptyTweet    = &twitter.Tweet{}
+)
+
+func tweetUser(t *twitter.Tweet) *twitter.User {
+	if t.User == nil {
+		return emptyUser
+	}
+	return t.User
+}
+
+func tweetEntities(t *twitter.Tweet) *twitter.Entities {
+	if t.ExtendedTweet != nil && t.ExtendedTweet.Entities != nil {
+		return t.ExtendedTweet.Entities
+	} else if t.Entities == nil {
+		return emptyEntities
+	}
+	return t.Entities
+}
+
+func tweetMedia(t *twitter.Tweet) []twitter.MediaEntity {
+	if t.ExtendedEntities != nil {
+		return t.ExtendedEntities.Media
+	}
+	return tweetEntities(t).Media
+}
+
+func tweetText(t *twitter.Tweet) string {
+	if t.FullText != "" {
+		return t.FullText
+	} else if t.ExtendedTweet != nil && t.ExtendedTweet.FullText != "" {
+		return t.ExtendedTweet.FullText
+	}
+	return t.Text
+}
+
+// originalText returns text of the original tweet for retweet because text of retweet is truncated.
+func originalText(t *twitter.Tweet) string {
+	if t.RetweetedStatus != nil {
+		return tweetText(t.RetweetedStatus)
+	}
+	return tweetText(t)
+}
+
+// lookupField returns compiled node of the field.
+func lookupField(name string) *exprNode {
+	for prefix, get := range exprTweetFields {
+		if strings.HasPrefix(name, prefix) {
+			inner := lookupField(name[len(prefix):])
+			if inner == nil {
+				return nil
+			}
+			return nestField(get, inner)
+		}
+	}
+	return exprFields[name]
+}
+
+// nestField converts node for the nested tweet to node for the tweet.
+func nestField(get func(t *twitter.Tweet) *twitter.Tweet, inner *exprNode) *exprNode {
+	nested := func(t *twitter.Tweet) *twitter.Tweet {
+		if nt := get(t); nt != nil {
+			return nt
+		}
+		return emptyTweet
+	}
+	switch inner.typ {
+	case typeInt:
+		return intField(func(t *twitter.Tweet) int64 { return inner.i(nested(t)) })
+	case typeBool:
+		return boolField(func(t *twitter.Tweet) bool { return inner.b(nested(t)) })
+	case typeString:
+		return stringField(func(t *twitter.Tweet) string { return inner.s(nested(t)) })
+	default:
+		return listField(func(t *twitter.Tweet) []string { return inner.l(nested(t)) })
+	}
+}
+
+// exprFuncs is built-in functions. each function type checks args and returns compiled node.
+var exprFuncs = map[string]func(args []*exprNode) (*exprNode, error){
+	// len(<string|list>) returns length of string (in characters) or list
+	"len": func(args []*exprNode) (*exprNode, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("len takes 1 argument")
+		}
+		a := args[0]
+		switch a.typ {
+		case typeString:
+			return intField(func(t *twitter.Tweet) int64 { return int64(len([]rune(a.s(t)))) }), nil
+		case typeList:
+			return intField(func(t *twitter.Tweet) int64 { return int64(len(a.l(t))) }), nil
+		}
+		return nil, fmt.Errorf("len takes string or list but %v", a.typ)
+	},
+	// contains(<string>, <string>) checks substring and contains(<list>, <string>) checks element (case insensitive)
+	"contains": func(args []*exprNode) (*exprNode, error) {
+		if len(args) != 2 || args[1].typ != typeString {
+			return nil, fmt.Errorf("contains takes (string, string) or (list, string)")
+		}
+		a, b := args[0], args[1]
+		switch a.typ {
+		case typeString:
+			return boolField(func(t *twitter.Tweet) bool { return strings.Contains(a.s(t), b.s(t)) }), nil
+		case typeList:
+			return boolField(func(t *twitter.Tweet) bool {
+				s := b.s(t)
+				for _, v := range a.l(t) {
+					if strings.EqualFold(v, s) {
+						return true
+					}
+				}
+				return false
+			}), nil
+		}
+		return nil, fmt.Errorf("contains takes (string, string) or (list, string)")
+	},
+	// lower(<string>) returns lower case string
+	"lower": func(args []*exprNode) (*exprNode, error) {
+		if len(args) != 1 || args[0].typ != typeString {
+			return nil, fmt.Errorf("lower takes string")
+		}
+		a := args[0]
+		return stringField(func(t *twitter.Tweet) string { return strings.ToLower(a.s(t)) }), nil
+	},
+	// has_prefix(<string>, <string>) checks prefix
+	"has_prefix": func(args []*exprNode) (*exprNode, error) {
+		if len(args) != 2 || args[0].typ != typeString || args[1].typ != typeString {
+			return nil, fmt.Errorf("has_prefix takes (string, string)")
+		}
+		a, b := args[0], args[1]
+		return boolField(func(t *twitter.Tweet) bool { return strings.HasPrefix(a.s(t), b.s(t)) }), nil
+	},
+}
+
+// lexer
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokInt
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+type exprLexer struct {
+	src string
+	pos int
+}
+
+// operators sorted by length to match longest one first.
+var exprOps = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", ","}
+
+func (l *exprLexer) next() (token, error) {
+	// skip spaces
+	for l.pos < len(l.src) && strings.ContainsRune(" \t\r\n", rune(l.src[l.pos])) {
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: l.pos}, nil
+	}
+
+	head := l.pos
+	c := l.src[l.pos]
+	switch {
+	case isIdentChar(c) && !isDigit(c):
+		// identifier can include "." to refer nested field
+		for l.pos < len(l.src) && (isIdentChar(l.src[l.pos]) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[head:l.pos], pos: head}, nil
+
+	case isDigit(c):
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokInt, text: l.src[head:l.pos], pos: head}, nil
+
+	case c == '"' || c == '\'':
+		// string literal. backslash escapes next character.
+		var sb strings.Builder
+		l.pos++
+		for l.pos < len(l.src) && l.src[l.pos] != c {
+			if l.src[l.pos] == '\\' && l.pos+1 < len(l.src) {
+				l.pos++
+			}
+			sb.WriteByte(l.src[l.pos])
+			l.pos++
+		}
+		if l.pos >= len(l.src) {
+			return token{}, fmt.Errorf("expr : string not terminated at %d", head)
+		}
+		l.pos++
+		return token{kind: tokString, text: sb.String(), pos: head}, nil
+	}
+
+	for _, op := range exprOps {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokOp, text: op, pos: head}, nil
+		}
+	}
+	return token{}, fmt.Errorf("expr : invalid character %q at %d", c, head)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || isDigit(c)
+}
+
+// parser
+
+// exprParser is recursive descent parser which compiles expression while parsing.
+//
+//	or      = and { "||" and }
+//	and     = compare { "&&" compare }
+//	compare = add [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) add ]
+//	add     = mul { ( "+" | "-" ) mul }
+//	mul     = unary { ( "*" | "/" | "%" ) unary }
+//	unary   = ( "!" | "-" ) unary | primary
+//	primary = int | string | "true" | "false" | field | func "(" [ or { "," or } ] ")" | "(" or ")"
+type exprParser struct {
+	lexer exprLexer
+	tok   token
+}
+
+func (p *exprParser) next() error {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("expr : %v at %d", fmt.Sprintf(format, args...), p.tok.pos)
+}
+
+func (p *exprParser) isOp(ops ...string) bool {
+	if p.tok.kind != tokOp {
+		return false
+	}
+	for _, op := range ops {
+		if p.tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) parseOr() (*exprNode, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") {
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if x.typ != typeBool || y.typ != typeBool {
+			return nil, p.errorf("|| takes bool but %v and %v", x.typ, y.typ)
+		}
+		a, b := x.b, y.b
+		x = boolField(func(t *twitter.Tweet) bool { return a(t) || b(t) })
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseAnd() (*exprNode, error) {
+	x, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&") {
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+		y, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		if x.typ != typeBool || y.typ != typeBool {
+			return nil, p.errorf("&& takes bool but %v and %v", x.typ, y.typ)
+		}
+		a, b := x.b, y.b
+		x = boolField(func(t *twitter.Tweet) bool { return a(t) && b(t) })
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseCompare() (*exprNode, error) {
+	x, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("==", "!=", "<", "<=", ">", ">=") {
+		return x, nil
+	}
+	op := p.tok.text
+	if err = p.next(); err != nil {
+		return nil, err
+	}
+	y, err := p.parseAdd()
+	if err != nil {
+		return nil, err
+	}
+	if x.typ != y.typ {
+		return nil, p.errorf("%v compares different types %v and %v", op, x.typ, y.typ)
+	}
+
+	switch x.typ {
+	case typeInt:
+		a, b := x.i, y.i
+		switch op {
+		case "==":
+			return boolField(func(t *twitter.Tweet) bool { return a(t) == b(t) }), nil
+		case "!=":
+			return boolField(func(t *twitter.Tweet) bool { return a(t) != b(t) }), nil
+		case "<":
+			return boolField(func(t *twitter.Tweet) bool { return a(t) < b(t) }), nil
+		case "<=":
+			return boolField(func(t *twitter.Tweet) bool { return a(t) <= b(t) }), nil
+		case ">":
+			return boolField(func(t *twitter.Tweet) bool { return a(t) > b(t) }), nil
+		default:
+			return boolField(func(t *twitter.Tweet) bool { return a(t) >= b(t) }), nil
+		}
+
+	case typeString:
+		a, b := x.s, y.s
+		switch op {
+		case "==":
+			return boolField(func(t *twitter.Tweet) bool { return a(t) == b(t) }), nil
+		case "!=":
+			return boolField(func(t *twitter.Tweet) bool { return a(t) != b(t) }), nil
+		case "<":
+			return boolField(func(t *twitter.Tweet) bool { return a(t) < b(t) }), nil
+		case "<=":
+			return boolField(func(t *twitter.Tweet) bool { return a(t) <= b(t) }), nil
+		case ">":
+			return boolField(func(t *twitter.Tweet) bool { return a(t) > b(t) }), nil
+		default:
+			return boolField(func(t *twitter.Tweet) bool { return a(t) >= b(t) }), nil
+		}
+
+	case typeBool:
+		a, b := x.b, y.b
+		switch op {
+		case "==":
+			return boolField(func(t *twitter.Tweet) bool { return a(t) == b(t) }), nil
+		case "!=":
+			return boolField(func(t *twitter.Tweet) bool { return a(t) != b(t) }), nil
+		}
+	}
+	return nil, p.errorf("%v is not supported for %v", op, x.typ)
+}
+
+func (p *exprParser) parseAdd() (*exprNode, error) {
+	x, err := p.parseMul()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+", "-") {
+		op := p.tok.text
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+		y, err := p.parseMul()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case x.typ == typeInt && y.typ == typeInt:
+			a, b := x.i, y.i
+			if op == "+" {
+				x = intField(func(t *twitter.Tweet) int64 { return a(t) + b(t) })
+			} else {
+				x = intField(func(t *twitter.Tweet) int64 { return a(t) - b(t) })
+			}
+		case x.typ == typeString && y.typ == typeString && op == "+":
+			a, b := x.s, y.s
+			x = stringField(func(t *twitter.Tweet) string { return a(t) + b(t) })
+		default:
+			return nil, p.errorf("%v is not supported for %v and %v", op, x.typ, y.typ)
+		}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseMul() (*exprNode, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*", "/", "%") {
+		op := p.tok.text
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if x.typ != typeInt || y.typ != typeInt {
+			return nil, p.errorf("%v takes int but %v and %v", op, x.typ, y.typ)
+		}
+		a, b := x.i, y.i
+		switch op {
+		case "*":
+			x = intField(func(t *twitter.Tweet) int64 { return a(t) * b(t) })
+		case "/":
+			// division by zero is evaluated as 0 not to panic.
+			x = intField(func(t *twitter.Tweet) int64 {
+				if d := b(t); d != 0 {
+					return a(t) / d
+				}
+				return 0
+			})
+		default:
+			x = intField(func(t *twitter.Tweet) int64 {
+				if d := b(t); d != 0 {
+					return a(t) % d
+				}
+				return 0
+			})
+		}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseUnary() (*exprNode, error) {
+	if !p.isOp("!", "-") {
+		return p.parsePrimary()
+	}
+	op := p.tok.text
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if op == "!" {
+		if x.typ != typeBool {
+			return nil, p.errorf("! takes bool but %v", x.typ)
+		}
+		a := x.b
+		return boolField(func(t *twitter.Tweet) bool { return !a(t) }), nil
+	}
+	if x.typ != typeInt {
+		return nil, p.errorf("- takes int but %v", x.typ)
+	}
+	a := x.i
+	return intField(func(t *twitter.Tweet) int64 { return -a(t) }), nil
+}
+
+func (p *exprParser) parsePrimary() (*exprNode, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokInt:
+		v, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid int %v", tok)
+		}
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+		return intField(func(_ *twitter.Tweet) int64 { return v }), nil
+
+	case tokString:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		v := tok.text
+		return stringField(func(_ *twitter.Tweet) string { return v }), nil
+
+	case tokIdent:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		switch {
+		case tok.text == "true":
+			return boolField(func(_ *twitter.Tweet) bool { return true }), nil
+		case tok.text == "false":
+			return boolField(func(_ *twitter.Tweet) bool { return false }), nil
+		case p.isOp("("):
+			return p.parseCall(tok)
+		}
+		node := lookupField(tok.text)
+		if node == nil {
+			return nil, fmt.Errorf("expr : unknown field %v at %d", tok, tok.pos)
+		}
+		return node, nil
+
+	case tokOp:
+		if tok.text == "(" {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.isOp(")") {
+				return nil, p.errorf("expected \")\" but %v", p.tok)
+			}
+			return x, p.next()
+		}
+	}
+	return nil, p.errorf("unexpected %v", tok)
+}
+
+func (p *exprParser) parseCall(name token) (*exprNode, error) {
+	fn, ok := exprFuncs[name.text]
+	if !ok {
+		return nil, fmt.Errorf("expr : unknown function %v at %d", name, name.pos)
+	}
+	// skip "("
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	var args []*exprNode
+	for !p.isOp(")") {
+		if len(args) > 0 {
+			if !p.isOp(",") {
+				return nil, p.errorf("expected \",\" but %v", p.tok)
+			}
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	// skip ")"
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	node, err := fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("expr : %v at %d", err, name.pos)
+	}
+	return node, nil
+}
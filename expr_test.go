@@ -0,0 +1,57 @@
+package twilter
+
+import (
+	"github.com/dghubble/go-twitter/twitter"
+	"testing"
+)
+
+func TestExprFilter(t *testing.T) {
+	tweet := &twitter.Tweet{
+		ID:            100,
+		Text:          "hello #art #drawing",
+		FavoriteCount: 60,
+		User:          &twitter.User{FollowersCount: 500, ScreenName: "kawasin73"},
+		Entities: &twitter.Entities{
+			Hashtags: []twitter.HashtagEntity{{Text: "art"}, {Text: "drawing"}},
+		},
+		RetweetedStatus: &twitter.Tweet{FavoriteCount: 3},
+	}
+
+	for _, test := range []struct {
+		src    string
+		result bool
+	}{
+		{"favorite_count > 50 && user.followers_count < 1000 && len(entities.hashtags) >= 2", true},
+		{"favorite_count > 50 && user.followers_count < 100", false},
+		{"!(favorite_count <= 50) || false", true},
+		{"contains(entities.hashtags, \"ART\")", true},
+		{"contains(text, 'drawing') && user.screen_name == \"kawasin73\"", true},
+		{"retweeted_status.favorite_count * 2 + 1 == 7", true},
+		{"quoted_status.favorite_count == 0 && !is_quote", true},
+		{"favorite_count / 0 == 0 && -id < 0", true},
+		{"len(entities.media) > 0", false},
+	} {
+		f, err := NewExprFilter(test.src)
+		if err != nil {
+			t.Errorf("%q failed to compile : %v", test.src, err)
+		} else if result := f.Match(tweet); result != test.result {
+			t.Errorf("%q = %v, expected %v", test.src, result, test.result)
+		}
+	}
+
+	// compile errors
+	for _, src := range []string{
+		"favorite_count",
+		"favorite_count > \"50\"",
+		"unknown_field == 1",
+		"len(favorite_count) > 1",
+		"unknown(text)",
+		"(favorite_count > 1",
+		"text == \"unterminated",
+		"favorite_count > 1 &&",
+	} {
+		if _, err := NewExprFilter(src); err == nil {
+			t.Errorf("%q must fail to compile", src)
+		}
+	}
+}
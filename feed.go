@@ -0,0 +1,453 @@
+package twilter
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"hash/fnv"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// feedEntry is an entry of RSS or Atom feed.
+type feedEntry struct {
+	guid       string
+	title      string
+	link       string
+	summary    string
+	published  time.Time
+	categories []string
+	// enclosures is pairs of url and mime type.
+	enclosures [][2]string
+}
+
+// rssFeed is RSS 2.0 document.
+type rssFeed struct {
+	Channel struct {
+		Title string `xml:"title"`
+		Items []struct {
+			Title       string   `xml:"title"`
+			Link        string   `xml:"link"`
+			GUID        string   `xml:"guid"`
+			PubDate     string   `xml:"pubDate"`
+			Description string   `xml:"description"`
+			Categories  []string `xml:"category"`
+			Enclosures  []struct {
+				URL  string `xml:"url,attr"`
+				Type string `xml:"type,attr"`
+			} `xml:"enclosure"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+// atomLink is the link of Atom.
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// atomFeed is Atom document.
+type atomFeed struct {
+	Title   string `xml:"title"`
+	Entries []struct {
+		ID         string     `xml:"id"`
+		Title      string     `xml:"title"`
+		Links      []atomLink `xml:"link"`
+		Published  string     `xml:"published"`
+		Updated    string     `xml:"updated"`
+		Summary    string     `xml:"summary"`
+		Content    string     `xml:"content"`
+		Categories []struct {
+			Term string `xml:"term,attr"`
+		} `xml:"category"`
+	} `xml:"entry"`
+}
+
+// feedTimeLayouts is formats of dates in feeds. RSS uses RFC 822 with variations and Atom uses RFC 3339.
+var feedTimeLayouts = []string{time.RFC1123Z, time.RFC1123, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST", "2 Jan 2006 15:04:05 -0700", time.RFC3339}
+
+// parseFeedTime parses the date of feeds. zero if unknown format.
+func parseFeedTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range feedTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseFeed parses RSS 2.0 or Atom document and returns the title and entries.
+func parseFeed(data []byte) (string, []feedEntry, error) {
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return "", nil, fmt.Errorf("parse feed : %v", err)
+	}
+
+	var entries []feedEntry
+	switch root.XMLName.Local {
+	case "rss":
+		var feed rssFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return "", nil, fmt.Errorf("parse rss : %v", err)
+		}
+		for _, item := range feed.Channel.Items {
+			entry := feedEntry{
+				guid:       strings.TrimSpace(item.GUID),
+				title:      strings.TrimSpace(item.Title),
+				link:       strings.TrimSpace(item.Link),
+				summary:    item.Description,
+				published:  parseFeedTime(item.PubDate),
+				categories: item.Categories,
+			}
+			for _, e := range item.Enclosures {
+				entry.enclosures = append(entry.enclosures, [2]string{e.URL, e.Type})
+			}
+			entries = append(entries, entry)
+		}
+		return feed.Channel.Title, entries, nil
+
+	case "feed":
+		var feed atomFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return "", nil, fmt.Errorf("parse atom : %v", err)
+		}
+		for _, e := range feed.Entries {
+			entry := feedEntry{
+				guid:      strings.TrimSpace(e.ID),
+				title:     strings.TrimSpace(e.Title),
+				summary:   e.Summary,
+				published: parseFeedTime(e.Published),
+			}
+			if entry.summary == "" {
+				entry.summary = e.Content
+			}
+			if entry.published.IsZero() {
+				entry.published = parseFeedTime(e.Updated)
+			}
+			for _, c := range e.Categories {
+				entry.categories = append(entry.categories, c.Term)
+			}
+			for _, link := range e.Links {
+				switch link.Rel {
+				case "", "alternate":
+					if entry.link == "" {
+						entry.link = link.Href
+					}
+				case "enclosure":
+					entry.enclosures = append(entry.enclosures, [2]string{link.Href, link.Type})
+				}
+			}
+			entries = append(entries, entry)
+		}
+		return feed.Title, entries, nil
+	}
+	return "", nil, fmt.Errorf("unknown feed format : %v", root.XMLName.Local)
+}
+
+// FeedID returns the minimum id of feed entries published at t.
+// the id of an entry is the published time in milliseconds since unix epoch in the upper bits and the hash of GUID in the lower 16 bits.
+func FeedID(t time.Time) int64 {
+	return MastodonID(t)
+}
+
+// feedEntryID returns the id of the entry published at t.
+func feedEntryID(guid string, t time.Time) int64 {
+	h := fnv.New32a()
+	h.Write([]byte(guid))
+	return FeedID(t) | int64(h.Sum32()&0xffff)
+}
+
+// FeedIDStore persists the ids of feed entries without date.
+// Get returns ok false if the GUID is not stored.
+type FeedIDStore interface {
+	Get(guid string) (id int64, ok bool, err error)
+	Set(guid string, id int64) error
+}
+
+// FeedSource is entries of RSS or Atom feed.
+// the feed is requested with ETag and Last-Modified and the entries of the last response are reused if not modified.
+// entries are identified by GUID (or link). an entry keeps its id while it is in the feed even if it is published again,
+// and entries without date are regarded as published when they are found first.
+// the ids of entries without date are kept in IDs if set, otherwise they are posted again after restart.
+// the client of Fetch is ignored and Client is used instead.
+type FeedSource struct {
+	URL    string
+	Client *http.Client
+	IDs    FeedIDStore
+
+	mu           sync.Mutex
+	etag         string
+	lastModified string
+	title        string
+	// tweets is the entries of the last response which order is new to old.
+	tweets []twitter.Tweet
+	// ids is the ids of GUIDs in the last response.
+	ids map[string]int64
+}
+
+// Fetch fetches a page of entries. the feed is requested only for the newest page.
+// the response is nil if the page is served from the entries of the last response.
+func (s *FeedSource) Fetch(ctx context.Context, _ *twitter.Client, params *PageParams) ([]twitter.Tweet, *http.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var resp *http.Response
+	if params.MaxID == 0 || s.ids == nil {
+		var err error
+		if resp, err = s.update(ctx); err != nil {
+			return nil, resp, err
+		}
+	}
+
+	var page []twitter.Tweet
+	for _, tweet := range s.tweets {
+		if (params.MaxID == 0 || tweet.ID <= params.MaxID) && tweet.ID > params.SinceID && len(page) < params.Count {
+			page = append(page, tweet)
+		}
+	}
+	return page, resp, nil
+}
+
+// update requests the feed and updates the entries if modified. the response is nil if not modified.
+func (s *FeedSource) update(ctx context.Context) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	if s.lastModified != "" {
+		req.Header.Set("If-Modified-Since", s.lastModified)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return nil, nil
+	case resp.StatusCode >= 300:
+		return resp, fmt.Errorf("request to %v : %v", s.URL, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp, err
+	}
+	title, entries, err := parseFeed(data)
+	if err != nil {
+		return resp, err
+	}
+	s.title = title
+	if err = s.setEntries(entries); err != nil {
+		return resp, err
+	}
+	// the feed is requested again if the entries are not set.
+	s.etag, s.lastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	return resp, nil
+}
+
+// setEntries converts entries to tweets. duplicated GUIDs are dropped.
+func (s *FeedSource) setEntries(entries []feedEntry) error {
+	now := time.Now()
+	ids := make(map[string]int64, len(entries))
+	tweets := make([]twitter.Tweet, 0, len(entries))
+	for i := range entries {
+		entry := &entries[i]
+		if entry.guid == "" {
+			entry.guid = entry.link
+		}
+		if entry.guid == "" {
+			entry.guid = entry.title
+		}
+		if _, ok := ids[entry.guid]; ok {
+			continue
+		}
+		id, ok := s.ids[entry.guid]
+		if !ok {
+			var err error
+			if id, err = s.entryID(entry, now); err != nil {
+				return err
+			}
+		}
+		ids[entry.guid] = id
+		tweets = append(tweets, s.tweet(entry, id))
+	}
+	sort.Slice(tweets, func(i, j int) bool { return tweets[i].ID > tweets[j].ID })
+	s.tweets, s.ids = tweets, ids
+	return nil
+}
+
+// entryID returns the id of the entry not in the last response. the entry without date is published at now unless stored in IDs.
+func (s *FeedSource) entryID(entry *feedEntry, now time.Time) (int64, error) {
+	if !entry.published.IsZero() {
+		return feedEntryID(entry.guid, entry.published), nil
+	}
+	if s.IDs == nil {
+		return feedEntryID(entry.guid, now), nil
+	}
+	id, ok, err := s.IDs.Get(entry.guid)
+	if err != nil {
+		return 0, fmt.Errorf("get id of %v : %v", entry.guid, err)
+	} else if ok {
+		return id, nil
+	}
+	id = feedEntryID(entry.guid, now)
+	if err = s.IDs.Set(entry.guid, id); err != nil {
+		return 0, fmt.Errorf("set id of %v : %v", entry.guid, err)
+	}
+	return id, nil
+}
+
+// feedMediaTypes maps the prefix of mime type of enclosures to the type of twitter media.
+var feedMediaTypes = map[string]string{
+	"image/": "photo",
+	"video/": "video",
+}
+
+// tweet converts the entry. the text is the title and the plain text of the summary, the link is in urls,
+// categories are hashtags and enclosures of images and videos are media.
+func (s *FeedSource) tweet(entry *feedEntry, id int64) twitter.Tweet {
+	text := entry.title
+	if summary := strings.TrimSpace(htmlText(entry.summary)); summary != "" {
+		text += "\n\n" + summary
+	}
+	tweet := twitter.Tweet{
+		ID:        id,
+		IDStr:     strconv.FormatInt(id, 10),
+		Text:      text,
+		CreatedAt: time.Unix(0, (id>>16)*int64(time.Millisecond)).UTC().Format(time.RubyDate),
+		User:      &twitter.User{Name: s.title},
+		Entities:  &twitter.Entities{},
+	}
+	if u, err := url.Parse(s.URL); err == nil {
+		tweet.User.ScreenName = u.Host
+	}
+	if entry.link != "" {
+		tweet.Entities.Urls = []twitter.URLEntity{{URL: entry.link, ExpandedURL: entry.link, DisplayURL: entry.link}}
+	}
+	for _, category := range entry.categories {
+		if category = strings.TrimSpace(category); category != "" {
+			tweet.Entities.Hashtags = append(tweet.Entities.Hashtags, twitter.HashtagEntity{Text: category})
+		}
+	}
+	for _, enclosure := range entry.enclosures {
+		for prefix, typ := range feedMediaTypes {
+			if !strings.HasPrefix(enclosure[1], prefix) {
+				continue
+			}
+			media := twitter.MediaEntity{Type: typ, MediaURLHttps: enclosure[0]}
+			if tweet.ExtendedEntities == nil {
+				tweet.ExtendedEntities = &twitter.ExtendedEntity{}
+				tweet.Entities.Media = []twitter.MediaEntity{media}
+			}
+			tweet.ExtendedEntities.Media = append(tweet.ExtendedEntities.Media, media)
+		}
+	}
+	return tweet
+}
+
+// link returns the title and the link of the entry of the id. ok is false if the entry is not in the last response.
+func (s *FeedSource) link(id int64) (title, link string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.tweets {
+		if tweet := &s.tweets[i]; tweet.ID == id {
+			if len(tweet.Entities.Urls) > 0 {
+				link = tweet.Entities.Urls[0].ExpandedURL
+			}
+			title = tweet.Text
+			if idx := strings.Index(title, "\n\n"); idx >= 0 {
+				title = title[:idx]
+			}
+			return title, link, true
+		}
+	}
+	return "", "", false
+}
+
+// MinID returns the minimum id of entries published at t.
+func (s *FeedSource) MinID(t time.Time) int64 {
+	return FeedID(t)
+}
+
+// String returns feed
+func (s *FeedSource) String() string {
+	return fmt.Sprintf("feed(%v)", s.URL)
+}
+
+// maxLinkTitle is the max length of the title of link tweets in runes. the link is shortened to 23 characters by Twitter.
+const maxLinkTitle = 200
+
+// feedPoster posts entries of the feed as link tweets.
+type feedPoster struct {
+	client *twitter.Client
+	source *FeedSource
+}
+
+// NewFeedPoster creates Retweeter which posts the entries of source as tweets of the title and the link by the account of client.
+// Unretweet does nothing because entries are never retweeted.
+func NewFeedPoster(client *twitter.Client, source *FeedSource) Retweeter {
+	return &feedPoster{client: client, source: source}
+}
+
+// Retweet posts the entry of the id.
+func (p *feedPoster) Retweet(ctx context.Context, id int64) error {
+	title, link, ok := p.source.link(id)
+	if !ok {
+		return &ClassifiedError{Class: TweetDeleted, Err: fmt.Errorf("entry (%d) is not in %v", id, p.source)}
+	}
+	if runes := []rune(title); len(runes) > maxLinkTitle {
+		title = string(runes[:maxLinkTitle-1]) + "…"
+	}
+	status := strings.TrimSpace(title + " " + link)
+
+	var resp *http.Response
+	err := DefaultRetryPolicy.Do(ctx, func() (_ *http.Response, err error) {
+		_, resp, err = p.client.Statuses.Update(status, nil)
+		return resp, err
+	})
+	if err != nil && err == ctx.Err() {
+		return err
+	}
+
+	// twitter.APIError is not reliable when error response body format from twitter is not valid.
+	if err == nil && resp.StatusCode >= 300 {
+		err = fmt.Errorf("request to update status : %v", resp.Status)
+	}
+	if hasCode(err, codeDuplicateStatus) {
+		// the entry is already posted. the code means a duplicate only for statuses/update.
+		cerr := Classify(resp, err)
+		cerr.Class = AlreadyRetweeted
+		return cerr
+	}
+	return classifyError(resp, err)
+}
+
+// Unretweet does nothing.
+func (p *feedPoster) Unretweet(ctx context.Context, id int64) error {
+	return nil
+}
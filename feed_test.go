@@ -0,0 +1,256 @@
+package twilter
+
+import (
+	"context"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/kawasin73/twilter/twittertest"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeFeedHandler serves feeds from testdata with ETag.
+type fakeFeedHandler struct {
+	// bodies overrides the file of the path.
+	bodies map[string]string
+}
+
+func (h *fakeFeedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, ok := h.bodies[r.URL.Path]
+	if !ok {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", strings.TrimPrefix(r.URL.Path, "/")))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body = string(data)
+	}
+	etag := `"` + strconv.Itoa(len(body)) + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", "Sat, 16 Feb 2019 12:00:00 GMT")
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(body))
+}
+
+// newFakeFeed starts twittertest.Server which serves feeds of blog.example.com by fakeFeedHandler.
+func newFakeFeed(t *testing.T) (*twittertest.Server, *fakeFeedHandler) {
+	server := twittertest.NewServer()
+	feeds := &fakeFeedHandler{bodies: map[string]string{}}
+	server.Handle("/feed.", feeds)
+	return server, feeds
+}
+
+func TestFeedSource(t *testing.T) {
+	server, _ := newFakeFeed(t)
+	defer server.Close()
+	source := &FeedSource{URL: "https://blog.example.com/feed.rss", Client: server.Client()}
+	ctx := context.Background()
+
+	tweets, _, err := source.Fetch(ctx, nil, &PageParams{Count: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tweets) != 4 {
+		// the second post-2 is the duplicate.
+		t.Fatalf("len(tweets) = %v", len(tweets))
+	}
+
+	golang, err := NewExprFilter(`contains(entities.hashtags, "golang")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters := []Filter{PhotoFilter{}, VideoFilter{}, RTFilter{}, golang}
+	for _, test := range []struct {
+		text    string
+		created time.Time
+		matched []bool
+	}{
+		{"Release 1.2\n\nnew features & fixes", time.Date(2019, 2, 16, 12, 0, 0, 0, time.UTC), []bool{false, false, false, true}},
+		{"Photos of the meetup\n\nphotos", time.Date(2019, 2, 16, 11, 0, 0, 0, time.UTC), []bool{true, false, false, false}},
+		{"Talk video", time.Date(2019, 2, 16, 10, 0, 0, 0, time.UTC), []bool{false, true, false, false}},
+		{"Hello\n\nfirst post", time.Date(2019, 2, 16, 9, 0, 0, 0, time.UTC), []bool{false, false, false, false}},
+	} {
+		tweet := tweets[0]
+		tweets = tweets[1:]
+		if tweet.Text != test.text {
+			t.Errorf("tweet (%d) : text = %q", tweet.ID, tweet.Text)
+		}
+		if created, err := tweet.CreatedAtTime(); err != nil || !created.Equal(test.created) {
+			t.Errorf("tweet (%d) : created_at = %q", tweet.ID, tweet.CreatedAt)
+		}
+		if tweet.ID < FeedID(test.created) || tweet.ID >= FeedID(test.created.Add(time.Millisecond)) {
+			t.Errorf("tweet (%d) : id is not in %v", tweet.ID, test.created)
+		}
+		if tweet.User.Name != "Example Blog" || len(tweet.Entities.Urls) != 1 {
+			t.Errorf("tweet (%d) : user = %+v, urls = %+v", tweet.ID, tweet.User, tweet.Entities.Urls)
+		}
+		for i, f := range filters {
+			if matched := f.Match(&tweet); matched != test.matched[i] {
+				t.Errorf("tweet (%d) : %v = %v", tweet.ID, f, matched)
+			}
+		}
+	}
+
+	// not modified
+	tweets, _, err = source.Fetch(ctx, nil, &PageParams{Count: 2})
+	if err != nil || len(tweets) != 2 {
+		t.Fatalf("Fetch() = %v, %v", len(tweets), err)
+	}
+	requests := server.Requests()
+	if len(requests) != 2 || requests[1].Header.Get("If-None-Match") == "" || requests[1].Header.Get("If-Modified-Since") != "Sat, 16 Feb 2019 12:00:00 GMT" {
+		t.Errorf("requests = %+v", requests)
+	}
+
+	// older pages are served without requests.
+	older, resp, err := source.Fetch(ctx, nil, &PageParams{MaxID: tweets[1].ID - 1, Count: 2})
+	if err != nil || resp != nil || len(older) != 2 || older[0].Text != "Talk video" || len(server.Requests()) != 2 {
+		t.Errorf("Fetch(MaxID) = %v, %v, %v, requests = %v", older, resp, err, len(server.Requests()))
+	}
+}
+
+func TestFeedAtom(t *testing.T) {
+	server, _ := newFakeFeed(t)
+	defer server.Close()
+	source := &FeedSource{URL: "https://atom.example.com/feed.atom", Client: server.Client()}
+
+	tweets, _, err := source.Fetch(context.Background(), nil, &PageParams{Count: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tweets) != 2 {
+		t.Fatalf("len(tweets) = %v", len(tweets))
+	}
+	if release := tweets[0]; release.Text != "Release 1.2\n\nnew features" || release.Entities.Urls[0].ExpandedURL != "https://atom.example.com/release-1.2" || release.Entities.Hashtags[0].Text != "golang" {
+		t.Errorf("release = %+v", release)
+	}
+	// published is missing and updated is used.
+	if meetup := tweets[1]; meetup.Text != "Meetup\n\nphotos of the meetup" || !(PhotoFilter{}).Match(&meetup) || meetup.ID < FeedID(time.Date(2019, 2, 16, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("meetup = %+v", meetup)
+	}
+}
+
+func TestFeedDedupe(t *testing.T) {
+	server, feeds := newFakeFeed(t)
+	defer server.Close()
+	source := &FeedSource{URL: "https://blog.example.com/feed.xml", Client: server.Client()}
+	ctx := context.Background()
+
+	feeds.bodies["/feed.xml"] = `<rss><channel><title>t</title>
+<item><title>a</title><guid>a</guid><pubDate>Sat, 16 Feb 2019 10:00:00 +0000</pubDate></item>
+<item><title>no date</title><guid>b</guid></item>
+</channel></rss>`
+	first, _, err := source.Fetch(ctx, nil, &PageParams{Count: 200})
+	if err != nil || len(first) != 2 {
+		t.Fatalf("Fetch() = %v, %v", first, err)
+	}
+
+	// a is published again and c is new.
+	feeds.bodies["/feed.xml"] = `<rss><channel><title>t</title>
+<item><title>c</title><guid>c</guid><pubDate>Sat, 16 Feb 2019 11:00:00 +0000</pubDate></item>
+<item><title>a (edited)</title><guid>a</guid><pubDate>Sat, 16 Feb 2019 12:00:00 +0000</pubDate></item>
+<item><title>no date</title><guid>b</guid></item>
+</channel></rss>`
+	second, _, err := source.Fetch(ctx, nil, &PageParams{Count: 200})
+	if err != nil || len(second) != 3 {
+		t.Fatalf("Fetch() = %v, %v", second, err)
+	}
+	ids := map[string]int64{}
+	for _, tweet := range second {
+		ids[strings.TrimSuffix(tweet.Text, " (edited)")] = tweet.ID
+	}
+	if ids["a"] != first[1].ID || ids["no date"] != first[0].ID {
+		t.Errorf("ids changed : first = %v, %v, second = %v", first[0].ID, first[1].ID, ids)
+	}
+
+	// only c is new since the last checkpoint.
+	newer, _, err := source.Fetch(ctx, nil, &PageParams{SinceID: first[0].ID, Count: 200})
+	if err != nil || len(newer) != 0 {
+		t.Errorf("Fetch(SinceID) = %v, %v", newer, err)
+	}
+	newer, _, err = source.Fetch(ctx, nil, &PageParams{SinceID: first[1].ID, Count: 200})
+	if err != nil || len(newer) != 2 || newer[0].Text != "no date" || newer[1].Text != "c" {
+		t.Errorf("Fetch(SinceID) = %v, %v", newer, err)
+	}
+}
+
+// memFeedIDStore is FeedIDStore in memory.
+type memFeedIDStore map[string]int64
+
+func (s memFeedIDStore) Get(guid string) (int64, bool, error) {
+	id, ok := s[guid]
+	return id, ok, nil
+}
+
+func (s memFeedIDStore) Set(guid string, id int64) error {
+	s[guid] = id
+	return nil
+}
+
+func TestFeedRestart(t *testing.T) {
+	server, feeds := newFakeFeed(t)
+	defer server.Close()
+	feeds.bodies["/feed.xml"] = `<rss><channel><title>t</title>
+<item><title>a</title><guid>a</guid><pubDate>Sat, 16 Feb 2019 10:00:00 +0000</pubDate></item>
+<item><title>no date</title><guid>b</guid></item>
+</channel></rss>`
+	store := memFeedIDStore{}
+	ctx := context.Background()
+
+	source := &FeedSource{URL: "https://blog.example.com/feed.xml", Client: server.Client(), IDs: store}
+	first, _, err := source.Fetch(ctx, nil, &PageParams{Count: 200})
+	if err != nil || len(first) != 2 || first[0].Text != "no date" {
+		t.Fatalf("Fetch() = %v, %v", first, err)
+	}
+	checkpoint := first[0].ID
+	time.Sleep(2 * time.Millisecond)
+
+	// the entry without date keeps its id in the source created after restart.
+	restarted := &FeedSource{URL: "https://blog.example.com/feed.xml", Client: server.Client(), IDs: store}
+	newer, _, err := restarted.Fetch(ctx, nil, &PageParams{SinceID: checkpoint, Count: 200})
+	if err != nil || len(newer) != 0 {
+		t.Errorf("Fetch(SinceID) = %v, %v", newer, err)
+	}
+}
+
+func TestFeedPoster(t *testing.T) {
+	server, _ := newFakeFeed(t)
+	defer server.Close()
+	server.SetSelf(twitter.User{ID: 1, ScreenName: "dummy"})
+	source := &FeedSource{URL: "https://blog.example.com/feed.rss", Client: server.Client()}
+	ctx := context.Background()
+
+	tweets, _, err := source.Fetch(ctx, nil, &PageParams{Count: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	poster := NewFeedPoster(twitter.NewClient(server.Client()), source)
+	if err := poster.Retweet(ctx, tweets[0].ID); err != nil {
+		t.Errorf("Retweet() = %v", err)
+	}
+	// the first request is the feed.
+	requests := server.Requests()[1:]
+	if requests[0].Method != http.MethodPost || requests[0].Path != twittertest.UpdatePath || requests[0].Query.Get("status") != "Release 1.2 https://blog.example.com/posts/release-1.2" {
+		t.Errorf("request = %+v", requests[0])
+	}
+
+	// the duplicate status is regarded as already retweeted.
+	err = poster.Retweet(ctx, tweets[0].ID)
+	if cerr, ok := err.(*ClassifiedError); !ok || cerr.Class != AlreadyRetweeted {
+		t.Errorf("Retweet() = %v", err)
+	}
+	err = poster.Retweet(ctx, 1)
+	if cerr, ok := err.(*ClassifiedError); !ok || cerr.Class != TweetDeleted {
+		t.Errorf("Retweet() = %v", err)
+	}
+	if err := poster.Unretweet(ctx, tweets[0].ID); err != nil || len(server.Requests()) != 3 {
+		t.Errorf("Unretweet() = %v, requests = %v", err, server.Requests())
+	}
+}
@@ -0,0 +1,192 @@
+package twilter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// archiveNumberFields are fields which Twitter data export writes as strings instead of numbers.
+var archiveNumberFields = map[string]bool{
+	"id":                    true,
+	"favorite_count":        true,
+	"retweet_count":         true,
+	"in_reply_to_status_id": true,
+	"in_reply_to_user_id":   true,
+	"source_status_id":      true,
+	"source_user_id":        true,
+	"indices":               true,
+	"display_text_range":    true,
+	"w":                     true,
+	"h":                     true,
+}
+
+// normalizeArchive converts numbers written as strings in the tweet of data export to numbers.
+func normalizeArchive(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if archiveNumberFields[key] {
+				v[key] = archiveNumber(value)
+			} else {
+				v[key] = normalizeArchive(value)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeArchive(v[i])
+		}
+	}
+	return v
+}
+
+// archiveNumber converts the string (or strings of the array) to json.Number if it is an integer.
+func archiveNumber(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return json.Number(v)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = archiveNumber(v[i])
+		}
+	}
+	return v
+}
+
+// decodeTweet decodes a tweet object of v1.1 or of data export which may be wrapped as {"tweet": {...}}.
+func decodeTweet(data []byte) (twitter.Tweet, error) {
+	var tweet twitter.Tweet
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return tweet, err
+	}
+	if m, ok := v.(map[string]interface{}); ok && len(m) == 1 {
+		if wrapped, ok := m["tweet"]; ok {
+			v = wrapped
+		}
+	}
+	data, err := json.Marshal(normalizeArchive(v))
+	if err != nil {
+		return tweet, err
+	}
+	err = json.Unmarshal(data, &tweet)
+	return tweet, err
+}
+
+// parseTweetFile parses tweet.js (or tweets.js) of Twitter data export, a JSON array of tweets or JSONL of tweets.
+// returned tweets are ordered new to old.
+func parseTweetFile(data []byte) ([]twitter.Tweet, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("window.")) {
+		// data export is "window.YTD.tweet.part0 = [...]"
+		idx := bytes.IndexByte(data, '=')
+		if idx < 0 {
+			return nil, fmt.Errorf("data export has no array of tweets")
+		}
+		data = bytes.TrimSpace(data[idx+1:])
+	}
+
+	var tweets []twitter.Tweet
+	if bytes.HasPrefix(data, []byte("[")) {
+		var values []json.RawMessage
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			tweet, err := decodeTweet(value)
+			if err != nil {
+				return nil, fmt.Errorf("tweet %d : %v", i, err)
+			}
+			tweets = append(tweets, tweet)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		// a line can be a large tweet object
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			tweet, err := decodeTweet(scanner.Bytes())
+			if err != nil {
+				return nil, fmt.Errorf("line %d : %v", line, err)
+			}
+			tweets = append(tweets, tweet)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range tweets {
+		if tweets[i].ID == 0 {
+			tweets[i].ID, _ = strconv.ParseInt(tweets[i].IDStr, 10, 64)
+		}
+		if tweets[i].IDStr == "" {
+			tweets[i].IDStr = strconv.FormatInt(tweets[i].ID, 10)
+		}
+	}
+	sort.SliceStable(tweets, func(i, j int) bool { return tweets[i].ID > tweets[j].ID })
+	return tweets, nil
+}
+
+// FileSource is tweets of a file without network access. the file is tweet.js (or tweets.js) of Twitter data export,
+// a JSON array of tweet objects of v1.1 or JSONL of them. it is read at the first Fetch.
+// tweets of data export have no user and retweets of them are only texts of "RT @<screen_name>: ...".
+// use it with Loader to run filters over the file in the same way as live Sources. no response is returned from Fetch.
+type FileSource struct {
+	Path string
+
+	once   sync.Once
+	tweets []twitter.Tweet
+	err    error
+}
+
+// Fetch fetches a page of tweets of the file. client is not used.
+func (s *FileSource) Fetch(ctx context.Context, _ *twitter.Client, params *PageParams) ([]twitter.Tweet, *http.Response, error) {
+	s.once.Do(func() {
+		var data []byte
+		if data, s.err = ioutil.ReadFile(s.Path); s.err == nil {
+			s.tweets, s.err = parseTweetFile(data)
+		}
+	})
+	if s.err != nil {
+		return nil, nil, fmt.Errorf("read %v : %v", s.Path, s.err)
+	}
+
+	var page []twitter.Tweet
+	for i := range s.tweets {
+		tweet := &s.tweets[i]
+		if (params.MaxID != 0 && tweet.ID > params.MaxID) || tweet.ID <= params.SinceID {
+			continue
+		}
+		if params.IncludeRetweets != nil && !*params.IncludeRetweets && (tweet.RetweetedStatus != nil || strings.HasPrefix(tweet.FullText+tweet.Text, "RT @")) {
+			continue
+		}
+		if params.ExcludeReplies != nil && *params.ExcludeReplies && tweet.InReplyToStatusID != 0 {
+			continue
+		}
+		if page = append(page, *tweet); len(page) >= params.Count {
+			break
+		}
+	}
+	return page, nil, nil
+}
+
+// String returns file
+func (s *FileSource) String() string {
+	return fmt.Sprintf("file(%v)", s.Path)
+}
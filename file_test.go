@@ -0,0 +1,83 @@
+package twilter
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileSourceArchive(t *testing.T) {
+	source := &FileSource{Path: filepath.Join("testdata", "tweet.js")}
+	ctx := context.Background()
+
+	// tweets of data export are older than the fallback.
+	tweets, _, err := NewSourceLoader(source, nil).Load(ctx, nil, 0, []Filter{AllFilter{}})
+	if err != nil || len(tweets) != 0 {
+		t.Errorf("Load() with fallback = %v, %v", len(tweets), err)
+	}
+
+	loader := NewSourceLoader(source, &LoaderOption{Size: 2, Fallback: -1})
+	it := loader.Stream(ctx, nil, 0, []Filter{AllFilter{}})
+	var ids []int64
+	for it.Next() {
+		ids = append(ids, it.Tweet().ID)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int64{1096765000000000001, 1096765000000000002, 1096765000000000003, 1096765000000000004}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("ids = %v", ids)
+	}
+	if stats := it.Stats(); stats.Scanned != 4 || it.Checkpoint() != 1096765000000000004 {
+		t.Errorf("stats = %+v, checkpoint = %v", stats, it.Checkpoint())
+	}
+
+	tweets, _, err = source.Fetch(ctx, nil, &PageParams{Count: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, art, photo, rt := tweets[0], tweets[1], tweets[2], tweets[3]
+	if reply.InReplyToStatusID != 1096764000000000000 || reply.InReplyToUserID != 30 || tweetEntities(&reply).UserMentions[0].ID != 30 {
+		t.Errorf("reply = %+v", reply)
+	}
+	if art.FavoriteCount != 12 || art.RetweetCount != 2 || tweetEntities(&art).Hashtags[0].Indices != [2]int{10, 14} || art.DisplayTextRange != [2]int{0, 14} {
+		t.Errorf("art = %+v", art)
+	}
+	if !(PhotoFilter{}).Match(&photo) || photo.ExtendedEntities.Media[0].Sizes.Large.Width != 2048 {
+		t.Errorf("photo = %+v", photo.ExtendedEntities)
+	}
+	if _, err := rt.CreatedAtTime(); err != nil || rt.IDStr != "1096765000000000001" {
+		t.Errorf("rt = %+v", rt)
+	}
+
+	// retweets of data export are judged by the text.
+	tweets, _, err = source.Fetch(ctx, nil, &PageParams{Count: 200, IncludeRetweets: &falseValue, ExcludeReplies: &trueValue})
+	if err != nil || len(tweets) != 2 || tweets[0].ID != art.ID || tweets[1].ID != photo.ID {
+		t.Errorf("Fetch(rts=false, replies=false) = %v, %v", tweets, err)
+	}
+}
+
+func TestFileSourceJSONL(t *testing.T) {
+	ctx := context.Background()
+	params := &PageParams{MaxID: 1096765100000000004, SinceID: 1096765100000000001, Count: 200}
+
+	array, resp, err := (&FileSource{Path: filepath.Join("testdata", "v1_user_timeline.json")}).Fetch(ctx, nil, params)
+	if err != nil || resp != nil {
+		t.Fatalf("Fetch() = %v, %v", resp, err)
+	}
+	lines, _, err := (&FileSource{Path: filepath.Join("testdata", "user_timeline.jsonl")}).Fetch(ctx, nil, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(array) != 3 || array[0].ID != 1096765100000000004 || array[2].ID != 1096765100000000002 {
+		t.Errorf("array = %v", array)
+	}
+	if !reflect.DeepEqual(array, lines) {
+		t.Errorf("tweets of JSONL differ from JSON array")
+	}
+
+	if _, _, err := (&FileSource{Path: filepath.Join("testdata", "none.jsonl")}).Fetch(ctx, nil, params); err == nil {
+		t.Errorf("Fetch() of missing file succeeded")
+	}
+}
@@ -1,6 +1,7 @@
 package twilter
 
 import (
+	"context"
 	"fmt"
 	"github.com/dghubble/go-twitter/twitter"
 	"strings"
@@ -12,6 +13,124 @@ type Filter interface {
 	String() string
 }
 
+// ContextFilter filters tweets with context.
+// unlike Filter, Match can fail and can be cancelled, so it can make I/O calls.
+type ContextFilter interface {
+	Match(ctx context.Context, tweet *twitter.Tweet) (bool, error)
+	String() string
+}
+
+// FromContextFilter converts ContextFilter to Filter.
+// Loader and MatchContext call the ContextFilter with context and return its error
+// even if it is nested in NotFilter, AndFilter or OrFilter.
+// Match of the returned Filter uses background context and treats error as not matched.
+func FromContextFilter(f ContextFilter) Filter {
+	return contextFilter{filter: f}
+}
+
+// contextFilter adapts ContextFilter to Filter.
+type contextFilter struct {
+	filter ContextFilter
+}
+
+// Match calls ContextFilter with background context.
+func (f contextFilter) Match(tweet *twitter.Tweet) bool {
+	matched, err := f.filter.Match(context.Background(), tweet)
+	return err == nil && matched
+}
+
+// Prepare prepares ContextFilter
+func (f contextFilter) Prepare(ctx context.Context, tweets []twitter.Tweet) error {
+	if p, ok := f.filter.(Preparer); ok {
+		return p.Prepare(ctx, tweets)
+	}
+	return nil
+}
+
+// String returns String of ContextFilter
+func (f contextFilter) String() string {
+	return f.filter.String()
+}
+
+// ToContextFilter converts Filter to ContextFilter.
+func ToContextFilter(f Filter) ContextFilter {
+	if cf, ok := f.(contextFilter); ok {
+		return cf.filter
+	}
+	return filterContext{filter: f}
+}
+
+// filterContext adapts Filter to ContextFilter.
+type filterContext struct {
+	filter Filter
+}
+
+// Match calls MatchContext
+func (f filterContext) Match(ctx context.Context, tweet *twitter.Tweet) (bool, error) {
+	return MatchContext(ctx, f.filter, tweet)
+}
+
+// String returns String of Filter
+func (f filterContext) String() string {
+	return f.filter.String()
+}
+
+// MatchContext matches tweet by f.
+// ContextFilters in f are called with ctx and the error is returned.
+func MatchContext(ctx context.Context, f Filter, tweet *twitter.Tweet) (bool, error) {
+	switch f := f.(type) {
+	case contextFilter:
+		return f.filter.Match(ctx, tweet)
+
+	case NotFilter:
+		matched, err := MatchContext(ctx, f.Original, tweet)
+		if err != nil {
+			return false, err
+		}
+		return !matched, nil
+
+	case AndFilter:
+		if len(f.Filters) == 0 {
+			return false, nil
+		}
+		for _, ff := range f.Filters {
+			if matched, err := MatchContext(ctx, ff, tweet); err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+
+	case OrFilter:
+		for _, ff := range f.Filters {
+			if matched, err := MatchContext(ctx, ff, tweet); err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+
+	default:
+		return f.Match(tweet), nil
+	}
+}
+
+// Preparer is implemented by filters which can evaluate multiple tweets at once.
+// Loader calls Prepare with each page of timeline before Match is called for tweets in the page.
+type Preparer interface {
+	Prepare(ctx context.Context, tweets []twitter.Tweet) error
+}
+
+// PrepareFilters calls Prepare of all filters which implement Preparer.
+func PrepareFilters(ctx context.Context, filters []Filter, tweets []twitter.Tweet) error {
+	for _, f := range filters {
+		if p, ok := f.(Preparer); ok {
+			if err := p.Prepare(ctx, tweets); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // AllFilter pass all tweets.
 type AllFilter struct{}
 
@@ -93,7 +212,7 @@ func (_ RTFilter) String() string {
 }
 
 // QTFilter filters quoted tweets
-type QTFilter struct {}
+type QTFilter struct{}
 
 // Match ...
 func (_ QTFilter) Match(tweet *twitter.Tweet) bool {
@@ -105,8 +224,25 @@ func (_ QTFilter) String() string {
 	return "qt"
 }
 
+// SensitiveFilter filters tweets marked as possibly sensitive (content warnings of Mastodon).
+// retweets are matched by the retweeted tweet.
+type SensitiveFilter struct{}
+
+// Match ...
+func (_ SensitiveFilter) Match(tweet *twitter.Tweet) bool {
+	if tweet.RetweetedStatus != nil && tweet.RetweetedStatus.PossiblySensitive {
+		return true
+	}
+	return tweet.PossiblySensitive
+}
+
+// String returns sensitive
+func (_ SensitiveFilter) String() string {
+	return "sensitive"
+}
+
 // NotFilter return toggled result of Origin
-type NotFilter struct{
+type NotFilter struct {
 	Original Filter
 }
 
@@ -115,13 +251,18 @@ func (f NotFilter) Match(tweet *twitter.Tweet) bool {
 	return !f.Original.Match(tweet)
 }
 
+// Prepare prepares Original
+func (f NotFilter) Prepare(ctx context.Context, tweets []twitter.Tweet) error {
+	return PrepareFilters(ctx, []Filter{f.Original}, tweets)
+}
+
 // String returns not
 func (f NotFilter) String() string {
 	return fmt.Sprintf("not(%v)", f.Original)
 }
 
 // AndFilter return AND result of all filters
-type AndFilter struct{
+type AndFilter struct {
 	Filters []Filter
 }
 
@@ -138,6 +279,11 @@ func (f AndFilter) Match(tweet *twitter.Tweet) bool {
 	return true
 }
 
+// Prepare prepares all filters
+func (f AndFilter) Prepare(ctx context.Context, tweets []twitter.Tweet) error {
+	return PrepareFilters(ctx, f.Filters, tweets)
+}
+
 // String returns and
 func (f AndFilter) String() string {
 	ss := make([]string, len(f.Filters))
@@ -148,7 +294,7 @@ func (f AndFilter) String() string {
 }
 
 // OrFilter return OR result of all filters
-type OrFilter struct{
+type OrFilter struct {
 	Filters []Filter
 }
 
@@ -165,6 +311,11 @@ func (f OrFilter) Match(tweet *twitter.Tweet) bool {
 	return false
 }
 
+// Prepare prepares all filters
+func (f OrFilter) Prepare(ctx context.Context, tweets []twitter.Tweet) error {
+	return PrepareFilters(ctx, f.Filters, tweets)
+}
+
 // String returns or
 func (f OrFilter) String() string {
 	ss := make([]string, len(f.Filters))
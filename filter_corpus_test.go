@@ -0,0 +1,166 @@
+package twilter
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/kawasin73/twilter/twittertest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loadCorpus loads the golden corpus of tweets in testdata/corpus sorted by the names of the files.
+func loadCorpus(t *testing.T) ([]string, []twitter.Tweet) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "corpus", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		names  []string
+		tweets []twitter.Tweet
+	)
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tweet twitter.Tweet
+		if err = json.Unmarshal(data, &tweet); err != nil {
+			t.Fatalf("%v : %v", path, err)
+		}
+		names = append(names, strings.TrimSuffix(filepath.Base(path), ".json"))
+		tweets = append(tweets, tweet)
+	}
+	if len(tweets) == 0 {
+		t.Fatal("no tweets in corpus")
+	}
+	return names, tweets
+}
+
+// corpusServer serves the authors of the tweets in corpus for AuthorFilter.
+func corpusServer(tweets []twitter.Tweet) *twittertest.Server {
+	server := twittertest.NewServer()
+	for i := range tweets {
+		for _, tweet := range []*twitter.Tweet{&tweets[i], tweets[i].RetweetedStatus, tweets[i].QuotedStatus} {
+			if tweet != nil && tweet.User != nil {
+				server.AddUser(*tweet.User)
+			}
+		}
+	}
+	return server
+}
+
+func TestFiltersOnCorpus(t *testing.T) {
+	names, tweets := loadCorpus(t)
+	server := corpusServer(tweets)
+	defer server.Close()
+	ctx := WithClient(context.Background(), twitter.NewClient(server.Client()))
+
+	dir, err := ioutil.TempDir("", "corpus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wordsPath := filepath.Join(dir, "words.txt")
+	if err = ioutil.WriteFile(wordsPath, []byte("illustration\nイラスト\n/time ?lapse/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	words, err := LoadWordList(wordsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model := NewClassifier()
+	model.Add("new illustration of the sea #art", true)
+	model.Add("sketchbook pages and a painting of the harbor", true)
+	model.Add("timelapse of painting process #art", true)
+	model.Add("新作のイラスト描きました", true)
+	model.Add("reading the release notes of the build tools", false)
+	model.Add("notes on error handling in go this morning", false)
+	model.Add("the train is late again", false)
+	model.Add("今日のお昼ごはん", false)
+	modelPath := filepath.Join(dir, "model.json")
+	file, err := os.Create(modelPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = model.Save(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	classifier, err := NewClassifierFilter(modelPath, 0.6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exec := newHelperExecFilter(t, "echo", nil)
+	defer exec.Close()
+
+	expr := func(src string) Filter {
+		f, err := NewExprFilter(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	cache := NewUserCache(0)
+	author := func(conditions ...string) Filter {
+		f, err := NewAuthorFilter(cache, conditions...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return FromContextFilter(f)
+	}
+
+	for _, test := range []struct {
+		filter  Filter
+		matched []string
+	}{
+		{AllFilter{}, names},
+		{PhotoFilter{}, []string{"japanese", "photo", "photo_entities_only", "photos", "retweet_photo", "sensitive_photo"}},
+		{VideoFilter{}, []string{"retweet_sensitive_video", "video"}},
+		{RTFilter{}, []string{"retweet_photo", "retweet_quote", "retweet_sensitive_video"}},
+		{QTFilter{}, []string{"quote_video", "retweet_quote"}},
+		{SensitiveFilter{}, []string{"retweet_sensitive_video", "sensitive_photo"}},
+		{NotFilter{PhotoFilter{}}, []string{"gif", "link", "quote_video", "reply", "retweet_quote", "retweet_sensitive_video", "text", "video"}},
+		{AndFilter{[]Filter{PhotoFilter{}, NotFilter{RTFilter{}}}}, []string{"japanese", "photo", "photo_entities_only", "photos", "sensitive_photo"}},
+		{AndFilter{}, nil},
+		{OrFilter{[]Filter{VideoFilter{}, QTFilter{}}}, []string{"quote_video", "retweet_quote", "retweet_sensitive_video", "video"}},
+		{OrFilter{}, nil},
+		{expr("favorite_count >= 1000"), []string{"japanese", "video"}},
+		{expr(`contains(entities.hashtags, "ART")`), []string{"photo", "retweet_photo"}},
+		{expr(`user.verified && lang == "ja"`), []string{"japanese"}},
+		{expr(`contains(text, "boolean operators")`), []string{"link"}},
+		{expr("is_reply || retweeted_status.favorite_count > 2000"), []string{"reply", "retweet_sensitive_video"}},
+		{WordListFilter{words}, []string{"japanese", "photo", "retweet_photo", "video"}},
+		{BlockListFilter{words}, []string{"gif", "link", "photo_entities_only", "photos", "quote_video", "reply", "retweet_quote", "retweet_sensitive_video", "sensitive_photo", "text"}},
+		{classifier, []string{"japanese", "photo", "photos", "retweet_photo", "retweet_sensitive_video", "video"}},
+		{exec, []string{"photo", "retweet_photo"}},
+		{author("followers>=1000"), []string{"japanese", "photo", "photos", "quote_video", "retweet_photo", "retweet_quote", "retweet_sensitive_video", "video"}},
+		{author("verified"), []string{"japanese", "retweet_sensitive_video", "video"}},
+		{AndFilter{[]Filter{PhotoFilter{}, author("verified")}}, []string{"japanese"}},
+	} {
+		if err := PrepareFilters(ctx, []Filter{test.filter}, tweets); err != nil {
+			t.Errorf("%v : prepare : %v", test.filter, err)
+			continue
+		}
+		var matched []string
+		for i := range tweets {
+			ok, err := MatchContext(ctx, test.filter, &tweets[i])
+			if err != nil {
+				t.Errorf("%v : %v : %v", test.filter, names[i], err)
+			} else if ok {
+				matched = append(matched, names[i])
+			}
+		}
+		if !reflect.DeepEqual(matched, test.matched) {
+			t.Errorf("%v matched %q, expected %q", test.filter, matched, test.matched)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package twilter
+
+import (
+	"context"
+	"errors"
+	"github.com/dghubble/go-twitter/twitter"
+	"testing"
+)
+
+// errFilter is ContextFilter which fails on the tweet whose text is "error".
+type errFilter struct{}
+
+func (_ errFilter) Match(ctx context.Context, tweet *twitter.Tweet) (bool, error) {
+	if tweet.Text == "error" {
+		return false, errors.New("error")
+	}
+	return tweet.Text == "match", nil
+}
+
+func (_ errFilter) String() string {
+	return "err"
+}
+
+func TestMatchContext(t *testing.T) {
+	f := FromContextFilter(errFilter{})
+	for _, test := range []struct {
+		filter  Filter
+		text    string
+		matched bool
+		failed  bool
+	}{
+		{f, "match", true, false},
+		{f, "error", false, true},
+		{NotFilter{Original: f}, "other", true, false},
+		{NotFilter{Original: f}, "error", false, true},
+		{AndFilter{Filters: []Filter{AllFilter{}, f}}, "error", false, true},
+		{OrFilter{Filters: []Filter{AllFilter{}, f}}, "error", true, false},
+		{OrFilter{Filters: []Filter{RTFilter{}, f}}, "match", true, false},
+	} {
+		tweet := &twitter.Tweet{Text: test.text}
+		matched, err := MatchContext(context.Background(), test.filter, tweet)
+		if matched != test.matched || (err != nil) != test.failed {
+			t.Errorf("%v on %q = (%v, %v), expected (%v, failed %v)", test.filter, test.text, matched, err, test.matched, test.failed)
+		}
+	}
+
+	// Match of the adapter treats error as not matched
+	if f.Match(&twitter.Tweet{Text: "error"}) {
+		t.Errorf("adapter must not match on error")
+	}
+	// adapters are converted back
+	if _, ok := ToContextFilter(f).(errFilter); !ok {
+		t.Errorf("ToContextFilter must unwrap FromContextFilter")
+	}
+	if matched, err := ToContextFilter(RTFilter{}).Match(context.Background(), &twitter.Tweet{}); matched || err != nil {
+		t.Errorf("ToContextFilter(rt) = (%v, %v)", matched, err)
+	}
+}
@@ -3,7 +3,7 @@ module github.com/kawasin73/twilter
 go 1.12
 
 require (
-	github.com/cenkalti/backoff v2.1.1+incompatible // indirect
+	github.com/cenkalti/backoff v2.1.1+incompatible
 	github.com/dghubble/go-twitter v0.0.0-20190512073027-53f972dc4b06
 	github.com/dghubble/sling v1.2.0 // indirect
 	github.com/google/go-querystring v1.0.0 // indirect
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/dghubble/go-twitter/twitter"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -14,33 +15,64 @@ const (
 	defaultFallback  = time.Hour
 )
 
-// Loader loads all tweets and filters tweets.
+// twitterEpoch is the epoch of tweet id (Snowflake) in milliseconds.
+const twitterEpoch = 1288834974657
+
+// SnowflakeID returns the minimum tweet id posted at t.
+// tweet id has the posted time in milliseconds since twitterEpoch in the upper bits.
+// it can be used as sinceId to load tweets posted after t.
+func SnowflakeID(t time.Time) int64 {
+	ms := t.UnixNano()/int64(time.Millisecond) - twitterEpoch
+	if ms < 0 {
+		return 0
+	}
+	return ms << 22
+}
+
+// Loader loads all tweets from Source and filters tweets.
 type Loader struct {
-	screenName   string
-	userId       int64
+	source       Source
 	size         int
 	maxIteration int
 	fallback     time.Duration
+	since        time.Time
+	maxId        int64
+	params       PageParams
+	retry        *RetryPolicy
 }
 
 // LoaderOption ...
 type LoaderOption struct {
 	Size         int
 	MaxIteration int
-	Fallback     time.Duration
+	// Fallback is the duration of tweets loaded when no checkpoint. negative loads all tweets of Source (e.g. FileSource).
+	Fallback time.Duration
+	// Since loads only tweets posted after Since. Fallback is not used if Since is set.
+	Since time.Time
+	// MaxID is the upper bound (inclusive) of tweet id. no bound if 0.
+	MaxID int64
+
+	// parameters of timeline APIs. nil means the default of Source. Sources ignore parameters which API does not support.
+	IncludeRetweets *bool
+	ExcludeReplies  *bool
+	TrimUser        *bool
+
+	// Retry is the policy to retry requests to Source. DefaultRetryPolicy is used if nil.
+	Retry *RetryPolicy
 }
 
 // NewLoaderScreenName returns Loader for screenName (string)
 func NewLoaderScreenName(screenName string, option *LoaderOption) *Loader {
-	return newLoader(screenName, 0, option)
+	return NewSourceLoader(&UserTimelineSource{ScreenName: screenName}, option)
 }
 
 // NewLoader returns Loader for userId (int64)
 func NewLoader(userId int64, option *LoaderOption) *Loader {
-	return newLoader("", userId, option)
+	return NewSourceLoader(&UserTimelineSource{UserID: userId}, option)
 }
 
-func newLoader(screenName string, userId int64, option *LoaderOption) *Loader {
+// NewSourceLoader returns Loader for source
+func NewSourceLoader(source Source, option *LoaderOption) *Loader {
 	// set default options
 	if option == nil {
 		option = new(LoaderOption)
@@ -54,109 +86,424 @@ func newLoader(screenName string, userId int64, option *LoaderOption) *Loader {
 	if option.Fallback == 0 {
 		option.Fallback = defaultFallback
 	}
+	if option.Retry == nil {
+		option.Retry = DefaultRetryPolicy
+	}
 
 	return &Loader{
-		screenName:   screenName,
-		userId:       userId,
+		source:       source,
 		size:         option.Size,
 		maxIteration: option.MaxIteration,
 		fallback:     option.Fallback,
+		since:        option.Since,
+		maxId:        option.MaxID,
+		params: PageParams{
+			Count:           option.Size,
+			IncludeRetweets: option.IncludeRetweets,
+			ExcludeReplies:  option.ExcludeReplies,
+			TrimUser:        option.TrimUser,
+		},
+		retry: option.Retry,
 	}
 }
 
-// Load loads tweets since sinceId from UserTimeline API and filters tweets.
+// Source returns Source of Loader.
+func (l *Loader) Source() Source {
+	return l.source
+}
+
+// clientKey is the context key for twitter.Client.
+type clientKey struct{}
+
+// WithClient returns ctx with client.
+// Loader sets its client to ctx for ContextFilters which call twitter API.
+func WithClient(ctx context.Context, client *twitter.Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// ClientFromContext returns twitter.Client set by WithClient. returns nil if not set.
+func ClientFromContext(ctx context.Context) *twitter.Client {
+	client, _ := ctx.Value(clientKey{}).(*twitter.Client)
+	return client
+}
+
+// Load loads tweets since sinceId from Source and filters tweets.
 // params : `sinceId` : load tweets since sinceId. ignored when sinceId is 0.
 // params : `filters` : slice of filter.Filter
 // return : `tweets`  : filtered tweets by Loader.filters which order is new to old
 // return : `latest`  : lastest tweet. nil when no new tweet found.
-// return : `err`     : error from UserTimeline API
+// return : `err`     : error from Source or *FilterError
+//
+// when ContextFilter fails, Load returns *FilterError with tweets older than the failed tweet.
+// `latest` is the newest tweet older than the failed tweet, so the failed tweet is loaded again next time.
+// if ContextFilters fail on some tweets, the oldest failed tweet is reported.
+//
+// when tweets since sinceId are too many to load, Load returns *GapError with loaded tweets and `latest`.
+//
+// Load keeps all filtered tweets in memory. use Stream to handle tweets one by one and to get LoadStats.
 func (l *Loader) Load(ctx context.Context, client *twitter.Client, sinceId int64, filters []Filter) (tweets []twitter.Tweet, latest *twitter.Tweet, err error) {
-	var (
-		trueValue        = true
-		falseValue       = false
-		maxId      int64 = 0
-	)
+	it := l.Stream(ctx, client, sinceId, filters)
+	for it.Next() {
+		tweets = append(tweets, *it.Tweet())
+	}
+	if err = it.Err(); err != nil {
+		if _, ok := err.(*FilterError); !ok {
+			return nil, nil, err
+		}
+	} else if gap := it.Gap(); gap != nil {
+		err = gap
+	}
 
-	// 3200 tweets is available on User Timeline API at the most
-totalLoop:
-	for r := 0; r < l.maxIteration; r++ {
-		var (
-			timeline []twitter.Tweet
-			resp     *http.Response
-		)
-
-		// Get tweets of the user
-		// https://developer.twitter.com/en/docs/tweets/timelines/api-reference/get-statuses-user_timeline.html
-	retry:
-		timeline, resp, err = client.Timelines.UserTimeline(&twitter.UserTimelineParams{
-			ScreenName:      l.screenName,
-			UserID:          l.userId,
-			TrimUser:        &trueValue,
-			IncludeRetweets: &trueValue,
-			ExcludeReplies:  &falseValue,
-			MaxID:           maxId,
-			SinceID:         sinceId,
-			Count:           l.size,
-		})
-
-		// check rate limited
-		if limited, sleep := IsRateLimit(resp); limited {
-			timer := time.NewTimer(sleep)
-			select {
-			case <-timer.C:
-				// sleep and retry
-				goto retry
-			case <-ctx.Done():
-				timer.Stop()
-				return nil, nil, ctx.Err()
-			}
+	// reverse to new to old
+	for i, j := 0, len(tweets)-1; i < j; i, j = i+1, j-1 {
+		tweets[i], tweets[j] = tweets[j], tweets[i]
+	}
+	return tweets, it.last, err
+}
+
+// Stream returns Iterator which yields filtered tweets since sinceId oldest first.
+//
+// Iterator walks back the Source from the newest tweet to sinceId (up to MaxIteration pages) on the first Next
+// and filters each page as it arrives. pages are dropped after filtered and only matched tweets are kept
+// until they are yielded from the oldest, so each page is fetched once and tweets not matched are not kept in memory.
+func (l *Loader) Stream(ctx context.Context, client *twitter.Client, sinceId int64, filters []Filter) *Iterator {
+	checkpointed := sinceId > 0
+	if !l.since.IsZero() {
+		// tweets posted after since have larger id than SnowflakeID(since) - 1.
+		if id := l.minID(l.since) - 1; id > sinceId {
+			sinceId, checkpointed = id, false
+		}
+	}
+	return &Iterator{
+		stats:        LoadStats{Matched: make([]int, len(filters)), RateLimitRemaining: -1},
+		loader:       l,
+		ctx:          WithClient(ctx, client), // filters can call twitter API by the client.
+		client:       client,
+		sinceId:      sinceId,
+		filters:      filters,
+		checkpointed: checkpointed,
+		checkpoint:   sinceId,
+	}
+}
+
+// minID returns the minimum id of Source posted at t.
+func (l *Loader) minID(t time.Time) int64 {
+	if source, ok := l.source.(TimeIDSource); ok {
+		return source.MinID(t)
+	}
+	return SnowflakeID(t)
+}
+
+// Accepts returns whether the tweet is in the range of Since and MaxID and not excluded by the parameters of Loader.
+// tweets not loaded by Stream (e.g. tweets from streaming API) should be checked by Accepts before filters.
+func (l *Loader) Accepts(tweet *twitter.Tweet) bool {
+	if l.params.excluded(tweet) {
+		return false
+	}
+	if l.maxId > 0 && tweet.ID > l.maxId {
+		return false
+	}
+	return l.since.IsZero() || tweet.ID >= l.minID(l.since)
+}
+
+// Iterator iterates filtered tweets loaded by Loader oldest first.
+//
+//	it := loader.Stream(ctx, client, sinceId, filters)
+//	for it.Next() {
+//		retweet(it.Tweet())
+//		save(it.Checkpoint())
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//	save(it.Checkpoint())
+//
+// when ContextFilter fails, Next returns false and Err returns *FilterError.
+// Checkpoint is the tweet older than the failed tweet, so the failed tweet is loaded again next time.
+type Iterator struct {
+	loader  *Loader
+	ctx     context.Context
+	client  *twitter.Client
+	sinceId int64
+	filters []Filter
+	// checkpointed is true if sinceId is id of a loaded tweet, not converted from Since.
+	checkpointed bool
+
+	started bool
+	done    bool
+	matched []matchedTweet // matched tweets not yielded yet. new to old.
+	// failed is the error of the oldest tweet which filters failed on. returned after tweets older than it are yielded.
+	failed *FilterError
+
+	gap        *GapError
+	stats      LoadStats
+	tweet      *twitter.Tweet
+	last       *twitter.Tweet // the newest evaluated tweet older than failed
+	checkpoint int64
+	err        error
+}
+
+// matchedTweet is a tweet matched by the filter of the index.
+type matchedTweet struct {
+	tweet  twitter.Tweet
+	filter int
+}
+
+// LoadStats is statistics of loading by Iterator.
+type LoadStats struct {
+	// Pages is the number of pages fetched successfully.
+	Pages int
+	// APICalls is the number of requests to Source including retries.
+	APICalls int
+	// Scanned is the number of tweets evaluated by filters.
+	Scanned int
+	// Matched is the number of tweets matched by each filter. a tweet is counted for the first matched filter.
+	Matched []int
+	// RateLimitSleep is the time spent waiting for rate limit reset, including the wait in RateLimiter.
+	RateLimitSleep time.Duration
+	// RateLimitRemaining is X-Rate-Limit-Remaining of the last response. -1 if unknown.
+	RateLimitRemaining int
+}
+
+// Stats returns statistics of loading so far.
+func (it *Iterator) Stats() LoadStats {
+	stats := it.stats
+	stats.Matched = append([]int(nil), it.stats.Matched...)
+	return stats
+}
+
+// Next yields the next matched tweet. returns false when no more tweet or an error occurs.
+func (it *Iterator) Next() bool {
+	it.tweet = nil
+	if it.err != nil || it.done {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		if it.err = it.walkBack(); it.err != nil {
+			return false
+		}
+	}
+
+	if len(it.matched) == 0 {
+		// all tweets older than the failed tweet are yielded.
+		it.done = true
+		if it.last != nil && it.last.ID > it.checkpoint {
+			it.checkpoint = it.last.ID
+		}
+		if it.failed != nil {
+			it.err = it.failed
 		}
+		return false
+	}
+	m := &it.matched[len(it.matched)-1]
+	it.matched = it.matched[:len(it.matched)-1]
+	it.stats.Matched[m.filter]++
+	it.tweet = &m.tweet
+	it.checkpoint = m.tweet.ID
+	return true
+}
 
-		// twitter.APIError is not reliable when error response body format from twitter is not valid.
-		if err == nil && resp.StatusCode >= 300 {
-			err = fmt.Errorf("request to user timeline : %v", resp.Status)
+// walkBack loads pages from the newest to sinceId and filters them. matched tweets are kept to be yielded from the oldest.
+// if pages do not reach sinceId, the gap is recorded.
+// API excludes tweets by the parameters (see PageParams) after applying count, so a short page does not mean the end
+// while the parameters exclude tweets, and an empty page is fetched again including all tweets to walk back further.
+func (it *Iterator) walkBack() error {
+	var (
+		maxId     = it.loader.maxId
+		sinceId   = it.sinceId
+		oldestID  int64
+		full      bool
+		reached   bool
+		exhausted bool
+		r         int
+	)
+	if it.checkpointed {
+		// load the checkpoint tweet too to know whether pages reach the checkpoint.
+		sinceId--
+	}
+
+	// 3200 tweets is available on User Timeline API at the most (800 on Home Timeline API)
+	for ; r < it.loader.maxIteration; r++ {
+		page, count, err := it.fetch(maxId, sinceId, it.loader.params)
+		excluding := it.loader.params.excludes()
+		if err == nil && len(page) == 0 && excluding {
+			// all tweets counted may be excluded. Source includes all of them by default and Loader drops them.
+			all := it.loader.params
+			all.IncludeRetweets, all.ExcludeReplies = nil, nil
+			page, count, err = it.fetch(maxId, sinceId, all)
+			excluding = false
 		}
 		if err != nil {
-			return nil, nil, err
+			return err
 		}
+		if len(page) == 0 {
+			// no more tweets older. finish traversing.
+			// API returns no tweets over its limit even if older tweets exist. the previous page is full in that case.
+			exhausted = full
+			break
+		}
+		full = len(page) >= count || excluding
 
-		// set latest tweet
-		if latest == nil && len(timeline) > 0 {
-			latest = &timeline[0]
+		// remove the checkpoint tweet. pages reach sinceId if it is found.
+		n := len(page)
+		for n > 0 && page[n-1].ID <= it.sinceId {
+			n--
+		}
+		reached = reached || n < len(page)
+		if n > 0 {
+			oldestID = page[n-1].ID
+			if err = it.filterPage(page[:n]); err != nil {
+				return err
+			}
+		}
+		if reached {
+			break
 		}
 
-		for i := range timeline {
-			if sinceId == 0 {
-				// check whether tweet is older than fallback.
-				if createdAt, err := timeline[i].CreatedAtTime(); err == nil && time.Now().Add(-l.fallback).After(createdAt) {
-					// finish traversing.
-					break totalLoop
-				}
+		lastTweet := &page[len(page)-1]
+		if it.sinceId == 0 && it.loader.fallback > 0 {
+			// check whether tweet is older than fallback.
+			if createdAt, err := lastTweet.CreatedAtTime(); err == nil && time.Now().Add(-it.loader.fallback).After(createdAt) {
+				// finish traversing.
+				break
 			}
+		}
 
-			// check filters matches or not.
-			for _, f := range filters {
-				if f.Match(&timeline[i]) {
-					// copy tweet to result array
-					// not set pointer because timeline will not be GCed when next timeline search.
-					tweets = append(tweets, timeline[i])
+		// next max_id is 1 smaller than id of oldest tweet in the range.
+		maxId = lastTweet.ID - 1
+	}
+
+	if it.checkpointed && !reached && (r == it.loader.maxIteration || exhausted) {
+		it.gap = &GapError{SinceID: it.sinceId, MaxID: oldestID}
+	}
+	return nil
+}
+
+// filterPage evaluates tweets of the page which order is new to old. filters prepare the page at once.
+// when filters fail on a tweet, matched tweets newer than it are dropped to be loaded again next time.
+func (it *Iterator) filterPage(page []twitter.Tweet) error {
+	included := make([]twitter.Tweet, 0, len(page))
+	for i := range page {
+		if !it.loader.params.excluded(&page[i]) {
+			included = append(included, page[i])
+		}
+	}
+	if err := PrepareFilters(it.ctx, it.filters, included); err != nil {
+		return err
+	}
+
+	for i := range page {
+		tweet := &page[i]
+		if it.loader.params.excluded(tweet) {
+			// dropped like tweets excluded by API.
+			it.evaluated(tweet)
+			continue
+		}
+		it.stats.Scanned++
 
-					// break filters loop and check next tweet
-					break
-				}
+		if it.sinceId == 0 && it.loader.fallback > 0 {
+			// skip tweets older than fallback.
+			if createdAt, err := tweet.CreatedAtTime(); err == nil && time.Now().Add(-it.loader.fallback).After(createdAt) {
+				it.evaluated(tweet)
+				continue
 			}
 		}
 
-		if len(timeline) == 0 {
-			// no more tweets older. finish traversing.
-			break
+		// check filters matches or not.
+	filters:
+		for i, f := range it.filters {
+			matched, err := MatchContext(it.ctx, f, tweet)
+			if err != nil {
+				// stop before the failed tweet to retry it next time.
+				it.failed = &FilterError{TweetID: tweet.ID, Filter: f, Err: err}
+				it.matched, it.last = nil, nil
+				break filters
+			} else if matched {
+				it.matched = append(it.matched, matchedTweet{tweet: *tweet, filter: i})
+				break filters
+			}
+		}
+		if it.failed == nil || it.failed.TweetID != tweet.ID {
+			it.evaluated(tweet)
 		}
+	}
+	return nil
+}
 
-		lastTweet := &timeline[len(timeline)-1]
+// evaluated marks the tweet is evaluated. tweets are evaluated from the newest, so the first one is the newest.
+func (it *Iterator) evaluated(tweet *twitter.Tweet) {
+	if it.last == nil {
+		last := *tweet
+		it.last = &last
+	}
+}
 
-		// next max_id is 1 smaller than id of oldest tweet in the range.
-		maxId = lastTweet.ID - 1
+// Tweet returns the tweet matched by the last Next.
+func (it *Iterator) Tweet() *twitter.Tweet {
+	return it.tweet
+}
+
+// Gap returns GapError if tweets since sinceId are not loaded fully. it is set after the first Next.
+// tweets newer than GapError.MaxID are yielded even if the gap exists.
+func (it *Iterator) Gap() *GapError {
+	return it.gap
+}
+
+// Err returns the error which stopped the iteration. it is *FilterError when ContextFilter fails.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Checkpoint returns the id of the newest tweet evaluated including the current tweet.
+// tweets whose id is the checkpoint or less are not yielded again if the checkpoint is used as sinceId next time.
+func (it *Iterator) Checkpoint() int64 {
+	return it.checkpoint
+}
+
+// fetch fetches a page between sinceId and maxId from Source. retries by the RetryPolicy of Loader.
+// count is the number of tweets requested by Source.
+func (it *Iterator) fetch(maxId, sinceId int64, params PageParams) (page []twitter.Tweet, count int, err error) {
+	size := params.Count
+	params.MaxID, params.SinceID = maxId, sinceId
+
+	// count the time waiting for rate limit in stats.
+	policy := *it.loader.retry
+	policy.Notify = func(resp *http.Response, err error, wait time.Duration) {
+		if limited, _ := IsRateLimit(resp); limited {
+			it.stats.RateLimitSleep += wait
+		}
+		if it.loader.retry.Notify != nil {
+			it.loader.retry.Notify(resp, err, wait)
+		}
+	}
+	var resp *http.Response
+	err = policy.Do(it.ctx, func() (r *http.Response, err error) {
+		it.stats.APICalls++
+		params.Count = size
+		page, resp, err = it.loader.source.Fetch(it.ctx, it.client, &params)
+		// count the time waiting in RateLimiter too.
+		it.stats.RateLimitSleep += RateLimitWait(resp)
+		if resp != nil {
+			if remaining, err := strconv.Atoi(resp.Header.Get("X-Rate-Limit-Remaining")); err == nil {
+				it.stats.RateLimitRemaining = remaining
+			}
+		}
+		return resp, err
+	})
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		// ctx is done while waiting
+		return nil, 0, err
 	}
 
-	return tweets, latest, nil
+	// twitter.APIError is not reliable when error response body format from twitter is not valid.
+	if err == nil && resp != nil && resp.StatusCode >= 300 {
+		err = fmt.Errorf("request to %v : %v", it.loader.source, resp.Status)
+	}
+	if err != nil {
+		// callers decide how to handle the error by its class.
+		return page, 0, Classify(resp, err)
+	}
+	it.stats.Pages++
+	return page, params.Count, nil
 }
@@ -0,0 +1,346 @@
+package twilter
+
+import (
+	"context"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/kawasin73/twilter/twittertest"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSnowflakeID(t *testing.T) {
+	// tweet (1050118621198921728) was posted at 2018-10-10 20:19:24.211 UTC
+	posted := time.Date(2018, 10, 10, 20, 19, 24, 211*int(time.Millisecond), time.UTC)
+	id := SnowflakeID(posted)
+	if id > 1050118621198921728 || 1050118621198921728>>22 != id>>22 {
+		t.Errorf("SnowflakeID(%v) = %v", posted, id)
+	}
+	if id := SnowflakeID(time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)); id != 0 {
+		t.Errorf("SnowflakeID before epoch = %v", id)
+	}
+}
+
+// fakeSource is Source of tweets which order is new to old.
+type fakeSource struct {
+	tweets  []twitter.Tweet
+	fetched []PageParams
+	// limit is the number of the newest tweets available like the 3200 tweets limit of User Timeline API. no limit if 0.
+	limit int
+	// max is the max count which API accepts like 100 of Search API. no max if 0.
+	max int
+}
+
+func (s *fakeSource) Fetch(ctx context.Context, client *twitter.Client, params *PageParams) ([]twitter.Tweet, *http.Response, error) {
+	if s.max > 0 {
+		limitCount(params, s.max)
+	}
+	s.fetched = append(s.fetched, *params)
+	var page []twitter.Tweet
+	tweets := s.tweets
+	if s.limit > 0 && s.limit < len(tweets) {
+		tweets = tweets[:s.limit]
+	}
+	for _, tweet := range tweets {
+		if (params.MaxID == 0 || tweet.ID <= params.MaxID) && tweet.ID > params.SinceID && len(page) < params.Count {
+			page = append(page, tweet)
+		}
+	}
+	resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header)}
+	resp.Header.Set("X-Rate-Limit-Remaining", strconv.Itoa(900-len(s.fetched)))
+	return page, resp, nil
+}
+
+func (s *fakeSource) String() string {
+	return "fake"
+}
+
+// newFakeSource returns fakeSource with tweets of texts which ids are 101, 102, 103 ... and posted now.
+func newFakeSource(texts ...string) *fakeSource {
+	s := &fakeSource{}
+	createdAt := time.Now().Format(time.RubyDate)
+	for i := len(texts) - 1; i >= 0; i-- {
+		s.tweets = append(s.tweets, twitter.Tweet{ID: int64(101 + i), Text: texts[i], CreatedAt: createdAt})
+	}
+	return s
+}
+
+func TestLoaderStream(t *testing.T) {
+	source := newFakeSource("match", "other", "match", "match", "other")
+	loader := NewSourceLoader(source, &LoaderOption{Size: 2})
+	filters := []Filter{FromContextFilter(errFilter{})}
+
+	it := loader.Stream(context.Background(), nil, 0, filters)
+	var (
+		ids         []int64
+		checkpoints []int64
+	)
+	for it.Next() {
+		ids = append(ids, it.Tweet().ID)
+		checkpoints = append(checkpoints, it.Checkpoint())
+		// pages are dropped and only matched tweets are kept.
+		if len(it.matched) != 3-len(ids) {
+			t.Errorf("matched = %v", it.matched)
+		}
+	}
+	if it.Err() != nil {
+		t.Fatalf("err = %v", it.Err())
+	}
+	if fmt.Sprint(ids) != "[101 103 104]" || fmt.Sprint(checkpoints) != "[101 103 104]" {
+		t.Errorf("ids = %v, checkpoints = %v", ids, checkpoints)
+	}
+	if it.Checkpoint() != 105 {
+		t.Errorf("checkpoint = %v", it.Checkpoint())
+	}
+	// walk back 3 pages and an empty page. the pages are not loaded again.
+	if fmt.Sprint(source.fetched) != "[{0 0 2 <nil> <nil> <nil>} {103 0 2 <nil> <nil> <nil>} {101 0 2 <nil> <nil> <nil>} {100 0 2 <nil> <nil> <nil>}]" {
+		t.Errorf("fetched = %v", source.fetched)
+	}
+
+	stats := it.Stats()
+	if stats.Pages != 4 || stats.APICalls != 4 || stats.Scanned != 5 || fmt.Sprint(stats.Matched) != "[3]" || stats.RateLimitRemaining != 896 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// since checkpoint
+	it = loader.Stream(context.Background(), nil, 103, filters)
+	ids = nil
+	for it.Next() {
+		ids = append(ids, it.Tweet().ID)
+	}
+	if fmt.Sprint(ids) != "[104]" || it.Checkpoint() != 105 {
+		t.Errorf("since 103 : ids = %v, checkpoint = %v", ids, it.Checkpoint())
+	}
+
+	// no new tweet
+	it = loader.Stream(context.Background(), nil, 105, filters)
+	if it.Next() || it.Err() != nil || it.Checkpoint() != 105 {
+		t.Errorf("since 105 : checkpoint = %v, err = %v", it.Checkpoint(), it.Err())
+	}
+}
+
+func TestLoaderStreamFilterError(t *testing.T) {
+	source := newFakeSource("match", "other", "error", "match", "error")
+	loader := NewSourceLoader(source, &LoaderOption{Size: 2})
+	filters := []Filter{FromContextFilter(errFilter{})}
+
+	it := loader.Stream(context.Background(), nil, 0, filters)
+	var ids []int64
+	for it.Next() {
+		ids = append(ids, it.Tweet().ID)
+	}
+	ferr, ok := it.Err().(*FilterError)
+	if !ok || ferr.TweetID != 103 {
+		t.Fatalf("err = %v", it.Err())
+	}
+	if fmt.Sprint(ids) != "[101]" || it.Checkpoint() != 102 {
+		t.Errorf("ids = %v, checkpoint = %v", ids, it.Checkpoint())
+	}
+
+	// Load returns tweets and latest older than the oldest failed tweet.
+	tweets, latest, err := loader.Load(context.Background(), nil, 0, filters)
+	if _, ok := err.(*FilterError); !ok || len(tweets) != 1 || tweets[0].ID != 101 || latest == nil || latest.ID != 102 {
+		t.Errorf("Load() = %v, %v, %v", tweets, latest, err)
+	}
+}
+
+func TestLoaderLoad(t *testing.T) {
+	source := newFakeSource("match", "other", "match", "other")
+	// the oldest tweet is older than fallback
+	source.tweets[3].CreatedAt = time.Now().Add(-2 * time.Hour).Format(time.RubyDate)
+	loader := NewSourceLoader(source, &LoaderOption{Size: 2, Fallback: time.Hour})
+
+	tweets, latest, err := loader.Load(context.Background(), nil, 0, []Filter{FromContextFilter(errFilter{})})
+	if err != nil {
+		t.Fatalf("err = %v", err)
+	}
+	if len(tweets) != 1 || tweets[0].ID != 103 || latest == nil || latest.ID != 104 {
+		t.Errorf("Load() = %v, %v", tweets, latest)
+	}
+	// stop walking back at the tweet older than fallback
+	if len(source.fetched) != 2 {
+		t.Errorf("fetched = %v", source.fetched)
+	}
+}
+
+func TestLoaderStreamGap(t *testing.T) {
+	texts := []string{"match", "match", "match", "match", "match", "match", "match", "match", "match", "match"}
+	for _, test := range []struct {
+		name    string
+		option  LoaderOption
+		limit   int
+		deleted int64
+		sinceId int64
+		gap     string
+		ids     string
+		fetched int
+	}{
+		{"max iteration", LoaderOption{Size: 2, MaxIteration: 2}, 0, 0, 101, "101-107", "[107 108 109 110]", 2},
+		{"api limit", LoaderOption{Size: 2}, 4, 0, 101, "101-107", "[107 108 109 110]", 3},
+		{"reached", LoaderOption{Size: 2, MaxIteration: 3}, 0, 0, 105, "", "[106 107 108 109 110]", 3},
+		{"checkpoint deleted", LoaderOption{Size: 2}, 0, 105, 105, "", "[106 107 108 109 110]", 4},
+	} {
+		source := newFakeSource(texts...)
+		source.limit = test.limit
+		if test.deleted != 0 {
+			source.tweets = append(source.tweets[:110-test.deleted], source.tweets[111-test.deleted:]...)
+		}
+		it := NewSourceLoader(source, &test.option).Stream(context.Background(), nil, test.sinceId, []Filter{FromContextFilter(errFilter{})})
+		var ids []int64
+		for it.Next() {
+			ids = append(ids, it.Tweet().ID)
+		}
+		if it.Err() != nil {
+			t.Errorf("%v : err = %v", test.name, it.Err())
+		}
+		gap := ""
+		if it.Gap() != nil {
+			gap = fmt.Sprintf("%d-%d", it.Gap().SinceID, it.Gap().MaxID)
+		}
+		if gap != test.gap || fmt.Sprint(ids) != test.ids || len(source.fetched) != test.fetched {
+			t.Errorf("%v : gap = %v, ids = %v, fetched = %v", test.name, gap, ids, source.fetched)
+		}
+	}
+}
+
+func TestLoaderStreamGapLimitedCount(t *testing.T) {
+	// Size is larger than the count which Source accepts
+	source := newFakeSource("match", "match", "match", "match", "match", "match", "match", "match", "match", "match")
+	source.limit = 4
+	source.max = 2
+	it := NewSourceLoader(source, &LoaderOption{Size: 4}).Stream(context.Background(), nil, 101, []Filter{FromContextFilter(errFilter{})})
+	var ids []int64
+	for it.Next() {
+		ids = append(ids, it.Tweet().ID)
+	}
+	if it.Err() != nil {
+		t.Fatalf("err = %v", it.Err())
+	}
+	if gap := it.Gap(); gap == nil || gap.SinceID != 101 || gap.MaxID != 107 {
+		t.Errorf("gap = %v", gap)
+	}
+	if fmt.Sprint(ids) != "[107 108 109 110]" || len(source.fetched) != 3 {
+		t.Errorf("ids = %v, fetched = %v", ids, source.fetched)
+	}
+}
+
+func TestLoaderStreamWindow(t *testing.T) {
+	// tweets posted 4, 3, 2 and 1 hours ago
+	now := time.Now()
+	source := &fakeSource{}
+	for i := 1; i <= 4; i++ {
+		posted := now.Add(-time.Duration(i) * time.Hour)
+		source.tweets = append(source.tweets, twitter.Tweet{ID: SnowflakeID(posted) + 1, Text: "match", CreatedAt: posted.Format(time.RubyDate)})
+	}
+	falseValue := false
+	option := &LoaderOption{
+		Size:           2,
+		Fallback:       time.Minute,
+		Since:          now.Add(-3*time.Hour - time.Minute),
+		MaxID:          source.tweets[0].ID - 1,
+		ExcludeReplies: &falseValue,
+	}
+	it := NewSourceLoader(source, option).Stream(context.Background(), nil, 0, []Filter{FromContextFilter(errFilter{})})
+	var ids []int64
+	for it.Next() {
+		ids = append(ids, it.Tweet().ID)
+	}
+	if it.Err() != nil || it.Gap() != nil {
+		t.Fatalf("err = %v, gap = %v", it.Err(), it.Gap())
+	}
+	// tweets posted 3 and 2 hours ago. Since is used instead of fallback.
+	if len(ids) != 2 || ids[0] != source.tweets[2].ID || ids[1] != source.tweets[1].ID {
+		t.Errorf("ids = %v", ids)
+	}
+	for _, params := range source.fetched {
+		if params.MaxID == 0 || params.MaxID > option.MaxID || params.ExcludeReplies != &falseValue || params.IncludeRetweets != nil {
+			t.Errorf("fetched = %+v", params)
+		}
+	}
+}
+
+func TestLoaderStreamExcludeReplies(t *testing.T) {
+	// user_timeline of twittertest applies count before excluding replies like Twitter.
+	server := twittertest.NewServer()
+	defer server.Close()
+	server.AddUser(twitter.User{ID: 10, ScreenName: "alice"})
+	createdAt := time.Now().Format(time.RubyDate)
+	for _, id := range []int64{100, 301, 302, 401, 402, 403, 404} {
+		tweet := twitter.Tweet{ID: id, Text: "match", CreatedAt: createdAt, User: &twitter.User{ID: 10}}
+		if id > 400 {
+			tweet.InReplyToStatusID = 302
+		}
+		server.AddTweets(tweet)
+	}
+
+	excludeReplies := true
+	loader := NewLoader(10, &LoaderOption{Size: 2, ExcludeReplies: &excludeReplies})
+	it := loader.Stream(context.Background(), twitter.NewClient(server.Client()), 100, []Filter{FromContextFilter(errFilter{})})
+	var ids []int64
+	for it.Next() {
+		ids = append(ids, it.Tweet().ID)
+	}
+	// pages of only replies do not stop walking back and replies are not yielded.
+	if it.Err() != nil || it.Gap() != nil || fmt.Sprint(ids) != "[301 302]" || it.Checkpoint() != 404 {
+		t.Errorf("ids = %v, checkpoint = %v, gap = %v, err = %v", ids, it.Checkpoint(), it.Gap(), it.Err())
+	}
+	if stats := it.Stats(); stats.Scanned != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+	// replies are excluded by API and empty pages are fetched again including replies.
+	var excluded []string
+	for _, req := range server.Requests() {
+		excluded = append(excluded, req.Query.Get("exclude_replies"))
+	}
+	if fmt.Sprint(excluded) != "[true false true false true true]" {
+		t.Errorf("exclude_replies = %v", excluded)
+	}
+}
+
+func TestLoaderAccepts(t *testing.T) {
+	now := time.Now()
+	excludeReplies := true
+	loader := NewSourceLoader(&fakeSource{}, &LoaderOption{Since: now.Add(-time.Hour), MaxID: SnowflakeID(now), ExcludeReplies: &excludeReplies})
+	for _, test := range []struct {
+		name     string
+		tweet    twitter.Tweet
+		expected bool
+	}{
+		{"in range", twitter.Tweet{ID: SnowflakeID(now.Add(-time.Minute))}, true},
+		{"reply", twitter.Tweet{ID: SnowflakeID(now.Add(-time.Minute)), InReplyToStatusID: 1}, false},
+		{"before since", twitter.Tweet{ID: SnowflakeID(now.Add(-2 * time.Hour))}, false},
+		{"after max id", twitter.Tweet{ID: SnowflakeID(now.Add(time.Minute))}, false},
+	} {
+		if accepted := loader.Accepts(&test.tweet); accepted != test.expected {
+			t.Errorf("%v : accepted = %v", test.name, accepted)
+		}
+	}
+}
+
+func TestLoaderStreamRateLimitWait(t *testing.T) {
+	server := twittertest.NewServer()
+	defer server.Close()
+	server.AddUser(twitter.User{ID: 10, ScreenName: "alice"})
+	createdAt := time.Now().Format(time.RubyDate)
+	for _, id := range []int64{101, 102, 103} {
+		server.AddTweets(twitter.Tweet{ID: id, Text: "match", CreatedAt: createdAt, User: &twitter.User{ID: 10}})
+	}
+	// the window is used up by the first page.
+	server.SetRateLimit(twittertest.UserTimelinePath, 1, 1, time.Unix(time.Now().Unix()+1, 0))
+
+	client := twitter.NewClient(&http.Client{Transport: NewRateLimiter(server.Transport())})
+	it := NewLoader(10, &LoaderOption{Size: 2}).Stream(context.Background(), client, 100, []Filter{FromContextFilter(errFilter{})})
+	var ids []int64
+	for it.Next() {
+		ids = append(ids, it.Tweet().ID)
+	}
+	if it.Err() != nil || fmt.Sprint(ids) != "[101 102 103]" {
+		t.Fatalf("ids = %v, err = %v", ids, it.Err())
+	}
+	// the wait in RateLimiter for the next page is counted.
+	if stats := it.Stats(); stats.RateLimitSleep == 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
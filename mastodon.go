@@ -0,0 +1,394 @@
+package twilter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MastodonClient is the client of Mastodon REST API of the server.
+// statuses of Mastodon are converted to twitter.Tweet so that filters work with Mastodon.
+type MastodonClient struct {
+	HTTP *http.Client
+	// Server is the base url of the server (e.g. https://mastodon.social).
+	Server      string
+	AccessToken string
+}
+
+// MastodonID returns the minimum status id of Mastodon posted at t.
+// status id has the posted time in milliseconds since unix epoch in the upper bits.
+func MastodonID(t time.Time) int64 {
+	ms := t.UnixNano() / int64(time.Millisecond)
+	if ms < 0 {
+		return 0
+	}
+	return ms << 16
+}
+
+// mastodonErrorBody is the error response of Mastodon.
+type mastodonErrorBody struct {
+	Error string `json:"error"`
+}
+
+// mastodonDefaultReset is the rate limit window of Mastodon used when the response has no X-RateLimit-Reset.
+const mastodonDefaultReset = 5 * time.Minute
+
+// classes of http status codes of Mastodon for reading accounts and for boosting statuses.
+var (
+	mastodonReadClasses = map[int]ErrorClass{
+		http.StatusUnauthorized:    AuthInvalid,
+		http.StatusForbidden:       TargetProtected,
+		http.StatusNotFound:        TargetNotFound,
+		http.StatusGone:            TargetSuspended,
+		http.StatusTooManyRequests: RateLimited,
+	}
+	mastodonBoostClasses = map[int]ErrorClass{
+		http.StatusUnauthorized: AuthInvalid,
+		// private and direct statuses can not be boosted.
+		http.StatusForbidden:           RetweetNotPermitted,
+		http.StatusNotFound:            TweetDeleted,
+		http.StatusGone:                TweetDeleted,
+		http.StatusUnprocessableEntity: RetweetNotPermitted,
+		http.StatusTooManyRequests:     RateLimited,
+	}
+)
+
+// classifyMastodon classifies the result of a request to Mastodon by classes of status codes.
+// network errors and 5xx are Transient. returns nil if the request succeeded.
+func classifyMastodon(resp *http.Response, err error, classes map[int]ErrorClass) error {
+	if err == nil && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp == nil || resp.StatusCode >= 500 {
+		return classifyError(resp, err)
+	}
+	cerr := &ClassifiedError{Class: classes[resp.StatusCode], StatusCode: resp.StatusCode, Err: err}
+	if cerr.Err == nil {
+		cerr.Err = fmt.Errorf("%v", resp.Status)
+	}
+	if cerr.Class == RateLimited {
+		cerr.ResetAt = time.Now().Add(mastodonDefaultReset)
+		if reset, err := time.Parse(time.RFC3339, resp.Header.Get("X-RateLimit-Reset")); err == nil {
+			cerr.ResetAt = reset
+		}
+	}
+	return cerr
+}
+
+// do sends the request and decodes the response body to out. the error is *ClassifiedError by classes.
+func (c *MastodonClient) do(ctx context.Context, method, path string, query url.Values, out interface{}, classes map[int]ErrorClass) (*http.Response, error) {
+	u := strings.TrimSuffix(c.Server, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(nil))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if c.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, classifyMastodon(nil, err, classes)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var body mastodonErrorBody
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == "" {
+			return resp, classifyMastodon(resp, fmt.Errorf("request to %v : %v", path, resp.Status), classes)
+		}
+		return resp, classifyMastodon(resp, fmt.Errorf("request to %v : %v", path, body.Error), classes)
+	}
+	if out == nil {
+		return resp, nil
+	}
+	return resp, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// MastodonAccount is the account of Mastodon.
+type MastodonAccount struct {
+	ID             string `json:"id"`
+	Username       string `json:"username"`
+	Acct           string `json:"acct"`
+	DisplayName    string `json:"display_name"`
+	Locked         bool   `json:"locked"`
+	FollowersCount int    `json:"followers_count"`
+	FollowingCount int    `json:"following_count"`
+	StatusesCount  int    `json:"statuses_count"`
+}
+
+// mastodonStatus is the status of Mastodon.
+type mastodonStatus struct {
+	ID                 string          `json:"id"`
+	CreatedAt          string          `json:"created_at"`
+	InReplyToID        string          `json:"in_reply_to_id"`
+	InReplyToAccountID string          `json:"in_reply_to_account_id"`
+	Sensitive          bool            `json:"sensitive"`
+	SpoilerText        string          `json:"spoiler_text"`
+	Language           string          `json:"language"`
+	RepliesCount       int             `json:"replies_count"`
+	ReblogsCount       int             `json:"reblogs_count"`
+	FavouritesCount    int             `json:"favourites_count"`
+	Favourited         bool            `json:"favourited"`
+	Reblogged          bool            `json:"reblogged"`
+	Content            string          `json:"content"`
+	Reblog             *mastodonStatus `json:"reblog"`
+	Account            MastodonAccount `json:"account"`
+	MediaAttachments   []struct {
+		ID         string `json:"id"`
+		Type       string `json:"type"`
+		URL        string `json:"url"`
+		PreviewURL string `json:"preview_url"`
+	} `json:"media_attachments"`
+	Mentions []struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+		Acct     string `json:"acct"`
+	} `json:"mentions"`
+	Tags []struct {
+		Name string `json:"name"`
+	} `json:"tags"`
+	Application *struct {
+		Name string `json:"name"`
+	} `json:"application"`
+}
+
+// mastodonMediaTypes maps types of media attachments to types of twitter media. other types (audio, unknown) are ignored.
+var mastodonMediaTypes = map[string]string{
+	"image": "photo",
+	"video": "video",
+	"gifv":  "animated_gif",
+}
+
+// htmlReplacer converts line breaks of html content to new lines.
+var htmlReplacer = strings.NewReplacer("<br>", "\n", "<br/>", "\n", "<br />", "\n", "</p><p>", "\n\n")
+
+// htmlText converts html content of status to plain text.
+func htmlText(content string) string {
+	content = htmlReplacer.Replace(content)
+	var b strings.Builder
+	inTag := false
+	for _, r := range content {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>':
+			inTag = false
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return html.UnescapeString(b.String())
+}
+
+// user converts the account.
+func (a *MastodonAccount) user() *twitter.User {
+	return &twitter.User{
+		ID:             parseID(a.ID),
+		IDStr:          a.ID,
+		ScreenName:     a.Acct,
+		Name:           a.DisplayName,
+		Protected:      a.Locked,
+		FollowersCount: a.FollowersCount,
+		FriendsCount:   a.FollowingCount,
+		StatusesCount:  a.StatusesCount,
+	}
+}
+
+// tweet converts the status. reblog is RetweetedStatus and content warning is PossiblySensitive.
+func (s *mastodonStatus) tweet() twitter.Tweet {
+	tweet := twitter.Tweet{
+		ID:                   parseID(s.ID),
+		IDStr:                s.ID,
+		Text:                 htmlText(s.Content),
+		Lang:                 s.Language,
+		PossiblySensitive:    s.Sensitive || s.SpoilerText != "",
+		InReplyToStatusID:    parseID(s.InReplyToID),
+		InReplyToStatusIDStr: s.InReplyToID,
+		InReplyToUserID:      parseID(s.InReplyToAccountID),
+		InReplyToUserIDStr:   s.InReplyToAccountID,
+		RetweetCount:         s.ReblogsCount,
+		ReplyCount:           s.RepliesCount,
+		FavoriteCount:        s.FavouritesCount,
+		Favorited:            s.Favourited,
+		Retweeted:            s.Reblogged,
+		User:                 s.Account.user(),
+		Entities:             &twitter.Entities{},
+	}
+	if createdAt, err := time.Parse(time.RFC3339, s.CreatedAt); err == nil {
+		// v1.1 format which twitter.Tweet.CreatedAtTime parses
+		tweet.CreatedAt = createdAt.UTC().Format(time.RubyDate)
+	}
+	if s.Application != nil {
+		tweet.Source = s.Application.Name
+	}
+
+	for _, tag := range s.Tags {
+		tweet.Entities.Hashtags = append(tweet.Entities.Hashtags, twitter.HashtagEntity{Text: tag.Name})
+	}
+	for _, m := range s.Mentions {
+		tweet.Entities.UserMentions = append(tweet.Entities.UserMentions, twitter.MentionEntity{ID: parseID(m.ID), IDStr: m.ID, ScreenName: m.Acct})
+		if m.ID == s.InReplyToAccountID {
+			tweet.InReplyToScreenName = m.Acct
+		}
+	}
+	for _, a := range s.MediaAttachments {
+		typ, ok := mastodonMediaTypes[a.Type]
+		if !ok {
+			continue
+		}
+		media := twitter.MediaEntity{ID: parseID(a.ID), IDStr: a.ID, Type: typ, MediaURLHttps: a.URL}
+		if typ != "photo" {
+			// media_url_https of videos is the preview image like v1.1.
+			media.MediaURLHttps = a.PreviewURL
+		}
+		if tweet.ExtendedEntities == nil {
+			tweet.ExtendedEntities = &twitter.ExtendedEntity{}
+			tweet.Entities.Media = []twitter.MediaEntity{media}
+		}
+		tweet.ExtendedEntities.Media = append(tweet.ExtendedEntities.Media, media)
+	}
+
+	if s.Reblog != nil {
+		reblog := s.Reblog.tweet()
+		tweet.RetweetedStatus = &reblog
+		// the reblog itself has no content. retweets of v1.1 have the text and entities of the original.
+		tweet.Text = "RT @" + s.Reblog.Account.Acct + ": " + reblog.Text
+		tweet.Entities, tweet.ExtendedEntities = reblog.Entities, reblog.ExtendedEntities
+	}
+	return tweet
+}
+
+// LookupAccount gets the account by acct (e.g. user or user@example.com).
+// remote accounts unknown to the server are resolved by search API.
+func (c *MastodonClient) LookupAccount(ctx context.Context, acct string) (*MastodonAccount, error) {
+	acct = strings.TrimPrefix(acct, "@")
+	var account MastodonAccount
+	err := DefaultRetryPolicy.Do(ctx, func() (*http.Response, error) {
+		return c.do(ctx, http.MethodGet, "/api/v1/accounts/lookup", url.Values{"acct": {acct}}, &account, mastodonReadClasses)
+	})
+	if cerr, ok := err.(*ClassifiedError); !ok || cerr.Class != TargetNotFound {
+		if err != nil {
+			return nil, err
+		}
+		return &account, nil
+	}
+
+	var result struct {
+		Accounts []MastodonAccount `json:"accounts"`
+	}
+	query := url.Values{"q": {acct}, "type": {"accounts"}, "resolve": {"true"}, "limit": {"1"}}
+	err = DefaultRetryPolicy.Do(ctx, func() (*http.Response, error) {
+		return c.do(ctx, http.MethodGet, "/api/v2/search", query, &result, mastodonReadClasses)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Accounts) == 0 {
+		return nil, &ClassifiedError{Class: TargetNotFound, StatusCode: http.StatusNotFound, Err: fmt.Errorf("mastodon account not found : %v", acct)}
+	}
+	return &result.Accounts[0], nil
+}
+
+// VerifyCredentials gets the account of AccessToken.
+func (c *MastodonClient) VerifyCredentials(ctx context.Context) (*MastodonAccount, error) {
+	var account MastodonAccount
+	if _, err := c.do(ctx, http.MethodGet, "/api/v1/accounts/verify_credentials", nil, &account, mastodonReadClasses); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// MastodonAccountSource is statuses of a Mastodon account. the client of Fetch is ignored and Client is used instead.
+// https://docs.joinmastodon.org/methods/accounts/#statuses
+type MastodonAccountSource struct {
+	Client    *MastodonClient
+	AccountID int64
+	// Acct is used only for String.
+	Acct string
+}
+
+// Fetch fetches a page of statuses of the account.
+func (s *MastodonAccountSource) Fetch(ctx context.Context, _ *twitter.Client, params *PageParams) ([]twitter.Tweet, *http.Response, error) {
+	query := make(url.Values)
+	query.Set("limit", strconv.Itoa(limitCount(params, 40)))
+	if params.SinceID > 0 {
+		query.Set("since_id", strconv.FormatInt(params.SinceID, 10))
+	}
+	if params.MaxID > 0 {
+		// max_id of Mastodon is exclusive.
+		query.Set("max_id", strconv.FormatInt(params.MaxID+1, 10))
+	}
+	if !*boolParam(params.IncludeRetweets, &trueValue) {
+		query.Set("exclude_reblogs", "true")
+	}
+	if *boolParam(params.ExcludeReplies, &falseValue) {
+		query.Set("exclude_replies", "true")
+	}
+
+	var statuses []mastodonStatus
+	resp, err := s.Client.do(ctx, http.MethodGet, "/api/v1/accounts/"+strconv.FormatInt(s.AccountID, 10)+"/statuses", query, &statuses, mastodonReadClasses)
+	if err != nil {
+		return nil, resp, err
+	}
+	tweets := make([]twitter.Tweet, len(statuses))
+	for i := range statuses {
+		tweets[i] = statuses[i].tweet()
+	}
+	return tweets, resp, nil
+}
+
+// MinID returns the minimum status id posted at t.
+func (s *MastodonAccountSource) MinID(t time.Time) int64 {
+	return MastodonID(t)
+}
+
+// String returns mastodon
+func (s *MastodonAccountSource) String() string {
+	if s.Acct != "" {
+		return fmt.Sprintf("mastodon(%v)", s.Acct)
+	}
+	return fmt.Sprintf("mastodon(%d)", s.AccountID)
+}
+
+// mastodonBooster boosts statuses by the account of the client.
+type mastodonBooster struct {
+	client *MastodonClient
+}
+
+// NewMastodonBooster creates Retweeter which boosts statuses by the account of AccessToken.
+// https://docs.joinmastodon.org/methods/statuses/#boost
+func NewMastodonBooster(client *MastodonClient) Retweeter {
+	return &mastodonBooster{client: client}
+}
+
+// Retweet boosts the status. boosting the status already boosted succeeds.
+func (b *mastodonBooster) Retweet(ctx context.Context, statusID int64) error {
+	return b.request(ctx, "/api/v1/statuses/"+strconv.FormatInt(statusID, 10)+"/reblog")
+}
+
+// Unretweet undoes the boost of the status.
+func (b *mastodonBooster) Unretweet(ctx context.Context, statusID int64) error {
+	return b.request(ctx, "/api/v1/statuses/"+strconv.FormatInt(statusID, 10)+"/unreblog")
+}
+
+func (b *mastodonBooster) request(ctx context.Context, path string) error {
+	return DefaultRetryPolicy.Do(ctx, func() (*http.Response, error) {
+		return b.client.do(ctx, http.MethodPost, path, nil, nil, mastodonBoostClasses)
+	})
+}
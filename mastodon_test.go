@@ -0,0 +1,218 @@
+package twilter
+
+import (
+	"context"
+	"github.com/kawasin73/twilter/twittertest"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeMastodonHandler is the stand-in of Mastodon REST API serving recorded statuses from testdata.
+type fakeMastodonHandler struct {
+	t *testing.T
+}
+
+func (h fakeMastodonHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.URL.Path {
+	case "/api/v1/accounts/10/statuses":
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "mastodon_statuses.json"))
+		if err != nil {
+			h.t.Fatal(err)
+		}
+		w.Write(data)
+	case "/api/v1/accounts/11/statuses":
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"Record not found"}`))
+	case "/api/v1/accounts/12/statuses":
+		w.WriteHeader(http.StatusGone)
+		w.Write([]byte(`{"error":"Account is suspended"}`))
+	case "/api/v1/accounts/13/statuses":
+		w.Header().Set("X-RateLimit-Reset", "2019-02-16T12:05:00.000Z")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":"Too many requests"}`))
+	case "/api/v1/accounts/lookup":
+		if r.URL.Query().Get("acct") != "alice" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"Record not found"}`))
+			return
+		}
+		w.Write([]byte(`{"id":"10","username":"alice","acct":"alice","display_name":"Alice"}`))
+	case "/api/v2/search":
+		if r.URL.Query().Get("q") != "bob@other.example" || r.URL.Query().Get("resolve") != "true" {
+			w.Write([]byte(`{"accounts":[],"statuses":[],"hashtags":[]}`))
+			return
+		}
+		w.Write([]byte(`{"accounts":[{"id":"20","username":"bob","acct":"bob@other.example","display_name":"Bob"}],"statuses":[],"hashtags":[]}`))
+	case "/api/v1/statuses/101607000000000005/reblog", "/api/v1/statuses/101607000000000005/unreblog":
+		w.Write([]byte(`{"id":"101607000000000009","reblog":{"id":"101607000000000005"}}`))
+	case "/api/v1/statuses/101607000000000006/reblog":
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"Record not found"}`))
+	case "/api/v1/statuses/101607000000000007/reblog":
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error":"This action is not allowed"}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// newFakeMastodon starts twittertest.Server which serves Mastodon REST API by fakeMastodonHandler.
+func newFakeMastodon(t *testing.T) (*twittertest.Server, *MastodonClient) {
+	server := twittertest.NewServer()
+	server.Handle("/api/", fakeMastodonHandler{t: t})
+	return server, &MastodonClient{HTTP: server.Client(), Server: "https://mastodon.example", AccessToken: "token"}
+}
+
+func TestMastodonAccountSource(t *testing.T) {
+	server, client := newFakeMastodon(t)
+	defer server.Close()
+	source := &MastodonAccountSource{Client: client, AccountID: 10}
+
+	tweets, _, err := source.Fetch(context.Background(), nil, &PageParams{MaxID: 101607000000000005, SinceID: 100, Count: 200, IncludeRetweets: &falseValue})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := server.Requests()[0].Query
+	if query.Get("max_id") != "101607000000000006" || query.Get("since_id") != "100" || query.Get("limit") != "40" || query.Get("exclude_reblogs") != "true" || query.Get("exclude_replies") != "" {
+		t.Errorf("query = %v", query)
+	}
+	if auth := server.Requests()[0].Header.Get("Authorization"); auth != "Bearer token" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if len(tweets) != 5 {
+		t.Fatalf("len(tweets) = %v", len(tweets))
+	}
+
+	filters := []Filter{PhotoFilter{}, VideoFilter{}, RTFilter{}, SensitiveFilter{}}
+	for _, test := range []struct {
+		text    string
+		matched []bool
+	}{
+		{"hello #golang & @bob\n\nsecond line", []bool{false, false, false, false}},
+		{"two photos", []bool{true, false, false, false}},
+		{"RT @bob@other.example: the ending of the movie", []bool{false, true, true, true}},
+		{"a cat gif", []bool{false, false, false, false}},
+		{"@dave thanks!", []bool{false, false, false, false}},
+	} {
+		tweet := tweets[0]
+		tweets = tweets[1:]
+		if tweet.Text != test.text {
+			t.Errorf("tweet (%d) : text = %q", tweet.ID, tweet.Text)
+		}
+		for i, f := range filters {
+			if matched := f.Match(&tweet); matched != test.matched[i] {
+				t.Errorf("tweet (%d) : %v = %v", tweet.ID, f, matched)
+			}
+		}
+		if _, err := tweet.CreatedAtTime(); err != nil {
+			t.Errorf("tweet (%d) : created_at = %q", tweet.ID, tweet.CreatedAt)
+		}
+	}
+}
+
+func TestMastodonStatus(t *testing.T) {
+	server, client := newFakeMastodon(t)
+	defer server.Close()
+	tweets, _, err := (&MastodonAccountSource{Client: client, AccountID: 10}).Fetch(context.Background(), nil, &PageParams{Count: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hello := tweets[0]
+	if hello.User.ID != 10 || hello.User.ScreenName != "alice" || tweetEntities(&hello).Hashtags[0].Text != "golang" || tweetEntities(&hello).UserMentions[0].ScreenName != "bob@other.example" || hello.Source != "Web" {
+		t.Errorf("status = %+v", hello)
+	}
+	if photos := tweets[1]; !photos.Retweeted || len(photos.ExtendedEntities.Media) != 2 {
+		t.Errorf("photos = %+v", photos)
+	}
+	if rt := tweets[2]; rt.RetweetedStatus.User.ScreenName != "bob@other.example" || rt.PossiblySensitive || !rt.RetweetedStatus.PossiblySensitive {
+		t.Errorf("reblog = %+v", rt.RetweetedStatus)
+	}
+	if gif := tweets[3]; tweetMedia(&gif)[0].Type != "animated_gif" || !strings.HasSuffix(tweetMedia(&gif)[0].MediaURLHttps, "c.png") {
+		t.Errorf("gif = %+v", tweetMedia(&gif))
+	}
+	if reply := tweets[4]; reply.InReplyToStatusID != 101606000000000003 || reply.InReplyToUserID != 40 || reply.InReplyToScreenName != "dave" {
+		t.Errorf("reply = %+v", reply)
+	}
+}
+
+func TestMastodonSince(t *testing.T) {
+	server, client := newFakeMastodon(t)
+	defer server.Close()
+	since := time.Date(2019, 2, 16, 10, 0, 0, 0, time.UTC)
+	loader := NewSourceLoader(&MastodonAccountSource{Client: client, AccountID: 10}, &LoaderOption{Since: since})
+
+	it := loader.Stream(context.Background(), nil, 0, []Filter{AllFilter{}})
+	for it.Next() {
+	}
+	if expected, query := strconv.FormatInt(MastodonID(since)-1, 10), server.Requests()[0].Query; query.Get("since_id") != expected {
+		t.Errorf("since_id = %v, expected %v", query.Get("since_id"), expected)
+	}
+}
+
+func TestMastodonErrors(t *testing.T) {
+	server, client := newFakeMastodon(t)
+	defer server.Close()
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		accountID int64
+		class     ErrorClass
+	}{
+		{11, TargetNotFound},
+		{12, TargetSuspended},
+		{13, RateLimited},
+	} {
+		_, resp, err := (&MastodonAccountSource{Client: client, AccountID: test.accountID}).Fetch(ctx, nil, &PageParams{Count: 40})
+		cerr := Classify(resp, err)
+		if cerr == nil || cerr.Class != test.class {
+			t.Errorf("account %v : Classify() = %+v", test.accountID, cerr)
+		} else if test.class == RateLimited && !cerr.ResetAt.Equal(time.Date(2019, 2, 16, 12, 5, 0, 0, time.UTC)) {
+			t.Errorf("ResetAt = %v", cerr.ResetAt)
+		}
+	}
+
+	booster := NewMastodonBooster(client)
+	if err := booster.Retweet(ctx, 101607000000000005); err != nil {
+		t.Errorf("Retweet() = %v", err)
+	}
+	if err := booster.Unretweet(ctx, 101607000000000005); err != nil {
+		t.Errorf("Unretweet() = %v", err)
+	}
+	for _, test := range []struct {
+		statusID int64
+		class    ErrorClass
+	}{
+		{101607000000000006, TweetDeleted},
+		{101607000000000007, RetweetNotPermitted},
+	} {
+		err := booster.Retweet(ctx, test.statusID)
+		if cerr, ok := err.(*ClassifiedError); !ok || cerr.Class != test.class {
+			t.Errorf("Retweet(%v) = %v", test.statusID, err)
+		}
+	}
+}
+
+func TestMastodonLookupAccount(t *testing.T) {
+	server, client := newFakeMastodon(t)
+	defer server.Close()
+	ctx := context.Background()
+
+	for acct, id := range map[string]string{"@alice": "10", "bob@other.example": "20"} {
+		account, err := client.LookupAccount(ctx, acct)
+		if err != nil || account.ID != id {
+			t.Errorf("LookupAccount(%v) = %+v, %v", acct, account, err)
+		}
+	}
+	_, err := client.LookupAccount(ctx, "nobody@other.example")
+	if cerr, ok := err.(*ClassifiedError); !ok || cerr.Class != TargetNotFound {
+		t.Errorf("LookupAccount(nobody) = %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package twilter
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter is http.RoundTripper which shares rate limits of Twitter API among all requests.
+//
+// RateLimiter tracks the window of each endpoint by X-Rate-Limit-* headers and reserves the capacity before each request.
+// when the window is used up, requests wait in FIFO order until it is reset instead of getting 429.
+// while the window of an endpoint is unknown, only one request is sent to learn it.
+// endpoints which respond without the headers (e.g. POST endpoints) are not limited.
+type RateLimiter struct {
+	next    http.RoundTripper
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+}
+
+// NewRateLimiter returns RateLimiter which sends requests by next. http.DefaultTransport is used if next is nil.
+func NewRateLimiter(next http.RoundTripper) *RateLimiter {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &RateLimiter{next: next, windows: make(map[string]*rateWindow)}
+}
+
+// rateWindow is the rate limit window of an endpoint.
+type rateWindow struct {
+	// limit and remaining are -1 if unknown.
+	limit     int
+	remaining int
+	reset     time.Time
+	// untracked is true if the endpoint has no rate limit headers.
+	untracked bool
+	// probing is true while a request to learn the window is in flight.
+	probing  bool
+	inflight int
+	// queue is waiting requests. closed when the capacity is reserved.
+	queue       []chan struct{}
+	dispatching bool
+	// wake notifies the dispatcher that the window is updated.
+	wake chan struct{}
+}
+
+// idPattern matches ids in paths (e.g. /1.1/statuses/retweet/123.json)
+var idPattern = regexp.MustCompile(`/[0-9]+(\.json)?$`)
+
+// endpointKey returns the key of the window of the request.
+func endpointKey(req *http.Request) string {
+	return req.Method + " " + req.URL.Host + idPattern.ReplaceAllString(req.URL.Path, "/:id$1")
+}
+
+// rateWaitKey is the context key of the time a request waited in RateLimiter.
+type rateWaitKey struct{}
+
+// RoundTrip waits for the capacity of the endpoint and sends the request.
+// the time waited is recorded in the request of the response. see RateLimitWait.
+func (l *RateLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := endpointKey(req)
+	start := time.Now()
+	if err := l.acquire(req.Context(), key); err != nil {
+		return nil, err
+	}
+	wait := time.Since(start)
+	resp, err := l.next.RoundTrip(req)
+	l.update(key, resp)
+	if resp != nil && resp.Request != nil {
+		resp.Request = resp.Request.WithContext(context.WithValue(resp.Request.Context(), rateWaitKey{}, wait))
+	}
+	return resp, err
+}
+
+// RateLimitWait returns the time the request of resp waited for the capacity in RateLimiter. returns 0 if not sent by RateLimiter.
+// go-twitter sends requests without context, so the wait is returned through the response instead of a hook in the context.
+func RateLimitWait(resp *http.Response) time.Duration {
+	if resp == nil || resp.Request == nil {
+		return 0
+	}
+	wait, _ := resp.Request.Context().Value(rateWaitKey{}).(time.Duration)
+	return wait
+}
+
+// Remaining returns the number of requests available in the current window of the endpoint. returns -1 if unknown.
+func (l *RateLimiter) Remaining(method, url string) int {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return -1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if w, ok := l.windows[endpointKey(req)]; ok && !w.untracked {
+		w.refresh(time.Now())
+		return w.remaining
+	}
+	return -1
+}
+
+// acquire reserves the capacity of the endpoint. waits in the queue if no capacity is left.
+func (l *RateLimiter) acquire(ctx context.Context, key string) error {
+	l.mu.Lock()
+	w, ok := l.windows[key]
+	if !ok {
+		w = &rateWindow{limit: -1, remaining: -1, wake: make(chan struct{}, 1)}
+		l.windows[key] = w
+	}
+	if len(w.queue) == 0 && w.take(time.Now()) {
+		l.mu.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	w.queue = append(w.queue, ch)
+	if !w.dispatching {
+		w.dispatching = true
+		go l.dispatch(w)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		select {
+		case <-ch:
+			// reserved just before cancellation. give back the capacity.
+			w.release()
+			w.notify()
+		default:
+			for i, c := range w.queue {
+				if c == ch {
+					w.queue = append(w.queue[:i], w.queue[i+1:]...)
+					break
+				}
+			}
+			// the dispatcher exits if the queue is empty.
+			w.notify()
+		}
+		return ctx.Err()
+	}
+}
+
+// dispatch reserves the capacity for waiting requests in order until the queue is empty.
+func (l *RateLimiter) dispatch(w *rateWindow) {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		for len(w.queue) > 0 && w.take(now) {
+			close(w.queue[0])
+			w.queue = w.queue[1:]
+		}
+		if len(w.queue) == 0 {
+			w.dispatching = false
+			l.mu.Unlock()
+			return
+		}
+		// wait until the window is reset or updated by a response.
+		timer := time.NewTimer(time.Hour)
+		if w.remaining == 0 && !w.reset.IsZero() {
+			timer.Reset(w.reset.Sub(now))
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-timer.C:
+		case <-w.wake:
+		}
+		timer.Stop()
+	}
+}
+
+// update records the window from the response and releases the reservation.
+func (l *RateLimiter) update(key string, resp *http.Response) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	w := l.windows[key]
+	if resp == nil {
+		// the request failed by a network error and Twitter may not count it. give back the capacity.
+		w.release()
+		w.notify()
+		return
+	}
+	w.inflight--
+	probing := w.probing
+	w.probing = false
+	limit, errLimit := strconv.Atoi(resp.Header.Get("X-Rate-Limit-Limit"))
+	remaining, errRemaining := strconv.Atoi(resp.Header.Get("X-Rate-Limit-Remaining"))
+	reset, errReset := strconv.ParseInt(resp.Header.Get("X-Rate-Limit-Reset"), 10, 64)
+	if errLimit == nil && errRemaining == nil && errReset == nil {
+		w.limit, w.untracked = limit, false
+		// requests in flight are not counted in remaining of the response yet.
+		if remaining -= w.inflight; remaining < 0 {
+			remaining = 0
+		}
+		switch resetAt := time.Unix(reset, 0); {
+		case !time.Now().Before(resetAt):
+			// the response of the expired window.
+		case resetAt.Equal(w.reset):
+			// responses of the same window may arrive out of order.
+			if remaining < w.remaining {
+				w.remaining = remaining
+			}
+		default:
+			w.remaining, w.reset = remaining, resetAt
+		}
+	} else if probing && resp.StatusCode < 300 {
+		// the endpoint has no rate limit.
+		w.untracked = true
+	}
+	w.notify()
+}
+
+// take reserves a request in the window if available.
+func (w *rateWindow) take(now time.Time) bool {
+	if w.untracked {
+		w.inflight++
+		return true
+	}
+	w.refresh(now)
+	if w.remaining < 0 {
+		// unknown window. send a request to learn it.
+		if w.probing {
+			return false
+		}
+		w.probing = true
+		w.inflight++
+		return true
+	}
+	if w.remaining == 0 {
+		return false
+	}
+	w.remaining--
+	w.inflight++
+	return true
+}
+
+// refresh resets the window if its reset time has passed.
+func (w *rateWindow) refresh(now time.Time) {
+	if w.reset.IsZero() || now.Before(w.reset) {
+		return
+	}
+	w.reset = time.Time{}
+	if w.limit < 0 {
+		w.remaining = -1
+		return
+	}
+	if w.remaining = w.limit - w.inflight; w.remaining < 0 {
+		w.remaining = 0
+	}
+}
+
+// release gives back the reservation of a request which is not sent or failed without response.
+func (w *rateWindow) release() {
+	w.inflight--
+	if w.probing {
+		w.probing = false
+	} else if w.remaining >= 0 && w.remaining < w.limit && !w.untracked {
+		w.remaining++
+	}
+}
+
+// notify wakes the dispatcher up if it is waiting.
+func (w *rateWindow) notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
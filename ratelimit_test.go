@@ -0,0 +1,177 @@
+package twilter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLimitServer limits requests to limit per second like rate limit windows of Twitter API.
+type fakeLimitServer struct {
+	mu        sync.Mutex
+	limit     int
+	windowEnd time.Time
+	used      int
+	limited   int
+	requests  int
+}
+
+func (s *fakeLimitServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if s.limit == 0 {
+		// no rate limit headers
+		return
+	}
+	now := time.Now()
+	if !now.Before(s.windowEnd) {
+		s.windowEnd = time.Unix(now.Unix()+1, 0)
+		s.used = 0
+	}
+	s.used++
+	remaining := s.limit - s.used
+	if remaining < 0 {
+		remaining = 0
+		s.limited++
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+	w.Header().Set("X-Rate-Limit-Limit", strconv.Itoa(s.limit))
+	w.Header().Set("X-Rate-Limit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-Rate-Limit-Reset", strconv.FormatInt(s.windowEnd.Unix(), 10))
+}
+
+func TestRateLimiter(t *testing.T) {
+	server := &fakeLimitServer{limit: 3}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := &http.Client{Transport: NewRateLimiter(nil)}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		waited time.Duration
+	)
+	for i := 0; i < 7; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(ts.URL + "/1.1/statuses/user_timeline.json")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			mu.Lock()
+			waited += RateLimitWait(resp)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if server.requests != 7 || server.limited != 0 {
+		t.Errorf("requests = %v, limited = %v", server.requests, server.limited)
+	}
+	// requests over the window wait for the reset.
+	if waited == 0 {
+		t.Error("wait is not reported")
+	}
+}
+
+func TestRateLimiterUntracked(t *testing.T) {
+	ts := httptest.NewServer(&fakeLimitServer{})
+	defer ts.Close()
+	limiter := NewRateLimiter(nil)
+	client := &http.Client{Transport: limiter}
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Post(ts.URL+"/1.1/statuses/retweet/"+strconv.Itoa(100+i)+".json", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if len(limiter.windows) != 1 {
+		t.Errorf("windows = %v", limiter.windows)
+	}
+	for key, w := range limiter.windows {
+		if key != "POST "+ts.Listener.Addr().String()+"/1.1/statuses/retweet/:id.json" || !w.untracked || w.inflight != 0 {
+			t.Errorf("window %v = %+v", key, w)
+		}
+	}
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	ts := httptest.NewServer(&fakeLimitServer{limit: 1})
+	defer ts.Close()
+	limiter := NewRateLimiter(nil)
+	client := &http.Client{Transport: limiter}
+	url := ts.URL + "/1.1/search/tweets.json"
+
+	// use up the window
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if remaining := limiter.Remaining("GET", url); remaining != 0 {
+		t.Fatalf("remaining = %v", remaining)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest("GET", url, nil)
+	if _, err = client.Do(req.WithContext(ctx)); err == nil {
+		t.Fatal("request must wait for the reset and be canceled")
+	}
+	// the dispatcher exits without waiting for the reset.
+	time.Sleep(20 * time.Millisecond)
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	for _, w := range limiter.windows {
+		if len(w.queue) != 0 || w.inflight != 0 || w.dispatching {
+			t.Errorf("window = %+v", w)
+		}
+	}
+}
+
+// roundTripperFunc is http.RoundTripper of the function.
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRateLimiterNetworkError(t *testing.T) {
+	ts := httptest.NewServer(&fakeLimitServer{limit: 3})
+	defer ts.Close()
+	fail := false
+	limiter := NewRateLimiter(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if fail {
+			return nil, errors.New("connection reset")
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	}))
+	client := &http.Client{Transport: limiter}
+	url := ts.URL + "/1.1/statuses/user_timeline.json"
+
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	remaining := limiter.Remaining("GET", url)
+
+	// the failed request does not use up the window.
+	fail = true
+	if _, err := client.Get(url); err == nil {
+		t.Fatal("request must fail")
+	}
+	if r := limiter.Remaining("GET", url); r != remaining {
+		t.Errorf("remaining = %v, want %v", r, remaining)
+	}
+}
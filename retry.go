@@ -0,0 +1,89 @@
+package twilter
+
+import (
+	"context"
+	"github.com/cenkalti/backoff"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy retries requests to Twitter API.
+//
+// rate limited requests are retried after the rate limit is reset. transient errors (5xx responses and network errors)
+// are retried with exponential backoff and jitter until MaxElapsedTime. other errors are not retried.
+// waiting beyond the deadline of ctx is not started, and the last error is returned instead.
+type RetryPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	// RandomizationFactor randomizes each interval in [interval * (1 - factor), interval * (1 + factor)].
+	RandomizationFactor float64
+	// MaxElapsedTime stops retrying transient errors. no limit if 0.
+	MaxElapsedTime time.Duration
+	// Notify is called with the response and error of the failed request before waiting. optional.
+	Notify func(resp *http.Response, err error, wait time.Duration)
+}
+
+// DefaultRetryPolicy is RetryPolicy used when no policy is specified.
+var DefaultRetryPolicy = &RetryPolicy{
+	InitialInterval:     time.Second,
+	MaxInterval:         30 * time.Second,
+	RandomizationFactor: 0.5,
+	MaxElapsedTime:      2 * time.Minute,
+}
+
+// IsRetryable returns true if the request failed transiently and may succeed when retried.
+// rate limit is not included. use IsRateLimit for it.
+func IsRetryable(resp *http.Response, err error) bool {
+	cerr := Classify(resp, err)
+	return cerr != nil && cerr.Class == Transient
+}
+
+// Do calls fn which sends a request and retries it by the policy. fn returns the response and the error of the request.
+// Do returns the error of the last call, or ctx.Err() if ctx is done while waiting.
+// the response of the last call is not checked. callers check its status code as before.
+func (p *RetryPolicy) Do(ctx context.Context, fn func() (*http.Response, error)) error {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = p.InitialInterval
+	b.MaxInterval = p.MaxInterval
+	b.RandomizationFactor = p.RandomizationFactor
+	b.MaxElapsedTime = p.MaxElapsedTime
+	b.Reset()
+
+	for {
+		resp, err := fn()
+		if err == nil && (resp == nil || resp.StatusCode < 300) {
+			// no response without error means no request was needed (e.g. served from cache).
+			return nil
+		}
+
+		var (
+			limited bool
+			wait    time.Duration
+		)
+		if limited, wait = IsRateLimit(resp); !limited {
+			if ctx.Err() != nil || !IsRetryable(resp, err) {
+				return err
+			}
+			if wait = b.NextBackOff(); wait == backoff.Stop {
+				return err
+			}
+		} else if wait < 0 {
+			wait = 0
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			// the retry never succeeds before the deadline.
+			return err
+		}
+
+		if p.Notify != nil {
+			p.Notify(resp, err, wait)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
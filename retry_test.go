@@ -0,0 +1,86 @@
+package twilter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func statusResponse(code int) *http.Response {
+	return &http.Response{StatusCode: code, Status: http.StatusText(code), Header: make(http.Header)}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := &RetryPolicy{InitialInterval: time.Millisecond, MaxInterval: 4 * time.Millisecond, RandomizationFactor: 0.5, MaxElapsedTime: time.Second}
+	limited := statusResponse(http.StatusTooManyRequests)
+	limited.Header.Set("X-Rate-Limit-Remaining", "0")
+	limited.Header.Set("X-Rate-Limit-Reset", strconv.FormatInt(time.Now().Unix(), 10))
+	networkErr := &url.Error{Op: "Get", URL: "https://api.twitter.com", Err: fmt.Errorf("connection reset by peer")}
+
+	for _, test := range []struct {
+		name      string
+		responses []*http.Response
+		errs      []error
+		calls     int
+		success   bool
+	}{
+		{"success", []*http.Response{statusResponse(200)}, nil, 1, true},
+		{"server errors", []*http.Response{statusResponse(503), statusResponse(500), statusResponse(200)}, nil, 3, true},
+		{"network error", []*http.Response{nil, statusResponse(200)}, []error{networkErr, nil}, 2, true},
+		{"rate limit", []*http.Response{limited, statusResponse(200)}, nil, 2, true},
+		{"not found", []*http.Response{statusResponse(404), statusResponse(200)}, nil, 1, false},
+		{"other error", []*http.Response{nil, statusResponse(200)}, []error{fmt.Errorf("invalid request"), nil}, 1, false},
+	} {
+		calls := 0
+		var last *http.Response
+		err := policy.Do(context.Background(), func() (*http.Response, error) {
+			resp := test.responses[calls]
+			var err error
+			if test.errs != nil {
+				err = test.errs[calls]
+			}
+			calls++
+			last = resp
+			return resp, err
+		})
+		success := err == nil && last != nil && last.StatusCode == 200
+		if calls != test.calls || success != test.success {
+			t.Errorf("%v : calls = %v, err = %v, last = %v", test.name, calls, err, last)
+		}
+	}
+}
+
+func TestRetryPolicyGiveUp(t *testing.T) {
+	// elapsed time exceeds MaxElapsedTime
+	policy := &RetryPolicy{InitialInterval: time.Millisecond, MaxInterval: time.Millisecond, MaxElapsedTime: 20 * time.Millisecond}
+	var waits []time.Duration
+	policy.Notify = func(resp *http.Response, err error, wait time.Duration) {
+		waits = append(waits, wait)
+	}
+	calls := 0
+	_ = policy.Do(context.Background(), func() (*http.Response, error) {
+		calls++
+		return statusResponse(503), nil
+	})
+	if calls < 2 || len(waits) != calls-1 {
+		t.Errorf("calls = %v, waits = %v", calls, waits)
+	}
+
+	// the next wait is beyond the deadline of ctx
+	policy = &RetryPolicy{InitialInterval: time.Hour, MaxInterval: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	calls = 0
+	start := time.Now()
+	err := policy.Do(ctx, func() (*http.Response, error) {
+		calls++
+		return nil, &url.Error{Op: "Get", URL: "https://api.twitter.com", Err: fmt.Errorf("timeout")}
+	})
+	if calls != 1 || err == nil || err == ctx.Err() || time.Since(start) > time.Second {
+		t.Errorf("calls = %v, err = %v", calls, err)
+	}
+}
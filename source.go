@@ -0,0 +1,239 @@
+package twilter
+
+import (
+	"context"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"net/http"
+	"time"
+)
+
+// PageParams is parameters to fetch a page of tweets.
+type PageParams struct {
+	// MaxID is the upper bound (inclusive) of tweet id. ignored when 0.
+	MaxID int64
+	// SinceID is the lower bound (exclusive) of tweet id. ignored when 0.
+	SinceID int64
+	// Count is the number of tweets to fetch. Source may return fewer tweets.
+	// Fetch lowers Count to the number of tweets requested if API accepts fewer, so Loader knows whether a page is full.
+	Count int
+
+	// parameters of timeline APIs. nil means the default of Source. Sources ignore parameters which API does not support.
+	// Loader drops retweets and replies excluded by IncludeRetweets and ExcludeReplies from pages too for such Sources.
+	IncludeRetweets *bool
+	ExcludeReplies  *bool
+	TrimUser        *bool
+}
+
+// excluded returns whether the tweet is excluded by IncludeRetweets or ExcludeReplies of params.
+func (params *PageParams) excluded(tweet *twitter.Tweet) bool {
+	if params.IncludeRetweets != nil && !*params.IncludeRetweets && tweet.RetweetedStatus != nil {
+		return true
+	}
+	return params.ExcludeReplies != nil && *params.ExcludeReplies && tweet.InReplyToStatusID != 0
+}
+
+// excludes returns whether IncludeRetweets or ExcludeReplies of params excludes any tweets.
+func (params *PageParams) excludes() bool {
+	return params.IncludeRetweets != nil && !*params.IncludeRetweets || params.ExcludeReplies != nil && *params.ExcludeReplies
+}
+
+// Source is a timeline which Loader reads tweets from.
+// Fetch returns a page of tweets between params.SinceID and params.MaxID which order is new to old.
+// an empty page means no more tweets.
+type Source interface {
+	Fetch(ctx context.Context, client *twitter.Client, params *PageParams) ([]twitter.Tweet, *http.Response, error)
+	String() string
+}
+
+// TimeIDSource is Source whose ids are not tweet ids of Twitter but ordered by posted time too (e.g. Mastodon).
+// MinID returns the minimum id posted at t. SnowflakeID is used for other Sources.
+type TimeIDSource interface {
+	Source
+	MinID(t time.Time) int64
+}
+
+var (
+	trueValue  = true
+	falseValue = false
+)
+
+// boolParam returns param if set, otherwise def.
+func boolParam(param *bool, def *bool) *bool {
+	if param != nil {
+		return param
+	}
+	return def
+}
+
+// limitCount limits Count of params to max which API accepts and returns it.
+func limitCount(params *PageParams, max int) int {
+	if params.Count > max {
+		params.Count = max
+	}
+	return params.Count
+}
+
+// UserTimelineSource is tweets of a user.
+// user_timeline API applies count before excluding retweets and replies, so a page can be short or empty while older tweets exist.
+// Loader does not take such a page as the end of tweets.
+// https://developer.twitter.com/en/docs/tweets/timelines/api-reference/get-statuses-user_timeline.html
+type UserTimelineSource struct {
+	UserID     int64
+	ScreenName string
+}
+
+// Fetch fetches a page of user timeline. retweets and replies are included by default.
+func (s *UserTimelineSource) Fetch(ctx context.Context, client *twitter.Client, params *PageParams) ([]twitter.Tweet, *http.Response, error) {
+	return client.Timelines.UserTimeline(&twitter.UserTimelineParams{
+		ScreenName:      s.ScreenName,
+		UserID:          s.UserID,
+		TrimUser:        boolParam(params.TrimUser, &trueValue),
+		IncludeRetweets: boolParam(params.IncludeRetweets, &trueValue),
+		ExcludeReplies:  boolParam(params.ExcludeReplies, &falseValue),
+		MaxID:           params.MaxID,
+		SinceID:         params.SinceID,
+		Count:           limitCount(params, 200),
+	})
+}
+
+// String returns user
+func (s *UserTimelineSource) String() string {
+	if s.ScreenName != "" {
+		return fmt.Sprintf("user(%v)", s.ScreenName)
+	}
+	return fmt.Sprintf("user(%d)", s.UserID)
+}
+
+// HomeTimelineSource is tweets of users the authenticated user follows and the authenticated user.
+// home_timeline API applies count before excluding replies like UserTimelineSource.
+// https://developer.twitter.com/en/docs/tweets/timelines/api-reference/get-statuses-home_timeline.html
+type HomeTimelineSource struct{}
+
+// Fetch fetches a page of home timeline. replies are included by default.
+func (s *HomeTimelineSource) Fetch(ctx context.Context, client *twitter.Client, params *PageParams) ([]twitter.Tweet, *http.Response, error) {
+	return client.Timelines.HomeTimeline(&twitter.HomeTimelineParams{
+		TrimUser:       boolParam(params.TrimUser, &trueValue),
+		ExcludeReplies: boolParam(params.ExcludeReplies, &falseValue),
+		MaxID:          params.MaxID,
+		SinceID:        params.SinceID,
+		Count:          limitCount(params, 200),
+	})
+}
+
+// String returns home
+func (s *HomeTimelineSource) String() string {
+	return "home"
+}
+
+// MentionsSource is tweets mentioning the authenticated user.
+// https://developer.twitter.com/en/docs/tweets/timelines/api-reference/get-statuses-mentions_timeline.html
+type MentionsSource struct{}
+
+// Fetch fetches a page of mentions timeline.
+func (s *MentionsSource) Fetch(ctx context.Context, client *twitter.Client, params *PageParams) ([]twitter.Tweet, *http.Response, error) {
+	return client.Timelines.MentionTimeline(&twitter.MentionTimelineParams{
+		TrimUser: boolParam(params.TrimUser, &trueValue),
+		MaxID:    params.MaxID,
+		SinceID:  params.SinceID,
+		Count:    limitCount(params, 200),
+	})
+}
+
+// String returns mentions
+func (s *MentionsSource) String() string {
+	return "mentions"
+}
+
+// ListSource is tweets of members of a List. the List is specified by ListID or OwnerScreenName and Slug.
+// lists/statuses API applies count before excluding retweets like UserTimelineSource.
+// https://developer.twitter.com/en/docs/accounts-and-users/create-manage-lists/api-reference/get-lists-statuses
+type ListSource struct {
+	ListID          int64
+	OwnerScreenName string
+	Slug            string
+}
+
+// Fetch fetches a page of list timeline. retweets are included by default.
+func (s *ListSource) Fetch(ctx context.Context, client *twitter.Client, params *PageParams) ([]twitter.Tweet, *http.Response, error) {
+	p := &twitter.ListsStatusesParams{
+		ListID:          s.ListID,
+		IncludeRetweets: boolParam(params.IncludeRetweets, &trueValue),
+		MaxID:           params.MaxID,
+		SinceID:         params.SinceID,
+		Count:           limitCount(params, 200),
+	}
+	if s.ListID == 0 {
+		p.OwnerScreenName, p.Slug = s.OwnerScreenName, s.Slug
+	}
+	return client.Lists.Statuses(p)
+}
+
+// String returns list
+func (s *ListSource) String() string {
+	if s.ListID == 0 {
+		return fmt.Sprintf("list(%v/%v)", s.OwnerScreenName, s.Slug)
+	}
+	return fmt.Sprintf("list(%d)", s.ListID)
+}
+
+// LikesSource is tweets liked by a user.
+// favorites/list API pages liked tweets by tweet id not by liked time,
+// so old tweets liked after the checkpoint (sinceId) are not loaded.
+// https://developer.twitter.com/en/docs/tweets/post-and-engage/api-reference/get-favorites-list
+type LikesSource struct {
+	UserID     int64
+	ScreenName string
+}
+
+// Fetch fetches a page of liked tweets.
+func (s *LikesSource) Fetch(ctx context.Context, client *twitter.Client, params *PageParams) ([]twitter.Tweet, *http.Response, error) {
+	return client.Favorites.List(&twitter.FavoriteListParams{
+		UserID:          s.UserID,
+		ScreenName:      s.ScreenName,
+		IncludeEntities: &trueValue,
+		MaxID:           params.MaxID,
+		SinceID:         params.SinceID,
+		Count:           limitCount(params, 200),
+	})
+}
+
+// String returns likes
+func (s *LikesSource) String() string {
+	if s.ScreenName != "" {
+		return fmt.Sprintf("likes(%v)", s.ScreenName)
+	}
+	return fmt.Sprintf("likes(%d)", s.UserID)
+}
+
+// SearchWindow is the period standard search API can search.
+// Loader of SearchSource should use SearchWindow as fallback.
+const SearchWindow = 7 * 24 * time.Hour
+
+// SearchSource is recent tweets matching the query of standard search API.
+// search API has its own rate limit. RateLimiter shares it among SearchSources.
+// https://developer.twitter.com/en/docs/tweets/search/api-reference/get-search-tweets
+type SearchSource struct {
+	Query string
+}
+
+// Fetch fetches a page of search results.
+func (s *SearchSource) Fetch(ctx context.Context, client *twitter.Client, params *PageParams) ([]twitter.Tweet, *http.Response, error) {
+	search, resp, err := client.Search.Tweets(&twitter.SearchTweetParams{
+		Query:           s.Query,
+		ResultType:      "recent",
+		IncludeEntities: &trueValue,
+		MaxID:           params.MaxID,
+		SinceID:         params.SinceID,
+		Count:           limitCount(params, 100),
+	})
+	if err != nil || search == nil {
+		return nil, resp, err
+	}
+	return search.Statuses, resp, nil
+}
+
+// String returns search
+func (s *SearchSource) String() string {
+	return fmt.Sprintf("search(%q)", s.Query)
+}
@@ -0,0 +1,251 @@
+package twilter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cenkalti/backoff"
+	"github.com/dghubble/go-twitter/twitter"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultStreamURL = "https://stream.twitter.com/1.1/statuses/filter.json"
+	// twitter sends keep-alive newline every 30 seconds. reconnect if nothing comes for 90 seconds.
+	defaultStallTimeout = 90 * time.Second
+	// a message of streaming API is up to several tens of KB.
+	maxStreamMessage = 1024 * 1024
+)
+
+// StreamOption ...
+type StreamOption struct {
+	// URL is the endpoint of statuses/filter API. mainly for tests.
+	URL string
+	// StallTimeout is the time to reconnect when nothing comes from the stream.
+	StallTimeout time.Duration
+}
+
+// FilterStream receives tweets of users in real time from statuses/filter streaming API.
+// https://developer.twitter.com/en/docs/tweets/filter-realtime/api-reference/post-statuses-filter.html
+//
+// FilterStream reconnects with the documented strategy.
+// https://developer.twitter.com/en/docs/tweets/filter-realtime/guides/connecting.html
+//
+//   - network errors and stalls : back off linearly by 250ms up to 16 seconds.
+//   - HTTP errors : back off exponentially from 5 seconds up to 320 seconds.
+//   - rate limited (420, 429) : back off exponentially from 1 minute.
+type FilterStream struct {
+	client *http.Client
+	url    string
+	follow []int64
+	stall  time.Duration
+
+	network backoff.BackOff
+	http    backoff.BackOff
+	limited backoff.BackOff
+}
+
+// NewFilterStream returns FilterStream which follows users. client must be authorized (e.g. by oauth1).
+func NewFilterStream(client *http.Client, follow []int64, option *StreamOption) *FilterStream {
+	// set default options
+	if option == nil {
+		option = new(StreamOption)
+	}
+	if option.URL == "" {
+		option.URL = defaultStreamURL
+	}
+	if option.StallTimeout == 0 {
+		option.StallTimeout = defaultStallTimeout
+	}
+
+	return &FilterStream{
+		client:  client,
+		url:     option.URL,
+		follow:  follow,
+		stall:   option.StallTimeout,
+		network: &linearBackOff{step: 250 * time.Millisecond, max: 16 * time.Second},
+		http:    newExponentialBackOff(5*time.Second, 320*time.Second),
+		limited: newExponentialBackOff(time.Minute, 16*time.Minute),
+	}
+}
+
+// Run receives tweets and reconnects until ctx is done. Run returns ctx.Err().
+// onConnect is called each time connected before receiving tweets. tweets posted while disconnected are not delivered,
+// so onConnect should fill the gap (e.g. by Loader). onTweet is called for each tweet.
+// both are called by the goroutine reading the stream and Twitter disconnects stalled readers, so they should not block.
+func (s *FilterStream) Run(ctx context.Context, onConnect func(), onTweet func(tweet *twitter.Tweet)) error {
+	for {
+		wait, err := s.connect(ctx, onConnect, onTweet)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("stream disconnected : %v. reconnect after %v\n", err, wait)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// connect connects to the stream and receives tweets until disconnected.
+// returns the time to wait before reconnecting and the reason of disconnection.
+func (s *FilterStream) connect(ctx context.Context, onConnect func(), onTweet func(tweet *twitter.Tweet)) (time.Duration, error) {
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ids := make([]string, len(s.follow))
+	for i, id := range s.follow {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	form := url.Values{"follow": {strings.Join(ids, ",")}}
+	req, err := http.NewRequest(http.MethodPost, s.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return s.network.NextBackOff(), err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req.WithContext(cctx))
+	if err != nil {
+		return s.network.NextBackOff(), err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == 420 || resp.StatusCode == http.StatusTooManyRequests:
+		return s.limited.NextBackOff(), fmt.Errorf("request to stream : %v", resp.Status)
+	case resp.StatusCode >= 300:
+		return s.http.NextBackOff(), fmt.Errorf("request to stream : %v", resp.Status)
+	}
+
+	// connected
+	s.network.Reset()
+	s.http.Reset()
+	s.limited.Reset()
+	if onConnect != nil {
+		onConnect()
+	}
+
+	// close the connection when stalled
+	stall := time.AfterFunc(s.stall, cancel)
+	defer stall.Stop()
+
+	// messages are delimited by \r\n. tweets may contain \n in text.
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamMessage)
+	scanner.Split(scanCRLF)
+	for scanner.Scan() {
+		stall.Reset(s.stall)
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			// keep-alive
+			continue
+		}
+		if err = handleStreamMessage(line, onTweet); err != nil {
+			log.Println("failed to handle stream message :", err)
+		}
+	}
+
+	if cctx.Err() != nil && ctx.Err() == nil {
+		err = fmt.Errorf("stream stalled for %v", s.stall)
+	} else if err = scanner.Err(); err == nil {
+		err = fmt.Errorf("stream closed")
+	}
+	return s.network.NextBackOff(), err
+}
+
+// streamMessage is a message of streaming API. only one of fields is set.
+// https://developer.twitter.com/en/docs/tweets/filter-realtime/guides/streaming-message-types
+type streamMessage struct {
+	// tweet has id and user
+	ID   int64           `json:"id"`
+	User json.RawMessage `json:"user"`
+
+	Disconnect *struct {
+		Code   int    `json:"code"`
+		Reason string `json:"reason"`
+	} `json:"disconnect"`
+	Warning *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"warning"`
+}
+
+// handleStreamMessage parses the message and calls onTweet if the message is tweet.
+// other messages than tweet, disconnect and warning (e.g. delete, limit) are ignored.
+func handleStreamMessage(line []byte, onTweet func(tweet *twitter.Tweet)) error {
+	var msg streamMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return err
+	}
+	switch {
+	case msg.ID != 0 && len(msg.User) > 0:
+		var tweet twitter.Tweet
+		if err := json.Unmarshal(line, &tweet); err != nil {
+			return err
+		}
+		onTweet(&tweet)
+	case msg.Disconnect != nil:
+		// the connection will be closed by twitter
+		log.Printf("stream disconnect message : %v (%d)\n", msg.Disconnect.Reason, msg.Disconnect.Code)
+	case msg.Warning != nil:
+		log.Printf("stream warning : %v (%v)\n", msg.Warning.Message, msg.Warning.Code)
+	}
+	return nil
+}
+
+// scanCRLF is bufio.SplitFunc which splits by \r\n.
+func scanCRLF(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.Index(data, []byte("\r\n")); i >= 0 {
+		return i + 2, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// linearBackOff increases the interval by step up to max.
+type linearBackOff struct {
+	step    time.Duration
+	max     time.Duration
+	current time.Duration
+}
+
+// NextBackOff returns the next interval.
+func (b *linearBackOff) NextBackOff() time.Duration {
+	if b.current += b.step; b.current > b.max {
+		b.current = b.max
+	}
+	return b.current
+}
+
+// Reset resets the interval.
+func (b *linearBackOff) Reset() {
+	b.current = 0
+}
+
+// newExponentialBackOff returns backoff which doubles the interval from initial up to max and never stops.
+func newExponentialBackOff(initial, max time.Duration) *backoff.ExponentialBackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = initial
+	b.MaxInterval = max
+	b.Multiplier = 2
+	b.RandomizationFactor = 0
+	b.MaxElapsedTime = 0
+	b.Reset()
+	return b
+}
@@ -0,0 +1,159 @@
+package twilter
+
+import (
+	"context"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/kawasin73/twilter/twittertest"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// streamPath is the path of statuses/filter API.
+const streamPath = "/1.1/statuses/filter.json"
+
+// streamHandlers responds each connection by handlers in order. the last handler is used repeatedly.
+type streamHandlers struct {
+	mu       sync.Mutex
+	handlers []http.HandlerFunc
+}
+
+func (s *streamHandlers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	handler := s.handlers[0]
+	if len(s.handlers) > 1 {
+		s.handlers = s.handlers[1:]
+	}
+	s.mu.Unlock()
+	handler(w, r)
+}
+
+// newFakeStream starts twittertest.Server which serves statuses/filter by handlers.
+func newFakeStream(handlers ...http.HandlerFunc) *twittertest.Server {
+	server := twittertest.NewServer()
+	server.Handle(streamPath, &streamHandlers{handlers: handlers})
+	return server
+}
+
+func streamTweets(messages ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, msg := range messages {
+			fmt.Fprint(w, msg+"\r\n")
+		}
+		w.(http.Flusher).Flush()
+	}
+}
+
+func streamStatus(code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}
+}
+
+// streamHang keeps the connection open until the client disconnects.
+func streamHang(w http.ResponseWriter, r *http.Request) {
+	w.(http.Flusher).Flush()
+	<-r.Context().Done()
+}
+
+func newTestStream(server *twittertest.Server, stall time.Duration) *FilterStream {
+	s := NewFilterStream(server.Client(), []int64{1, 2}, &StreamOption{StallTimeout: stall})
+	s.network = &linearBackOff{step: time.Millisecond, max: 10 * time.Millisecond}
+	s.http = newExponentialBackOff(time.Millisecond, 10*time.Millisecond)
+	s.limited = newExponentialBackOff(time.Millisecond, 10*time.Millisecond)
+	return s
+}
+
+func TestFilterStream(t *testing.T) {
+	server := newFakeStream(
+		streamStatus(http.StatusServiceUnavailable),
+		streamStatus(420),
+		streamTweets(
+			`{"id":10,"text":"multi\nline","user":{"id":1}}`,
+			``,
+			`{"delete":{"status":{"id":9,"user_id":1}}}`,
+			`{"limit":{"track":3}}`,
+			`{"id":11,"text":"second","user":{"id":2}}`,
+			`{"disconnect":{"code":4,"reason":"duplicate stream"}}`,
+		),
+		streamTweets(`{"id":12,"text":"third","user":{"id":1}}`),
+		streamHang,
+	)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		connected int
+		tweets    []int64
+	)
+	err := newTestStream(server, time.Minute).Run(ctx, func() {
+		// the third connection hangs
+		if connected++; connected == 3 {
+			cancel()
+		}
+	}, func(tweet *twitter.Tweet) {
+		tweets = append(tweets, tweet.ID)
+		if tweet.ID == 10 && tweet.Text != "multi\nline" {
+			t.Errorf("text = %q", tweet.Text)
+		}
+	})
+	if err != context.Canceled {
+		t.Errorf("err = %v", err)
+	}
+	if connected != 3 {
+		t.Errorf("connected %d times", connected)
+	}
+	if fmt.Sprint(tweets) != "[10 11 12]" {
+		t.Errorf("tweets = %v", tweets)
+	}
+	for _, req := range server.Requests() {
+		if req.Path != streamPath || req.Query.Get("follow") != "1,2" {
+			t.Errorf("request = %v %v", req.Path, req.Query)
+		}
+	}
+}
+
+func TestFilterStreamStall(t *testing.T) {
+	server := newFakeStream(streamHang)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	connected := 0
+	_ = newTestStream(server, 50*time.Millisecond).Run(ctx, func() {
+		if connected++; connected == 3 {
+			cancel()
+		}
+	}, func(tweet *twitter.Tweet) {})
+	if connected != 3 {
+		t.Errorf("reconnected %d times after stall", connected-1)
+	}
+}
+
+func TestBackOff(t *testing.T) {
+	linear := &linearBackOff{step: 250 * time.Millisecond, max: time.Second}
+	var waits []time.Duration
+	for i := 0; i < 6; i++ {
+		waits = append(waits, linear.NextBackOff())
+	}
+	if fmt.Sprint(waits) != "[250ms 500ms 750ms 1s 1s 1s]" {
+		t.Errorf("linear = %v", waits)
+	}
+	linear.Reset()
+	if wait := linear.NextBackOff(); wait != 250*time.Millisecond {
+		t.Errorf("linear after reset = %v", wait)
+	}
+
+	exp := newExponentialBackOff(5*time.Second, 20*time.Second)
+	waits = nil
+	for i := 0; i < 5; i++ {
+		waits = append(waits, exp.NextBackOff())
+	}
+	if fmt.Sprint(waits) != "[5s 10s 20s 20s 20s]" {
+		t.Errorf("exponential = %v", waits)
+	}
+}
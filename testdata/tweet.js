@@ -0,0 +1,138 @@
+window.YTD.tweet.part0 = [ {
+  "tweet" : {
+    "retweeted" : false,
+    "source" : "<a href=\"https://mobile.twitter.com\" rel=\"nofollow\">Twitter Web App</a>",
+    "entities" : {
+      "hashtags" : [ {
+        "text" : "art",
+        "indices" : [ "10", "14" ]
+      } ],
+      "symbols" : [ ],
+      "user_mentions" : [ ],
+      "urls" : [ ]
+    },
+    "display_text_range" : [ "0", "14" ],
+    "favorite_count" : "12",
+    "id_str" : "1096765000000000003",
+    "truncated" : false,
+    "retweet_count" : "2",
+    "id" : "1096765000000000003",
+    "created_at" : "Sat Feb 16 12:00:00 +0000 2019",
+    "favorited" : false,
+    "full_text" : "new piece #art",
+    "lang" : "en"
+  }
+}, {
+  "tweet" : {
+    "retweeted" : false,
+    "source" : "<a href=\"https://mobile.twitter.com\" rel=\"nofollow\">Twitter Web App</a>",
+    "entities" : {
+      "hashtags" : [ ],
+      "symbols" : [ ],
+      "user_mentions" : [ ],
+      "urls" : [ ],
+      "media" : [ {
+        "expanded_url" : "https://twitter.com/example/status/1096765000000000002/photo/1",
+        "indices" : [ "7", "30" ],
+        "url" : "https://t.co/abcdefghij",
+        "media_url" : "http://pbs.twimg.com/media/AAAAAAAAAAAAAAA.jpg",
+        "id_str" : "1096764999000000001",
+        "id" : "1096764999000000001",
+        "media_url_https" : "https://pbs.twimg.com/media/AAAAAAAAAAAAAAA.jpg",
+        "sizes" : {
+          "large" : { "w" : "2048", "h" : "1536", "resize" : "fit" },
+          "small" : { "w" : "680", "h" : "510", "resize" : "fit" }
+        },
+        "type" : "photo",
+        "display_url" : "pic.twitter.com/abcdefghij"
+      } ]
+    },
+    "display_text_range" : [ "0", "6" ],
+    "favorite_count" : "30",
+    "id_str" : "1096765000000000002",
+    "truncated" : false,
+    "retweet_count" : "5",
+    "id" : "1096765000000000002",
+    "possibly_sensitive" : false,
+    "created_at" : "Sat Feb 16 11:00:00 +0000 2019",
+    "favorited" : false,
+    "full_text" : "sketch https://t.co/abcdefghij",
+    "lang" : "en",
+    "extended_entities" : {
+      "media" : [ {
+        "expanded_url" : "https://twitter.com/example/status/1096765000000000002/photo/1",
+        "indices" : [ "7", "30" ],
+        "url" : "https://t.co/abcdefghij",
+        "media_url" : "http://pbs.twimg.com/media/AAAAAAAAAAAAAAA.jpg",
+        "id_str" : "1096764999000000001",
+        "id" : "1096764999000000001",
+        "media_url_https" : "https://pbs.twimg.com/media/AAAAAAAAAAAAAAA.jpg",
+        "sizes" : {
+          "large" : { "w" : "2048", "h" : "1536", "resize" : "fit" },
+          "small" : { "w" : "680", "h" : "510", "resize" : "fit" }
+        },
+        "type" : "photo",
+        "display_url" : "pic.twitter.com/abcdefghij"
+      } ]
+    }
+  }
+}, {
+  "tweet" : {
+    "retweeted" : false,
+    "source" : "<a href=\"https://mobile.twitter.com\" rel=\"nofollow\">Twitter Web App</a>",
+    "entities" : {
+      "hashtags" : [ ],
+      "symbols" : [ ],
+      "user_mentions" : [ {
+        "name" : "Someone",
+        "screen_name" : "someone",
+        "indices" : [ "3", "11" ],
+        "id_str" : "30",
+        "id" : "30"
+      } ],
+      "urls" : [ ]
+    },
+    "display_text_range" : [ "0", "40" ],
+    "favorite_count" : "0",
+    "id_str" : "1096765000000000001",
+    "truncated" : false,
+    "retweet_count" : "0",
+    "id" : "1096765000000000001",
+    "created_at" : "Sat Feb 16 10:00:00 +0000 2019",
+    "favorited" : false,
+    "full_text" : "RT @someone: an interesting thread",
+    "lang" : "en"
+  }
+}, {
+  "tweet" : {
+    "retweeted" : false,
+    "source" : "<a href=\"https://mobile.twitter.com\" rel=\"nofollow\">Twitter Web App</a>",
+    "entities" : {
+      "hashtags" : [ ],
+      "symbols" : [ ],
+      "user_mentions" : [ {
+        "name" : "Someone",
+        "screen_name" : "someone",
+        "indices" : [ "0", "8" ],
+        "id_str" : "30",
+        "id" : "30"
+      } ],
+      "urls" : [ ]
+    },
+    "display_text_range" : [ "0", "16" ],
+    "favorite_count" : "1",
+    "in_reply_to_status_id_str" : "1096764000000000000",
+    "id_str" : "1096765000000000004",
+    "in_reply_to_user_id" : "30",
+    "truncated" : false,
+    "retweet_count" : "0",
+    "id" : "1096765000000000004",
+    "in_reply_to_status_id" : "1096764000000000000",
+    "created_at" : "Sat Feb 16 13:00:00 +0000 2019",
+    "favorited" : false,
+    "full_text" : "@someone thanks!",
+    "lang" : "en",
+    "in_reply_to_screen_name" : "someone",
+    "in_reply_to_user_id_str" : "30"
+  }
+} ]
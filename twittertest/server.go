@@ -0,0 +1,541 @@
+// Package twittertest provides a fake server of Twitter API v1.1 for tests which run without network access.
+//
+//	server := twittertest.NewServer()
+//	defer server.Close()
+//	server.AddUser(twitter.User{ID: 10, ScreenName: "alice"})
+//	server.AddTweets(twitter.Tweet{ID: 100, User: &twitter.User{ID: 10}, Text: "hello"})
+//	client := twitter.NewClient(server.Client())
+//
+// requests to any host (e.g. api.twitter.com) by the client of Server are sent to the fake server.
+// faults are injected by Inject to test retries, rate limits and errors.
+// other APIs (e.g. API v2 and streaming API) are served by handlers of tests registered by Handle.
+// tweets in the shape of API responses are built by Tweet (see TweetBuilder).
+package twittertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// error codes of Twitter API returned by Server.
+const (
+	codeNoUserMatches     = 17
+	codePageNotExist      = 34
+	codeUserNotFound      = 50
+	codeRateLimitExceeded = 88
+	codeInvalidToken      = 89
+	codeStatusNotFound    = 144
+	codeDuplicateStatus   = 187
+	codeAlreadyRetweeted  = 327
+)
+
+// paths of endpoints served by Server.
+const (
+	UserTimelinePath      = "/1.1/statuses/user_timeline.json"
+	ShowUserPath          = "/1.1/users/show.json"
+	LookupUsersPath       = "/1.1/users/lookup.json"
+	VerifyCredentialsPath = "/1.1/account/verify_credentials.json"
+	UpdatePath            = "/1.1/statuses/update.json"
+	// RetweetPath and UnretweetPath are followed by "<id>.json".
+	RetweetPath   = "/1.1/statuses/retweet/"
+	UnretweetPath = "/1.1/statuses/unretweet/"
+)
+
+// DefaultRateLimit is the limit of each endpoint in a window of 15 minutes.
+const DefaultRateLimit = 900
+
+// rateWindow is the rate limit window of an endpoint.
+type rateWindow struct {
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// Request is a request received by Server.
+type Request struct {
+	Method string
+	Path   string
+	// Query is the query and the form of the request.
+	Query  url.Values
+	Header http.Header
+	Body   string
+}
+
+// prefixHandler is the handler of requests whose path starts with prefix.
+type prefixHandler struct {
+	prefix  string
+	handler http.Handler
+}
+
+// Fault is an error response injected to requests.
+type Fault struct {
+	// Method and Path match requests. empty matches all.
+	Method string
+	Path   string
+	// Times is the number of requests to fail. the fault is kept if 0.
+	Times int
+
+	// Status is the http status code of the response.
+	Status int
+	// Code is the error code of Twitter API in the response body. no body if 0.
+	Code    int
+	Message string
+	// Header is set to the response (e.g. X-Rate-Limit-Reset).
+	Header http.Header
+	// Delay delays the response. it can be used to test timeouts.
+	Delay time.Duration
+}
+
+// match returns true if the fault matches the request.
+func (f *Fault) match(r *http.Request) bool {
+	return (f.Method == "" || f.Method == r.Method) && (f.Path == "" || f.Path == r.URL.Path)
+}
+
+// Server is the fake server of Twitter API v1.1.
+// it serves statuses/user_timeline, users/show, users/lookup, statuses/retweet, statuses/unretweet, statuses/update
+// and account/verify_credentials with X-Rate-Limit-* headers of each endpoint.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	self      *twitter.User
+	users     map[int64]*twitter.User
+	tweets    []twitter.Tweet // new to old
+	retweeted map[int64]bool
+	retweets  []int64
+	nextID    int64
+	windows   map[string]*rateWindow
+	faults    []*Fault
+	requests  []Request
+	handlers  []prefixHandler
+}
+
+// NewServer starts Server. the authenticated user is not set and verify_credentials fails until SetSelf.
+func NewServer() *Server {
+	s := &Server{
+		users:     make(map[int64]*twitter.User),
+		retweeted: make(map[int64]bool),
+		windows:   make(map[string]*rateWindow),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// rewriteTransport sends requests to the server instead of the host of the url.
+type rewriteTransport struct {
+	server *url.URL
+	next   http.RoundTripper
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+	u := *req.URL
+	u.Scheme, u.Host = t.server.Scheme, t.server.Host
+	r.URL = &u
+	return t.next.RoundTrip(r)
+}
+
+// Transport returns http.RoundTripper which sends requests to any host to Server.
+func (s *Server) Transport() http.RoundTripper {
+	u, _ := url.Parse(s.URL)
+	return &rewriteTransport{server: u, next: s.Server.Client().Transport}
+}
+
+// Client returns http.Client which sends requests to any host to Server.
+func (s *Server) Client() *http.Client {
+	return &http.Client{Transport: s.Transport()}
+}
+
+// SetSelf sets the authenticated user returned by verify_credentials.
+func (s *Server) SetSelf(user twitter.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.self = &user
+	s.users[user.ID] = &user
+}
+
+// AddUser adds the user served by users/show.
+func (s *Server) AddUser(user twitter.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user.ID] = &user
+}
+
+// AddTweets adds tweets to timelines of their users. users of tweets are added if unknown.
+func (s *Server) AddTweets(tweets ...twitter.Tweet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tweet := range tweets {
+		if tweet.IDStr == "" {
+			tweet.IDStr = strconv.FormatInt(tweet.ID, 10)
+		}
+		if tweet.User != nil {
+			if user, ok := s.users[tweet.User.ID]; ok {
+				tweet.User = user
+			} else {
+				s.users[tweet.User.ID] = tweet.User
+			}
+		}
+		s.tweets = append(s.tweets, tweet)
+	}
+	sort.SliceStable(s.tweets, func(i, j int) bool { return s.tweets[i].ID > s.tweets[j].ID })
+}
+
+// DeleteTweet deletes the tweet. retweet of it fails as not found.
+func (s *Server) DeleteTweet(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.tweets {
+		if s.tweets[i].ID == id {
+			s.tweets = append(s.tweets[:i], s.tweets[i+1:]...)
+			return
+		}
+	}
+}
+
+// Retweeted returns ids of tweets retweeted by the authenticated user in order. unretweeted tweets are not removed.
+func (s *Server) Retweeted() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.retweets...)
+}
+
+// Handle serves requests whose path starts with prefix by handler instead of the endpoints of v1.1.
+// the requests are recorded and faults are injected like requests to v1.1, but rate limits are not counted.
+func (s *Server) Handle(prefix string, handler http.Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers = append(s.handlers, prefixHandler{prefix: prefix, handler: handler})
+}
+
+// Requests returns requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// SetRateLimit sets the rate limit window of the endpoint (e.g. UserTimelinePath).
+// requests over the limit fail with 429 until reset.
+func (s *Server) SetRateLimit(path string, limit, remaining int, reset time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.windows[path] = &rateWindow{limit: limit, remaining: remaining, reset: reset}
+}
+
+// Inject adds faults. a request fails by the first matched fault.
+func (s *Server) Inject(faults ...*Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, faults...)
+}
+
+// ClearFaults removes all faults.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Error returns Fault of the error code of Twitter API which fails the next request to path. empty path matches all.
+func Error(path string, status, code int, message string) *Fault {
+	return &Fault{Path: path, Status: status, Code: code, Message: message, Times: 1}
+}
+
+// RateLimited returns Fault of rate limit exceeded of path which is reset at reset.
+func RateLimited(path string, reset time.Time) *Fault {
+	header := make(http.Header)
+	header.Set("X-Rate-Limit-Limit", strconv.Itoa(DefaultRateLimit))
+	header.Set("X-Rate-Limit-Remaining", "0")
+	header.Set("X-Rate-Limit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	return &Fault{Path: path, Status: http.StatusTooManyRequests, Code: codeRateLimitExceeded, Message: "Rate limit exceeded", Header: header, Times: 1}
+}
+
+// fault returns the fault of the request and consumes it.
+func (s *Server) fault(r *http.Request) *Fault {
+	for i, f := range s.faults {
+		if !f.match(r) {
+			continue
+		}
+		if f.Times > 0 {
+			if f.Times--; f.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+// writeError writes the error response of Twitter API.
+func writeError(w http.ResponseWriter, status, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if code != 0 {
+		fmt.Fprintf(w, `{"errors":[{"code":%d,"message":%q}]}`, code, message)
+	}
+}
+
+// writeJSON writes the response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// rateLimit counts the request in the window of the endpoint and sets X-Rate-Limit-* headers. returns false if limited.
+func (s *Server) rateLimit(w http.ResponseWriter, path string) bool {
+	window, ok := s.windows[path]
+	if !ok || !time.Now().Before(window.reset) {
+		window = &rateWindow{limit: DefaultRateLimit, remaining: DefaultRateLimit, reset: time.Now().Add(15 * time.Minute)}
+		s.windows[path] = window
+	}
+	limited := window.remaining <= 0
+	if !limited {
+		window.remaining--
+	}
+	w.Header().Set("X-Rate-Limit-Limit", strconv.Itoa(window.limit))
+	w.Header().Set("X-Rate-Limit-Remaining", strconv.Itoa(window.remaining))
+	w.Header().Set("X-Rate-Limit-Reset", strconv.FormatInt(window.reset.Unix(), 10))
+	return !limited
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	// keep the body for handlers.
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	_ = r.ParseForm()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Query: r.Form, Header: r.Header, Body: string(body)})
+	if f := s.fault(r); f != nil {
+		s.mu.Unlock()
+		if f.Delay > 0 {
+			select {
+			case <-time.After(f.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		for key, values := range f.Header {
+			w.Header()[key] = values
+		}
+		if f.Status != 0 {
+			writeError(w, f.Status, f.Code, f.Message)
+			return
+		}
+		s.mu.Lock()
+	}
+	for _, h := range s.handlers {
+		if strings.HasPrefix(r.URL.Path, h.prefix) {
+			s.mu.Unlock()
+			h.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+	defer s.mu.Unlock()
+
+	path := r.URL.Path
+	if r.Method == http.MethodGet && !s.rateLimit(w, path) {
+		writeError(w, http.StatusTooManyRequests, codeRateLimitExceeded, "Rate limit exceeded")
+		return
+	}
+
+	switch {
+	case path == UserTimelinePath && r.Method == http.MethodGet:
+		s.userTimeline(w, r)
+	case path == ShowUserPath && r.Method == http.MethodGet:
+		s.showUser(w, r)
+	case path == LookupUsersPath:
+		s.lookupUsers(w, r)
+	case path == VerifyCredentialsPath && r.Method == http.MethodGet:
+		if s.self == nil {
+			writeError(w, http.StatusUnauthorized, codeInvalidToken, "Invalid or expired token.")
+			return
+		}
+		writeJSON(w, s.self)
+	case path == UpdatePath && r.Method == http.MethodPost:
+		s.update(w, r.Form.Get("status"))
+	case strings.HasPrefix(path, RetweetPath) && r.Method == http.MethodPost:
+		s.retweet(w, strings.TrimSuffix(strings.TrimPrefix(path, RetweetPath), ".json"))
+	case strings.HasPrefix(path, UnretweetPath) && r.Method == http.MethodPost:
+		s.unretweet(w, strings.TrimSuffix(strings.TrimPrefix(path, UnretweetPath), ".json"))
+	default:
+		writeError(w, http.StatusNotFound, codePageNotExist, "Sorry, that page does not exist.")
+	}
+}
+
+// lookupUser returns the user of user_id or screen_name.
+func (s *Server) lookupUser(form url.Values) *twitter.User {
+	if id, err := strconv.ParseInt(form.Get("user_id"), 10, 64); err == nil {
+		return s.users[id]
+	}
+	for _, user := range s.users {
+		if name := form.Get("screen_name"); name != "" && strings.EqualFold(user.ScreenName, name) {
+			return user
+		}
+	}
+	return nil
+}
+
+// formInt returns the integer parameter. def if not set.
+func formInt(form url.Values, key string, def int64) int64 {
+	if v, err := strconv.ParseInt(form.Get(key), 10, 64); err == nil {
+		return v
+	}
+	return def
+}
+
+// userTimeline serves tweets of the user new to old between since_id (exclusive) and max_id (inclusive).
+// like Twitter, count is applied before retweets and replies are excluded, so pages may be less than count.
+func (s *Server) userTimeline(w http.ResponseWriter, r *http.Request) {
+	user := s.lookupUser(r.Form)
+	if user == nil {
+		writeError(w, http.StatusNotFound, codeUserNotFound, "User not found.")
+		return
+	}
+	sinceID, maxID := formInt(r.Form, "since_id", 0), formInt(r.Form, "max_id", 0)
+	count := int(formInt(r.Form, "count", 20))
+	if count > 200 {
+		count = 200
+	}
+	includeRetweets := r.Form.Get("include_rts") != "false"
+	excludeReplies := r.Form.Get("exclude_replies") == "true"
+	trimUser := r.Form.Get("trim_user") == "true"
+
+	timeline := []twitter.Tweet{}
+	n := 0
+	for _, tweet := range s.tweets {
+		if tweet.User == nil || tweet.User.ID != user.ID || tweet.ID <= sinceID || (maxID != 0 && tweet.ID > maxID) {
+			continue
+		}
+		if n++; n > count {
+			break
+		}
+		if (!includeRetweets && tweet.RetweetedStatus != nil) || (excludeReplies && tweet.InReplyToStatusID != 0) {
+			continue
+		}
+		tweet.Retweeted = s.retweeted[tweet.ID]
+		if trimUser {
+			tweet.User = &twitter.User{ID: tweet.User.ID, IDStr: strconv.FormatInt(tweet.User.ID, 10)}
+		}
+		timeline = append(timeline, tweet)
+	}
+	writeJSON(w, timeline)
+}
+
+// showUser serves the user.
+func (s *Server) showUser(w http.ResponseWriter, r *http.Request) {
+	user := s.lookupUser(r.Form)
+	if user == nil {
+		writeError(w, http.StatusNotFound, codeUserNotFound, "User not found.")
+		return
+	}
+	writeJSON(w, user)
+}
+
+// lookupUsers serves users of user_id separated by commas. 404 if none of them are found like Twitter.
+func (s *Server) lookupUsers(w http.ResponseWriter, r *http.Request) {
+	users := []*twitter.User{}
+	for _, idStr := range strings.Split(r.Form.Get("user_id"), ",") {
+		if id, err := strconv.ParseInt(idStr, 10, 64); err == nil && s.users[id] != nil {
+			users = append(users, s.users[id])
+		}
+	}
+	if len(users) == 0 {
+		writeError(w, http.StatusNotFound, codeNoUserMatches, "No user matches for specified terms.")
+		return
+	}
+	writeJSON(w, users)
+}
+
+// tweet returns the tweet of the id.
+func (s *Server) tweet(idStr string) *twitter.Tweet {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil
+	}
+	for i := range s.tweets {
+		if s.tweets[i].ID == id {
+			return &s.tweets[i]
+		}
+	}
+	return nil
+}
+
+// retweet retweets the tweet by the authenticated user.
+func (s *Server) retweet(w http.ResponseWriter, idStr string) {
+	tweet := s.tweet(idStr)
+	if tweet == nil {
+		writeError(w, http.StatusNotFound, codeStatusNotFound, "No status found with that ID.")
+		return
+	}
+	if s.retweeted[tweet.ID] {
+		writeError(w, http.StatusForbidden, codeAlreadyRetweeted, "You have already retweeted this Tweet.")
+		return
+	}
+	s.retweeted[tweet.ID] = true
+	s.retweets = append(s.retweets, tweet.ID)
+
+	original := *tweet
+	original.Retweeted = true
+	s.nextID++
+	retweet := twitter.Tweet{
+		ID:              tweet.ID + s.nextID,
+		IDStr:           strconv.FormatInt(tweet.ID+s.nextID, 10),
+		User:            s.self,
+		RetweetedStatus: &original,
+		Retweeted:       true,
+	}
+	writeJSON(w, retweet)
+}
+
+// unretweet unretweets the tweet. no error occurs even if the tweet is not retweeted like Twitter.
+func (s *Server) unretweet(w http.ResponseWriter, idStr string) {
+	tweet := s.tweet(idStr)
+	if tweet == nil {
+		writeError(w, http.StatusNotFound, codeStatusNotFound, "No status found with that ID.")
+		return
+	}
+	delete(s.retweeted, tweet.ID)
+	original := *tweet
+	writeJSON(w, original)
+}
+
+// update posts the status by the authenticated user. the same text as a tweet of the user is rejected as a duplicate like Twitter.
+func (s *Server) update(w http.ResponseWriter, status string) {
+	if s.self == nil {
+		writeError(w, http.StatusUnauthorized, codeInvalidToken, "Invalid or expired token.")
+		return
+	}
+	var id int64 = 1
+	for _, tweet := range s.tweets {
+		if tweet.User != nil && tweet.User.ID == s.self.ID && tweet.Text == status {
+			writeError(w, http.StatusForbidden, codeDuplicateStatus, "Status is a duplicate.")
+			return
+		}
+		if tweet.ID >= id {
+			id = tweet.ID + 1
+		}
+	}
+	tweet := twitter.Tweet{
+		ID:        id,
+		IDStr:     strconv.FormatInt(id, 10),
+		Text:      status,
+		CreatedAt: time.Now().UTC().Format(time.RubyDate),
+		User:      s.self,
+	}
+	s.tweets = append([]twitter.Tweet{tweet}, s.tweets...)
+	writeJSON(w, tweet)
+}
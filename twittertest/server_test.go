@@ -0,0 +1,232 @@
+package twittertest_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/kawasin73/twilter"
+	"github.com/kawasin73/twilter/twittertest"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fastRetry retries without waiting long in tests.
+var fastRetry = &twilter.RetryPolicy{InitialInterval: time.Millisecond, MaxInterval: time.Millisecond, MaxElapsedTime: time.Second}
+
+// newServer starts Server with 10 tweets of @alice posted every minute until now. every 3rd tweet is a reply.
+func newServer() (*twittertest.Server, []twitter.Tweet) {
+	server := twittertest.NewServer()
+	server.SetSelf(twitter.User{ID: 1, ScreenName: "dummy"})
+	server.AddUser(twitter.User{ID: 10, ScreenName: "alice"})
+	now := time.Now()
+	var tweets []twitter.Tweet
+	for i := 9; i >= 0; i-- {
+		created := now.Add(-time.Duration(i) * time.Minute)
+		tweet := twitter.Tweet{
+			ID:        twilter.SnowflakeID(created),
+			CreatedAt: created.UTC().Format(time.RubyDate),
+			Text:      fmt.Sprintf("tweet %d", 9-i),
+			User:      &twitter.User{ID: 10},
+		}
+		if (9-i)%3 == 2 {
+			tweet.InReplyToStatusID = tweets[len(tweets)-1].ID
+		}
+		tweets = append(tweets, tweet)
+	}
+	server.AddTweets(tweets...)
+	return server, tweets
+}
+
+func TestUserTimeline(t *testing.T) {
+	server, tweets := newServer()
+	defer server.Close()
+	client := twitter.NewClient(server.Client())
+
+	timeline, resp, err := client.Timelines.UserTimeline(&twitter.UserTimelineParams{ScreenName: "alice", Count: 3, MaxID: tweets[8].ID, SinceID: tweets[2].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timeline) != 3 || timeline[0].ID != tweets[8].ID || timeline[2].ID != tweets[6].ID || timeline[0].User.ScreenName != "alice" {
+		t.Errorf("timeline = %v", timeline)
+	}
+	if resp.Header.Get("X-Rate-Limit-Limit") != "900" || resp.Header.Get("X-Rate-Limit-Remaining") != "899" || resp.Header.Get("X-Rate-Limit-Reset") == "" {
+		t.Errorf("headers = %v", resp.Header)
+	}
+
+	// replies are excluded after count is applied.
+	excludeReplies, trimUser := true, true
+	timeline, _, err = client.Timelines.UserTimeline(&twitter.UserTimelineParams{UserID: 10, Count: 3, ExcludeReplies: &excludeReplies, TrimUser: &trimUser})
+	if err != nil || len(timeline) != 2 || timeline[0].ID != tweets[9].ID || timeline[1].ID != tweets[7].ID || timeline[0].User.ScreenName != "" {
+		t.Errorf("timeline = %v, %v", timeline, err)
+	}
+
+	_, resp, err = client.Timelines.UserTimeline(&twitter.UserTimelineParams{ScreenName: "nobody"})
+	if cerr := twilter.Classify(resp, err); cerr == nil || cerr.Class != twilter.TargetNotFound {
+		t.Errorf("Classify() = %v", cerr)
+	}
+	user, _, err := client.Users.Show(&twitter.UserShowParams{ScreenName: "ALICE"})
+	if err != nil || user.ID != 10 {
+		t.Errorf("Users.Show() = %v, %v", user, err)
+	}
+}
+
+func TestRetweet(t *testing.T) {
+	server, tweets := newServer()
+	defer server.Close()
+	client := twitter.NewClient(server.Client())
+	rt := twilter.NewRetweeter(client)
+	ctx := context.Background()
+
+	user, _, err := client.Accounts.VerifyCredentials(nil)
+	if err != nil || user.ScreenName != "dummy" {
+		t.Errorf("VerifyCredentials() = %v, %v", user, err)
+	}
+
+	if err := rt.Retweet(ctx, tweets[0].ID); err != nil {
+		t.Errorf("Retweet() = %v", err)
+	}
+	timeline, _, _ := client.Timelines.UserTimeline(&twitter.UserTimelineParams{UserID: 10, Count: 200})
+	if !timeline[len(timeline)-1].Retweeted {
+		t.Errorf("retweeted tweet is not marked as retweeted")
+	}
+	for _, test := range []struct {
+		id    int64
+		class twilter.ErrorClass
+	}{
+		{tweets[0].ID, twilter.AlreadyRetweeted},
+		{1, twilter.TweetDeleted},
+	} {
+		if cerr, ok := rt.Retweet(ctx, test.id).(*twilter.ClassifiedError); !ok || cerr.Class != test.class {
+			t.Errorf("Retweet(%v) = %v", test.id, cerr)
+		}
+	}
+	if err := rt.Unretweet(ctx, tweets[0].ID); err != nil {
+		t.Errorf("Unretweet() = %v", err)
+	}
+	if err := rt.Retweet(ctx, tweets[0].ID); err != nil {
+		t.Errorf("Retweet() after Unretweet() = %v", err)
+	}
+	if retweeted := server.Retweeted(); len(retweeted) != 2 || retweeted[1] != tweets[0].ID {
+		t.Errorf("Retweeted() = %v", retweeted)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	server, tweets := newServer()
+	defer server.Close()
+	client := twitter.NewClient(server.Client())
+
+	tweet, _, err := client.Statuses.Update("hello", nil)
+	if err != nil || tweet.ID <= tweets[9].ID || tweet.User.ID != 1 || tweet.Text != "hello" {
+		t.Fatalf("Update() = %v, %v", tweet, err)
+	}
+	// the same status of the authenticated user is a duplicate.
+	_, resp, err := client.Statuses.Update("hello", nil)
+	if resp == nil || resp.StatusCode != http.StatusForbidden || err == nil {
+		t.Errorf("Update() of duplicate = %v, %v", resp, err)
+	}
+	if requests := server.Requests(); requests[1].Path != twittertest.UpdatePath || requests[1].Query.Get("status") != "hello" {
+		t.Errorf("requests = %v", requests)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	server, tweets := newServer()
+	defer server.Close()
+	client := twitter.NewClient(server.Client())
+	ctx := context.Background()
+
+	// transient errors are retried.
+	server.Inject(twittertest.Error(twittertest.UserTimelinePath, http.StatusServiceUnavailable, 130, "Over capacity"))
+	loader := twilter.NewLoader(10, &twilter.LoaderOption{Size: 3, Retry: fastRetry})
+	it := loader.Stream(ctx, client, tweets[2].ID, []twilter.Filter{twilter.AllFilter{}})
+	var n int
+	for it.Next() {
+		n++
+	}
+	if stats := it.Stats(); it.Err() != nil || n != 7 || stats.APICalls != stats.Pages+1 {
+		t.Errorf("err = %v, yielded = %v, stats = %+v", it.Err(), n, stats)
+	}
+
+	// the fault is kept until cleared.
+	server.Inject(&twittertest.Fault{Path: twittertest.VerifyCredentialsPath, Status: http.StatusUnauthorized, Code: 89, Message: "Invalid or expired token."})
+	for i := 0; i < 2; i++ {
+		_, resp, err := client.Accounts.VerifyCredentials(nil)
+		if cerr := twilter.Classify(resp, err); cerr == nil || cerr.Class != twilter.AuthInvalid {
+			t.Errorf("VerifyCredentials() = %v", cerr)
+		}
+	}
+	server.ClearFaults()
+
+	// requests time out by delay.
+	server.Inject(&twittertest.Fault{Path: twittertest.ShowUserPath, Delay: time.Second, Times: 1})
+	httpClient := server.Client()
+	httpClient.Timeout = 10 * time.Millisecond
+	if _, _, err := twitter.NewClient(httpClient).Users.Show(&twitter.UserShowParams{UserID: 10}); err == nil {
+		t.Errorf("Users.Show() did not time out")
+	}
+}
+
+func TestHandle(t *testing.T) {
+	server := twittertest.NewServer()
+	defer server.Close()
+	server.Handle("/2/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	client := server.Client()
+
+	// requests to the prefix are served by the handler with the body.
+	resp, err := client.Post("https://api.twitter.com/2/users/1/retweets", "application/json", strings.NewReader(`{"tweet_id":"10"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != `{"tweet_id":"10"}` {
+		t.Errorf("response = %v %s", resp.Status, body)
+	}
+
+	// faults are injected and requests are recorded.
+	server.Inject(twittertest.Error("/2/users/1/retweets", http.StatusForbidden, 0, ""))
+	if resp, err = client.Post("https://api.twitter.com/2/users/1/retweets", "application/json", nil); err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("response = %v, %v", resp, err)
+	} else {
+		resp.Body.Close()
+	}
+	if requests := server.Requests(); len(requests) != 2 || requests[0].Body != `{"tweet_id":"10"}` || requests[0].Header.Get("Content-Type") != "application/json" {
+		t.Errorf("requests = %+v", requests)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	server, tweets := newServer()
+	defer server.Close()
+	client := twitter.NewClient(server.Client())
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	// the window is used up.
+	server.SetRateLimit(twittertest.UserTimelinePath, 900, 1, reset)
+	if _, resp, err := client.Timelines.UserTimeline(&twitter.UserTimelineParams{UserID: 10}); err != nil || resp.Header.Get("X-Rate-Limit-Remaining") != "0" {
+		t.Errorf("UserTimeline() = %v, %v", resp.Header, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, _, err := twilter.NewLoader(10, &twilter.LoaderOption{Retry: fastRetry}).Load(ctx, client, tweets[0].ID, []twilter.Filter{twilter.AllFilter{}})
+	if cerr, ok := err.(*twilter.ClassifiedError); !ok || cerr.Class != twilter.RateLimited || !cerr.ResetAt.Equal(reset) {
+		t.Errorf("Load() = %v", err)
+	}
+
+	// the fault of rate limit on an endpoint which has its own window.
+	server.Inject(twittertest.RateLimited(twittertest.ShowUserPath, reset))
+	_, resp, err := client.Users.Show(&twitter.UserShowParams{UserID: 10})
+	if limited, wait := twilter.IsRateLimit(resp); !limited || wait < 59*time.Minute {
+		t.Errorf("IsRateLimit() = %v, %v, err = %v", limited, wait, err)
+	}
+	if _, _, err = client.Users.Show(&twitter.UserShowParams{UserID: 10}); err != nil {
+		t.Errorf("Users.Show() = %v", err)
+	}
+}
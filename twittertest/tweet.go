@@ -0,0 +1,238 @@
+package twittertest
+
+import (
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// twitterEpoch is the epoch of tweet id (Snowflake) in milliseconds.
+const twitterEpoch = 1288834974657
+
+// sequence makes ids of tweets built at the same millisecond unique.
+var sequence int64
+
+// DefaultUser is the author of tweets built by TweetBuilder unless User is called.
+var DefaultUser = twitter.User{ID: 10, IDStr: "10", ScreenName: "alice", Name: "Alice"}
+
+// TweetBuilder builds twitter.Tweet in the shape of responses of Twitter API v1.1.
+//
+//	tweet := twittertest.Tweet().Text("my drawing").Photo().Build()
+//	rt := twittertest.Tweet().User(20, "bob").RetweetOf(tweet).Build()
+type TweetBuilder struct {
+	tweet     twitter.Tweet
+	createdAt time.Time
+	media     []twitter.MediaEntity
+}
+
+// Tweet starts building a tweet of DefaultUser posted now.
+func Tweet() *TweetBuilder {
+	user := DefaultUser
+	return &TweetBuilder{
+		tweet: twitter.Tweet{
+			User:     &user,
+			Entities: &twitter.Entities{},
+			Lang:     "en",
+			Source:   `<a href="https://mobile.twitter.com" rel="nofollow">Twitter Web App</a>`,
+		},
+		createdAt: time.Now(),
+	}
+}
+
+// ID sets the id. the id is generated from the posted time if not set.
+func (b *TweetBuilder) ID(id int64) *TweetBuilder {
+	b.tweet.ID = id
+	return b
+}
+
+// Text sets the text.
+func (b *TweetBuilder) Text(text string) *TweetBuilder {
+	b.tweet.Text = text
+	return b
+}
+
+// User sets the author.
+func (b *TweetBuilder) User(id int64, screenName string) *TweetBuilder {
+	b.tweet.User = &twitter.User{ID: id, IDStr: strconv.FormatInt(id, 10), ScreenName: screenName, Name: screenName}
+	return b
+}
+
+// Author sets the author object as it is (e.g. with followers_count).
+func (b *TweetBuilder) Author(user twitter.User) *TweetBuilder {
+	b.tweet.User = &user
+	return b
+}
+
+// CreatedAt sets the posted time.
+func (b *TweetBuilder) CreatedAt(t time.Time) *TweetBuilder {
+	b.createdAt = t
+	return b
+}
+
+// addMedia adds a media of the type with the t.co url appended to the text.
+func (b *TweetBuilder) addMedia(typ string) *TweetBuilder {
+	n := len(b.media) + 1
+	media := twitter.MediaEntity{
+		Type:          typ,
+		MediaURL:      fmt.Sprintf("http://pbs.twimg.com/media/%s%d.jpg", typ, n),
+		MediaURLHttps: fmt.Sprintf("https://pbs.twimg.com/media/%s%d.jpg", typ, n),
+	}
+	media.URL, media.DisplayURL = "https://t.co/media", "pic.twitter.com/media"
+	media.Sizes = twitter.MediaSizes{Large: twitter.MediaSize{Width: 2048, Height: 1536, Resize: "fit"}}
+	if typ != "photo" {
+		media.VideoInfo = twitter.VideoInfo{
+			AspectRatio:    [2]int{16, 9},
+			DurationMillis: 10000,
+			Variants:       []twitter.VideoVariant{{ContentType: "video/mp4", Bitrate: 832000, URL: fmt.Sprintf("https://video.twimg.com/%s%d.mp4", typ, n)}},
+		}
+	}
+	b.media = append(b.media, media)
+	return b
+}
+
+// Photo adds a photo.
+func (b *TweetBuilder) Photo() *TweetBuilder {
+	return b.addMedia("photo")
+}
+
+// Video adds a video.
+func (b *TweetBuilder) Video() *TweetBuilder {
+	return b.addMedia("video")
+}
+
+// GIF adds an animated gif.
+func (b *TweetBuilder) GIF() *TweetBuilder {
+	return b.addMedia("animated_gif")
+}
+
+// Hashtag adds hashtags to entities. the text is not changed.
+func (b *TweetBuilder) Hashtag(tags ...string) *TweetBuilder {
+	for _, tag := range tags {
+		b.tweet.Entities.Hashtags = append(b.tweet.Entities.Hashtags, twitter.HashtagEntity{Text: tag})
+	}
+	return b
+}
+
+// Mention adds a mention of the user to entities. the text is not changed.
+func (b *TweetBuilder) Mention(id int64, screenName string) *TweetBuilder {
+	b.tweet.Entities.UserMentions = append(b.tweet.Entities.UserMentions, twitter.MentionEntity{ID: id, IDStr: strconv.FormatInt(id, 10), ScreenName: screenName, Name: screenName})
+	return b
+}
+
+// URL adds the url to entities. the text is not changed.
+func (b *TweetBuilder) URL(url string) *TweetBuilder {
+	b.tweet.Entities.Urls = append(b.tweet.Entities.Urls, twitter.URLEntity{URL: "https://t.co/link", ExpandedURL: url, DisplayURL: strings.TrimPrefix(strings.TrimPrefix(url, "https://"), "http://")})
+	return b
+}
+
+// Sensitive marks the tweet as possibly sensitive.
+func (b *TweetBuilder) Sensitive() *TweetBuilder {
+	b.tweet.PossiblySensitive = true
+	return b
+}
+
+// Counts sets favorite_count and retweet_count.
+func (b *TweetBuilder) Counts(favorites, retweets int) *TweetBuilder {
+	b.tweet.FavoriteCount, b.tweet.RetweetCount = favorites, retweets
+	return b
+}
+
+// Lang sets the language.
+func (b *TweetBuilder) Lang(lang string) *TweetBuilder {
+	b.tweet.Lang = lang
+	return b
+}
+
+// ReplyTo makes the tweet a reply to the tweet.
+func (b *TweetBuilder) ReplyTo(tweet twitter.Tweet) *TweetBuilder {
+	b.tweet.InReplyToStatusID, b.tweet.InReplyToStatusIDStr = tweet.ID, tweet.IDStr
+	if tweet.User != nil {
+		b.tweet.InReplyToUserID, b.tweet.InReplyToUserIDStr = tweet.User.ID, tweet.User.IDStr
+		b.tweet.InReplyToScreenName = tweet.User.ScreenName
+	}
+	return b
+}
+
+// RetweetOf makes the tweet a retweet of the tweet. the text and entities are of the original tweet like Twitter.
+func (b *TweetBuilder) RetweetOf(tweet twitter.Tweet) *TweetBuilder {
+	b.tweet.RetweetedStatus = &tweet
+	return b
+}
+
+// QuoteOf makes the tweet a quote of the tweet.
+func (b *TweetBuilder) QuoteOf(tweet twitter.Tweet) *TweetBuilder {
+	b.tweet.QuotedStatus = &tweet
+	return b
+}
+
+// Build returns the tweet.
+func (b *TweetBuilder) Build() twitter.Tweet {
+	tweet := b.tweet
+	tweet.Entities = copyEntities(b.tweet.Entities)
+	if tweet.ID == 0 {
+		ms := b.createdAt.UnixNano()/int64(time.Millisecond) - twitterEpoch
+		tweet.ID = ms<<22 | atomic.AddInt64(&sequence, 1)&0xfff
+	}
+	tweet.IDStr = strconv.FormatInt(tweet.ID, 10)
+	tweet.CreatedAt = b.createdAt.UTC().Format(time.RubyDate)
+
+	if len(b.media) > 0 {
+		media := append([]twitter.MediaEntity(nil), b.media...)
+		for i := range media {
+			// videos and animated GIFs are linked as video like Twitter.
+			kind := "photo"
+			if media[i].Type == "video" || media[i].Type == "animated_gif" {
+				kind = "video"
+			}
+			media[i].ExpandedURL = fmt.Sprintf("https://twitter.com/%s/status/%s/%s/%d", tweet.User.ScreenName, tweet.IDStr, kind, i+1)
+		}
+		// entities has only the first media and extended_entities has all.
+		tweet.Entities.Media = media[:1]
+		tweet.ExtendedEntities = &twitter.ExtendedEntity{Media: media}
+		tweet.Text = strings.TrimSpace(tweet.Text + " " + b.media[0].URL)
+	}
+
+	if quoted := b.tweet.QuotedStatus; quoted != nil {
+		tweet.QuotedStatusID, tweet.QuotedStatusIDStr = quoted.ID, quoted.IDStr
+		link := "https://twitter.com/i/web/status/" + quoted.IDStr
+		if quoted.User != nil {
+			link = fmt.Sprintf("https://twitter.com/%s/status/%s", quoted.User.ScreenName, quoted.IDStr)
+		}
+		tweet.Entities.Urls = append(tweet.Entities.Urls, twitter.URLEntity{URL: "https://t.co/quote", ExpandedURL: link})
+		tweet.Text = strings.TrimSpace(tweet.Text + " https://t.co/quote")
+	}
+
+	if original := b.tweet.RetweetedStatus; original != nil {
+		// retweets have the text and entities of the original tweet.
+		tweet.Entities = copyEntities(original.Entities)
+		if author := original.User; author != nil {
+			tweet.Text = fmt.Sprintf("RT @%s: %s", author.ScreenName, original.Text)
+			tweet.Entities.UserMentions = append([]twitter.MentionEntity{{ID: author.ID, IDStr: author.IDStr, ScreenName: author.ScreenName, Name: author.Name}}, tweet.Entities.UserMentions...)
+		} else {
+			tweet.Text = "RT : " + original.Text
+		}
+		tweet.ExtendedEntities = original.ExtendedEntities
+		tweet.PossiblySensitive = original.PossiblySensitive
+		if original.QuotedStatus != nil {
+			tweet.QuotedStatusID, tweet.QuotedStatusIDStr = original.QuotedStatusID, original.QuotedStatusIDStr
+			tweet.QuotedStatus = original.QuotedStatus
+		}
+	}
+	return tweet
+}
+
+// copyEntities copies slices of entities not to share them between tweets.
+func copyEntities(entities *twitter.Entities) *twitter.Entities {
+	if entities == nil {
+		return &twitter.Entities{}
+	}
+	e := *entities
+	e.Hashtags = append([]twitter.HashtagEntity(nil), e.Hashtags...)
+	e.Urls = append([]twitter.URLEntity(nil), e.Urls...)
+	e.UserMentions = append([]twitter.MentionEntity(nil), e.UserMentions...)
+	e.Media = append([]twitter.MediaEntity(nil), e.Media...)
+	return &e
+}
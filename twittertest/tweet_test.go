@@ -0,0 +1,110 @@
+package twittertest_test
+
+import (
+	"encoding/json"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/kawasin73/twilter"
+	"github.com/kawasin73/twilter/twittertest"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTweetBuilder(t *testing.T) {
+	created := time.Date(2019, 8, 2, 11, 2, 44, 0, time.UTC)
+	photo := twittertest.Tweet().Text("new illustration #art").Hashtag("art").Photo().Photo().CreatedAt(created).Build()
+	if photo.ID>>22 != twilter.SnowflakeID(created)>>22 || photo.IDStr == "" || photo.CreatedAt != "Fri Aug 02 11:02:44 +0000 2019" {
+		t.Errorf("id = %v, created_at = %v", photo.ID, photo.CreatedAt)
+	}
+	if photo.User.ScreenName != "alice" || photo.Text != "new illustration #art https://t.co/media" {
+		t.Errorf("user = %v, text = %q", photo.User.ScreenName, photo.Text)
+	}
+	if len(photo.Entities.Media) != 1 || len(photo.ExtendedEntities.Media) != 2 || photo.ExtendedEntities.Media[1].ExpandedURL != "https://twitter.com/alice/status/"+photo.IDStr+"/photo/2" {
+		t.Errorf("media = %+v, %+v", photo.Entities.Media, photo.ExtendedEntities)
+	}
+	// videos and animated gifs are linked as video.
+	for _, media := range []twitter.Tweet{twittertest.Tweet().Video().Build(), twittertest.Tweet().GIF().Build()} {
+		if url := media.ExtendedEntities.Media[0].ExpandedURL; url != "https://twitter.com/alice/status/"+media.IDStr+"/video/1" {
+			t.Errorf("%v : expanded_url = %v", media.ExtendedEntities.Media[0].Type, url)
+		}
+	}
+
+	rt := twittertest.Tweet().User(20, "bob").RetweetOf(photo).Build()
+	if rt.Text != "RT @alice: "+photo.Text || rt.User.ID != 20 || rt.RetweetedStatus.ID != photo.ID {
+		t.Errorf("retweet = %q by %v", rt.Text, rt.User.ScreenName)
+	}
+	if mentions := rt.Entities.UserMentions; len(mentions) != 1 || mentions[0].ScreenName != "alice" || len(photo.Entities.UserMentions) != 0 {
+		t.Errorf("mentions = %+v, original = %+v", mentions, photo.Entities.UserMentions)
+	}
+	if rt2 := twittertest.Tweet().RetweetOf(photo).Build(); rt2.ID == rt.ID {
+		t.Errorf("ids of tweets built at the same time must be unique")
+	}
+
+	quote := twittertest.Tweet().Text("look").QuoteOf(photo).Build()
+	if quote.QuotedStatusID != photo.ID || quote.Entities.Urls[0].ExpandedURL != "https://twitter.com/alice/status/"+photo.IDStr {
+		t.Errorf("quote = %+v", quote.Entities.Urls)
+	}
+}
+
+// TestTweetBuilderCorpus checks tweets built by TweetBuilder are filtered like the tweets of the golden corpus.
+func TestTweetBuilderCorpus(t *testing.T) {
+	corpus := make(map[string]twitter.Tweet)
+	paths, err := filepath.Glob(filepath.Join("..", "testdata", "corpus", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tweet twitter.Tweet
+		if err = json.Unmarshal(data, &tweet); err != nil {
+			t.Fatalf("%v : %v", path, err)
+		}
+		corpus[filepath.Base(path)] = tweet
+	}
+
+	video := twittertest.Tweet().Text("timelapse").Video().Build()
+	quote := twittertest.Tweet().Text("unreal").QuoteOf(video).Build()
+	photoOnlyEntities := twittertest.Tweet().Photo().Build()
+	photoOnlyEntities.ExtendedEntities = nil
+	built := map[string]twitter.Tweet{
+		"text.json":                    twittertest.Tweet().Text("release notes #golang").Hashtag("golang").Build(),
+		"link.json":                    twittertest.Tweet().Text("notes https://t.co/link").URL("https://devnotes.example.com/").Build(),
+		"photo.json":                   twittertest.Tweet().Text("new illustration").Photo().Build(),
+		"photos.json":                  twittertest.Tweet().Photo().Photo().Photo().Photo().Build(),
+		"video.json":                   video,
+		"gif.json":                     twittertest.Tweet().GIF().Build(),
+		"photo_entities_only.json":     photoOnlyEntities,
+		"sensitive_photo.json":         twittertest.Tweet().Photo().Sensitive().Build(),
+		"japanese.json":                twittertest.Tweet().Text("新作のイラストです").Lang("ja").Photo().Build(),
+		"reply.json":                   twittertest.Tweet().ReplyTo(video).Mention(10, "alice").Build(),
+		"quote_video.json":             quote,
+		"retweet_photo.json":           twittertest.Tweet().User(30, "bot").RetweetOf(twittertest.Tweet().Photo().Build()).Build(),
+		"retweet_sensitive_video.json": twittertest.Tweet().User(30, "bot").RetweetOf(twittertest.Tweet().Video().Sensitive().Build()).Build(),
+		"retweet_quote.json":           twittertest.Tweet().User(30, "bot").RetweetOf(quote).Build(),
+	}
+	isReply, err := twilter.NewExprFilter("is_reply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters := []twilter.Filter{twilter.PhotoFilter{}, twilter.VideoFilter{}, twilter.RTFilter{}, twilter.QTFilter{}, twilter.SensitiveFilter{}, isReply}
+
+	if len(built) != len(corpus) {
+		t.Errorf("%v tweets are built for %v tweets of corpus", len(built), len(corpus))
+	}
+	for name, expected := range corpus {
+		tweet, ok := built[name]
+		if !ok {
+			t.Errorf("%v is not built", name)
+			continue
+		}
+		for _, f := range filters {
+			if f.Match(&tweet) != f.Match(&expected) {
+				t.Errorf("%v of %v = %v, expected %v", f, name, f.Match(&tweet), f.Match(&expected))
+			}
+		}
+	}
+}
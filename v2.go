@@ -0,0 +1,504 @@
+package twilter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultV2BaseURL is the base url of Twitter API v2.
+const DefaultV2BaseURL = "https://api.twitter.com/2/"
+
+// V2Client is the client of Twitter API v2. HTTP must authorize requests (e.g. by oauth1).
+// responses of v2 are converted to twitter.Tweet of v1.1 so that filters work with both versions.
+type V2Client struct {
+	HTTP *http.Client
+	// BaseURL is DefaultV2BaseURL if empty.
+	BaseURL string
+}
+
+// NewV2Client creates V2Client of DefaultV2BaseURL.
+func NewV2Client(httpClient *http.Client) *V2Client {
+	return &V2Client{HTTP: httpClient, BaseURL: DefaultV2BaseURL}
+}
+
+// V2Error is the error of Twitter API v2 which is the problem of RFC 7807 or the partial error of the response.
+// https://developer.twitter.com/en/support/twitter-api/error-troubleshooting
+type V2Error struct {
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+	Type   string `json:"type"`
+	Status int    `json:"status"`
+	// ResourceType is the type of the resource of the partial error (e.g. user, tweet).
+	ResourceType string `json:"resource_type"`
+}
+
+// Error returns error message
+func (e *V2Error) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("twitter v2 : %v : %v", e.Title, e.Detail)
+	}
+	return fmt.Sprintf("twitter v2 : %v", e.Title)
+}
+
+// types of V2Error
+const (
+	v2ProblemNotFound      = "https://api.twitter.com/2/problems/resource-not-found"
+	v2ProblemNotAuthorized = "https://api.twitter.com/2/problems/not-authorized-for-resource"
+	v2ProblemUsageCapped   = "https://api.twitter.com/2/problems/usage-capped"
+	v2ProblemForbidden     = "https://api.twitter.com/2/problems/client-forbidden"
+	v2ProblemUnsupported   = "https://api.twitter.com/2/problems/unsupported-authentication"
+)
+
+// classByV2Error classifies V2Error by its type. Unknown if err is not V2Error.
+func classByV2Error(err error) ErrorClass {
+	if cerr, ok := err.(*ClassifiedError); ok {
+		err = cerr.Err
+	}
+	e, ok := err.(*V2Error)
+	if !ok {
+		return Unknown
+	}
+	if e.Status == http.StatusUnauthorized {
+		// v2 responds 401 only for invalid credentials.
+		return AuthInvalid
+	}
+	detail := strings.ToLower(e.Detail)
+	if e.Status == http.StatusForbidden && strings.Contains(detail, "not allowed to retweet") {
+		return RetweetNotPermitted
+	}
+	switch e.Type {
+	case v2ProblemNotFound:
+		if e.ResourceType == "tweet" {
+			return TweetDeleted
+		}
+		// suspended users are reported as not found with the detail.
+		if strings.Contains(detail, "suspended") {
+			return TargetSuspended
+		}
+		return TargetNotFound
+	case v2ProblemNotAuthorized:
+		return TargetProtected
+	case v2ProblemUsageCapped:
+		return RateLimited
+	case v2ProblemForbidden, v2ProblemUnsupported:
+		return AuthInvalid
+	}
+	return Unknown
+}
+
+// do sends the request and decodes the response body to out.
+// the error response is returned as *V2Error if it is in the format of v2.
+func (c *V2Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) (*http.Response, error) {
+	base := c.BaseURL
+	if base == "" {
+		base = DefaultV2BaseURL
+	}
+	u := strings.TrimSuffix(base, "/") + "/" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var problem V2Error
+		if err := json.NewDecoder(resp.Body).Decode(&problem); err != nil || problem.Title == "" {
+			// the body is not the problem of v2 (e.g. error page of proxy).
+			return resp, fmt.Errorf("request to %v : %v", path, resp.Status)
+		}
+		return resp, &problem
+	}
+	return resp, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// v2User is the user object of v2.
+type v2User struct {
+	ID            string `json:"id"`
+	Username      string `json:"username"`
+	Name          string `json:"name"`
+	Protected     bool   `json:"protected"`
+	Verified      bool   `json:"verified"`
+	PublicMetrics struct {
+		FollowersCount int `json:"followers_count"`
+		FollowingCount int `json:"following_count"`
+		TweetCount     int `json:"tweet_count"`
+		ListedCount    int `json:"listed_count"`
+	} `json:"public_metrics"`
+}
+
+// v2Media is the media object of v2.
+type v2Media struct {
+	MediaKey        string `json:"media_key"`
+	Type            string `json:"type"`
+	URL             string `json:"url"`
+	PreviewImageURL string `json:"preview_image_url"`
+}
+
+// v2Tweet is the tweet object of v2.
+type v2Tweet struct {
+	ID                string `json:"id"`
+	Text              string `json:"text"`
+	AuthorID          string `json:"author_id"`
+	CreatedAt         string `json:"created_at"`
+	Lang              string `json:"lang"`
+	Source            string `json:"source"`
+	PossiblySensitive bool   `json:"possibly_sensitive"`
+	InReplyToUserID   string `json:"in_reply_to_user_id"`
+	ReferencedTweets  []struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	} `json:"referenced_tweets"`
+	Attachments struct {
+		MediaKeys []string `json:"media_keys"`
+	} `json:"attachments"`
+	Entities struct {
+		Hashtags []struct {
+			Start int    `json:"start"`
+			End   int    `json:"end"`
+			Tag   string `json:"tag"`
+		} `json:"hashtags"`
+		Mentions []struct {
+			Start    int    `json:"start"`
+			End      int    `json:"end"`
+			Username string `json:"username"`
+			ID       string `json:"id"`
+		} `json:"mentions"`
+		Urls []struct {
+			Start       int    `json:"start"`
+			End         int    `json:"end"`
+			URL         string `json:"url"`
+			ExpandedURL string `json:"expanded_url"`
+			DisplayURL  string `json:"display_url"`
+		} `json:"urls"`
+	} `json:"entities"`
+	PublicMetrics struct {
+		RetweetCount int `json:"retweet_count"`
+		ReplyCount   int `json:"reply_count"`
+		LikeCount    int `json:"like_count"`
+		QuoteCount   int `json:"quote_count"`
+	} `json:"public_metrics"`
+}
+
+// v2Includes is the expanded objects of the response.
+type v2Includes struct {
+	Users  []v2User  `json:"users"`
+	Media  []v2Media `json:"media"`
+	Tweets []v2Tweet `json:"tweets"`
+}
+
+// v2TweetsResponse is the response of timeline APIs of v2.
+type v2TweetsResponse struct {
+	Data     []v2Tweet  `json:"data"`
+	Includes v2Includes `json:"includes"`
+	Errors   []V2Error  `json:"errors"`
+	Meta     struct {
+		ResultCount int    `json:"result_count"`
+		NewestID    string `json:"newest_id"`
+		OldestID    string `json:"oldest_id"`
+	} `json:"meta"`
+}
+
+// v2TweetsQuery is the query to get tweets with expansions of media, referenced tweets and authors.
+func v2TweetsQuery() url.Values {
+	query := make(url.Values)
+	query.Set("expansions", "author_id,in_reply_to_user_id,attachments.media_keys,referenced_tweets.id,referenced_tweets.id.author_id,referenced_tweets.id.attachments.media_keys")
+	query.Set("tweet.fields", "author_id,created_at,entities,lang,source,possibly_sensitive,in_reply_to_user_id,referenced_tweets,attachments,public_metrics")
+	query.Set("media.fields", "media_key,type,url,preview_image_url")
+	query.Set("user.fields", "username,name,protected,verified,public_metrics")
+	return query
+}
+
+// parseID parses id string of v2. 0 if empty or invalid.
+func parseID(id string) int64 {
+	n, _ := strconv.ParseInt(id, 10, 64)
+	return n
+}
+
+// v2Converter converts tweets of v2 to twitter.Tweet with the expanded objects.
+type v2Converter struct {
+	users  map[string]*v2User
+	media  map[string]*v2Media
+	tweets map[string]*v2Tweet
+}
+
+func newV2Converter(includes *v2Includes) *v2Converter {
+	c := &v2Converter{
+		users:  make(map[string]*v2User),
+		media:  make(map[string]*v2Media),
+		tweets: make(map[string]*v2Tweet),
+	}
+	for i := range includes.Users {
+		c.users[includes.Users[i].ID] = &includes.Users[i]
+	}
+	for i := range includes.Media {
+		c.media[includes.Media[i].MediaKey] = &includes.Media[i]
+	}
+	for i := range includes.Tweets {
+		c.tweets[includes.Tweets[i].ID] = &includes.Tweets[i]
+	}
+	return c
+}
+
+// user converts the user of v2. nil if the user is not expanded.
+func (c *v2Converter) user(id string) *twitter.User {
+	u, ok := c.users[id]
+	if !ok {
+		return nil
+	}
+	return &twitter.User{
+		ID:             parseID(u.ID),
+		IDStr:          u.ID,
+		ScreenName:     u.Username,
+		Name:           u.Name,
+		Protected:      u.Protected,
+		Verified:       u.Verified,
+		FollowersCount: u.PublicMetrics.FollowersCount,
+		FriendsCount:   u.PublicMetrics.FollowingCount,
+		StatusesCount:  u.PublicMetrics.TweetCount,
+		ListedCount:    u.PublicMetrics.ListedCount,
+	}
+}
+
+// tweet converts the tweet of v2. referenced tweets are converted recursively if expanded.
+// Retweeted is always false because v2 does not tell whether the authenticated user has retweeted the tweet.
+func (c *v2Converter) tweet(t *v2Tweet) twitter.Tweet {
+	tweet := twitter.Tweet{
+		ID:                 parseID(t.ID),
+		IDStr:              t.ID,
+		Text:               t.Text,
+		Lang:               t.Lang,
+		Source:             t.Source,
+		PossiblySensitive:  t.PossiblySensitive,
+		InReplyToUserID:    parseID(t.InReplyToUserID),
+		InReplyToUserIDStr: t.InReplyToUserID,
+		RetweetCount:       t.PublicMetrics.RetweetCount,
+		ReplyCount:         t.PublicMetrics.ReplyCount,
+		FavoriteCount:      t.PublicMetrics.LikeCount,
+		QuoteCount:         t.PublicMetrics.QuoteCount,
+		User:               c.user(t.AuthorID),
+		Entities:           &twitter.Entities{},
+	}
+	if createdAt, err := time.Parse(time.RFC3339, t.CreatedAt); err == nil {
+		// v1.1 format which twitter.Tweet.CreatedAtTime parses
+		tweet.CreatedAt = createdAt.UTC().Format(time.RubyDate)
+	}
+
+	for _, h := range t.Entities.Hashtags {
+		tweet.Entities.Hashtags = append(tweet.Entities.Hashtags, twitter.HashtagEntity{Indices: twitter.Indices{h.Start, h.End}, Text: h.Tag})
+	}
+	for _, m := range t.Entities.Mentions {
+		tweet.Entities.UserMentions = append(tweet.Entities.UserMentions, twitter.MentionEntity{Indices: twitter.Indices{m.Start, m.End}, ID: parseID(m.ID), IDStr: m.ID, ScreenName: m.Username})
+	}
+	var mediaURL twitter.URLEntity
+	for _, u := range t.Entities.Urls {
+		entity := twitter.URLEntity{Indices: twitter.Indices{u.Start, u.End}, URL: u.URL, ExpandedURL: u.ExpandedURL, DisplayURL: u.DisplayURL}
+		if len(t.Attachments.MediaKeys) > 0 && isMediaURL(u.ExpandedURL) {
+			// v1.1 has the url of media only in media entities.
+			mediaURL = entity
+			continue
+		}
+		tweet.Entities.Urls = append(tweet.Entities.Urls, entity)
+	}
+	for _, key := range t.Attachments.MediaKeys {
+		m, ok := c.media[key]
+		if !ok {
+			continue
+		}
+		media := twitter.MediaEntity{URLEntity: mediaURL, IDStr: m.MediaKey, Type: m.Type, MediaURLHttps: m.URL}
+		if media.MediaURLHttps == "" {
+			// videos and animated gifs have only the preview image.
+			media.MediaURLHttps = m.PreviewImageURL
+		}
+		if tweet.ExtendedEntities == nil {
+			tweet.ExtendedEntities = &twitter.ExtendedEntity{}
+			// v1.1 has only the first media in entities.
+			tweet.Entities.Media = []twitter.MediaEntity{media}
+		}
+		tweet.ExtendedEntities.Media = append(tweet.ExtendedEntities.Media, media)
+	}
+
+	for _, ref := range t.ReferencedTweets {
+		var referenced *twitter.Tweet
+		if r, ok := c.tweets[ref.ID]; ok {
+			converted := c.tweet(r)
+			referenced = &converted
+		}
+		switch ref.Type {
+		case "retweeted":
+			if referenced == nil {
+				// keep it as retweet even if the original tweet is not expanded (e.g. deleted).
+				referenced = &twitter.Tweet{ID: parseID(ref.ID), IDStr: ref.ID}
+			}
+			tweet.RetweetedStatus = referenced
+		case "quoted":
+			tweet.QuotedStatusID, tweet.QuotedStatusIDStr = parseID(ref.ID), ref.ID
+			tweet.QuotedStatus = referenced
+		case "replied_to":
+			tweet.InReplyToStatusID, tweet.InReplyToStatusIDStr = parseID(ref.ID), ref.ID
+			if u := c.users[t.InReplyToUserID]; u != nil {
+				tweet.InReplyToScreenName = u.Username
+			}
+		}
+	}
+	return tweet
+}
+
+// isMediaURL checks the url is the link to the media of a tweet (e.g. https://twitter.com/user/status/1/photo/1).
+func isMediaURL(expanded string) bool {
+	return strings.Contains(expanded, "/status/") && (strings.Contains(expanded, "/photo/") || strings.Contains(expanded, "/video/"))
+}
+
+// fetchTweets gets tweets of the timeline API of v2 and converts them.
+func (c *V2Client) fetchTweets(ctx context.Context, path string, query url.Values) ([]twitter.Tweet, *http.Response, error) {
+	var result v2TweetsResponse
+	resp, err := c.do(ctx, http.MethodGet, path, query, nil, &result)
+	if err != nil {
+		return nil, resp, err
+	}
+	if len(result.Data) == 0 && len(result.Errors) > 0 {
+		// the target itself is not available (e.g. not found, suspended or protected).
+		return nil, resp, &result.Errors[0]
+	}
+
+	converter := newV2Converter(&result.Includes)
+	tweets := make([]twitter.Tweet, len(result.Data))
+	for i := range result.Data {
+		tweets[i] = converter.tweet(&result.Data[i])
+	}
+	return tweets, resp, nil
+}
+
+// V2UserTweetsSource is tweets of a user by Twitter API v2.
+// the tweets are same as UserTimelineSource, so the checkpoint is compatible.
+// the client of Fetch is ignored and Client is used instead.
+// https://developer.twitter.com/en/docs/twitter-api/tweets/timelines/api-reference/get-users-id-tweets
+type V2UserTweetsSource struct {
+	Client *V2Client
+	UserID int64
+}
+
+// Fetch fetches a page of user timeline.
+func (s *V2UserTweetsSource) Fetch(ctx context.Context, _ *twitter.Client, params *PageParams) ([]twitter.Tweet, *http.Response, error) {
+	query := v2TweetsQuery()
+	// max_results must be between 5 and 100.
+	count := limitCount(params, 100)
+	if count < 5 {
+		query.Set("max_results", "5")
+	} else {
+		query.Set("max_results", strconv.Itoa(count))
+	}
+	if params.SinceID > 0 {
+		query.Set("since_id", strconv.FormatInt(params.SinceID, 10))
+	}
+	if params.MaxID > 0 {
+		// until_id is exclusive while max_id is inclusive.
+		query.Set("until_id", strconv.FormatInt(params.MaxID+1, 10))
+	}
+	var exclude []string
+	if !*boolParam(params.IncludeRetweets, &trueValue) {
+		exclude = append(exclude, "retweets")
+	}
+	if *boolParam(params.ExcludeReplies, &falseValue) {
+		exclude = append(exclude, "replies")
+	}
+	if len(exclude) > 0 {
+		query.Set("exclude", strings.Join(exclude, ","))
+	}
+
+	tweets, resp, err := s.Client.fetchTweets(ctx, "users/"+strconv.FormatInt(s.UserID, 10)+"/tweets", query)
+	if err == nil && len(tweets) > count {
+		// the page must not be larger than requested.
+		tweets = tweets[:count]
+	}
+	return tweets, resp, err
+}
+
+// String returns user
+func (s *V2UserTweetsSource) String() string {
+	return fmt.Sprintf("user(%d)", s.UserID)
+}
+
+// v2RetweetRequest is the body of the retweets API.
+type v2RetweetRequest struct {
+	TweetID string `json:"tweet_id"`
+}
+
+// v2RetweetResponse is the response of the retweets API.
+type v2RetweetResponse struct {
+	Data *struct {
+		Retweeted bool `json:"retweeted"`
+	} `json:"data"`
+	Errors []V2Error `json:"errors"`
+}
+
+// v2Retweeter retweets by the retweets API of v2.
+type v2Retweeter struct {
+	client *V2Client
+	userID int64
+}
+
+// NewV2Retweeter creates Retweeter of Twitter API v2. userID is the authenticated user.
+// tweets of v2 are never marked Retweeted, so tweets already retweeted are not unretweeted and retweeted again
+// to the top of the timeline unlike v1.1. Retweet of them succeeds without moving them.
+// https://developer.twitter.com/en/docs/twitter-api/tweets/retweets/api-reference/post-users-id-retweets
+func NewV2Retweeter(client *V2Client, userID int64) Retweeter {
+	return &v2Retweeter{client: client, userID: userID}
+}
+
+// Retweet retweets the tweet. retweeting the tweet already retweeted succeeds.
+func (r *v2Retweeter) Retweet(ctx context.Context, tweetID int64) error {
+	body := &v2RetweetRequest{TweetID: strconv.FormatInt(tweetID, 10)}
+	return r.request(ctx, http.MethodPost, "users/"+strconv.FormatInt(r.userID, 10)+"/retweets", body)
+}
+
+// Unretweet unretweets the tweet.
+func (r *v2Retweeter) Unretweet(ctx context.Context, tweetID int64) error {
+	return r.request(ctx, http.MethodDelete, "users/"+strconv.FormatInt(r.userID, 10)+"/retweets/"+strconv.FormatInt(tweetID, 10), nil)
+}
+
+// request sends the request of the retweets API. the error is *ClassifiedError except errors of ctx.
+func (r *v2Retweeter) request(ctx context.Context, method, path string, body interface{}) error {
+	var resp *http.Response
+	err := DefaultRetryPolicy.Do(ctx, func() (_ *http.Response, err error) {
+		var result v2RetweetResponse
+		resp, err = r.client.do(ctx, method, path, nil, body, &result)
+		if err == nil && result.Data == nil && len(result.Errors) > 0 {
+			// the tweet is not found or not permitted to retweet.
+			err = &result.Errors[0]
+		}
+		return resp, err
+	})
+	if err != nil && err == ctx.Err() {
+		return err
+	}
+	return classifyError(resp, err)
+}
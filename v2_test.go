@@ -0,0 +1,245 @@
+package twilter
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dghubble/go-twitter/twitter"
+	"github.com/kawasin73/twilter/twittertest"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeV2Handler serves recorded responses of v2 from testdata.
+type fakeV2Handler struct {
+	t *testing.T
+}
+
+func (h fakeV2Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.URL.Path {
+	case "/2/users/10/tweets":
+		h.serveFile(w, "v2_users_tweets.json")
+	case "/2/users/98/tweets":
+		w.Write([]byte(`{"errors":[{"value":"98","detail":"User has been suspended: [98].","title":"Forbidden","resource_type":"user","parameter":"id","resource_id":"98","type":"https://api.twitter.com/2/problems/resource-not-found"}]}`))
+	case "/2/users/99/tweets":
+		w.Write([]byte(`{"errors":[{"value":"99","detail":"Could not find user with id: [99].","title":"Not Found Error","resource_type":"user","parameter":"id","resource_id":"99","type":"https://api.twitter.com/2/problems/resource-not-found"}]}`))
+	case "/2/users/97/tweets":
+		w.Header().Set("X-Rate-Limit-Remaining", "0")
+		w.Header().Set("X-Rate-Limit-Reset", "1550318400")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"title":"Too Many Requests","detail":"Too Many Requests","type":"about:blank","status":429}`))
+	case "/2/users/96/tweets":
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"title":"Unauthorized","type":"about:blank","status":401,"detail":"Unauthorized"}`))
+	case "/2/users/1/retweets":
+		w.Write([]byte(`{"data":{"retweeted":true}}`))
+	case "/2/users/1/retweets/1096765100000000005":
+		w.Write([]byte(`{"data":{"retweeted":false}}`))
+	case "/2/users/1/retweets/1096765100000000006":
+		w.Write([]byte(`{"errors":[{"detail":"Could not find tweet with tweet_id: [1096765100000000006].","title":"Not Found Error","resource_type":"tweet","parameter":"tweet_id","type":"https://api.twitter.com/2/problems/resource-not-found"}]}`))
+	case "/2/users/1/retweets/1096765100000000007":
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"title":"Forbidden","type":"about:blank","status":403,"detail":"You are not allowed to retweet this Tweet."}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (h fakeV2Handler) serveFile(w http.ResponseWriter, name string) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	w.Write(data)
+}
+
+// newFakeTwitterServer starts twittertest.Server which has the tweets of v1_user_timeline.json and serves v2 by fakeV2Handler.
+func newFakeTwitterServer(t *testing.T) (*twittertest.Server, *http.Client) {
+	server := twittertest.NewServer()
+	server.SetSelf(twitter.User{ID: 1, ScreenName: "dummy"})
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "v1_user_timeline.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tweets []twitter.Tweet
+	if err = json.Unmarshal(data, &tweets); err != nil {
+		t.Fatal(err)
+	}
+	server.AddTweets(tweets...)
+	server.Handle("/2/", fakeV2Handler{t: t})
+	return server, server.Client()
+}
+
+// v1OnlyFields are fields which v2 does not provide. source of v1.1 is html.
+var v1OnlyFields = map[string]bool{
+	"source":                true,
+	"favorited":             true,
+	"retweeted":             true,
+	"truncated":             true,
+	"quote_count":           true,
+	"reply_count":           true,
+	"user.lang":             true,
+	"user.favourites_count": true,
+}
+
+// fieldValue evaluates the field of expression on the tweet.
+func fieldValue(node *exprNode, tweet *twitter.Tweet) interface{} {
+	switch node.typ {
+	case typeInt:
+		return node.i(tweet)
+	case typeBool:
+		return node.b(tweet)
+	case typeString:
+		return node.s(tweet)
+	default:
+		return node.l(tweet)
+	}
+}
+
+func TestV2Conformance(t *testing.T) {
+	server, httpClient := newFakeTwitterServer(t)
+	defer server.Close()
+	ctx := context.Background()
+	// users are not trimmed to compare them with users of v2.
+	params := &PageParams{Count: 200, TrimUser: &falseValue}
+
+	v1, _, err := (&UserTimelineSource{UserID: 10}).Fetch(ctx, twitter.NewClient(httpClient), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, _, err := (&V2UserTweetsSource{Client: NewV2Client(httpClient), UserID: 10}).Fetch(ctx, nil, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v1) != 5 || len(v1) != len(v2) {
+		t.Fatalf("len(v1) = %v, len(v2) = %v", len(v1), len(v2))
+	}
+
+	var names []string
+	for name := range exprFields {
+		if !v1OnlyFields[name] {
+			names = append(names, name, "retweeted_status."+name, "quoted_status."+name)
+		}
+	}
+	sort.Strings(names)
+	filters := []Filter{PhotoFilter{}, VideoFilter{}, RTFilter{}, QTFilter{}}
+
+	for i := range v1 {
+		if v1[i].ID != v2[i].ID {
+			t.Errorf("tweet %v : id v1 = %v, v2 = %v", i, v1[i].ID, v2[i].ID)
+			continue
+		}
+		if v2[i].Retweeted {
+			t.Errorf("tweet (%d) : v2 is marked retweeted", v2[i].ID)
+		}
+		for _, name := range names {
+			node := lookupField(name)
+			if a, b := fieldValue(node, &v1[i]), fieldValue(node, &v2[i]); !reflect.DeepEqual(a, b) {
+				t.Errorf("tweet (%d) : %v : v1 = %#v, v2 = %#v", v1[i].ID, name, a, b)
+			}
+		}
+		for _, f := range filters {
+			if a, b := f.Match(&v1[i]), f.Match(&v2[i]); a != b {
+				t.Errorf("tweet (%d) : %v : v1 = %v, v2 = %v", v1[i].ID, f, a, b)
+			}
+		}
+		t1, err1 := v1[i].CreatedAtTime()
+		t2, err2 := v2[i].CreatedAtTime()
+		if err1 != nil || err2 != nil || !t1.Equal(t2) {
+			t.Errorf("tweet (%d) : created_at v1 = %v, v2 = %v", v1[i].ID, v1[i].CreatedAt, v2[i].CreatedAt)
+		}
+	}
+}
+
+func TestV2UserTweetsSourceParams(t *testing.T) {
+	server, httpClient := newFakeTwitterServer(t)
+	defer server.Close()
+	source := &V2UserTweetsSource{Client: NewV2Client(httpClient), UserID: 10}
+
+	tweets, _, err := source.Fetch(context.Background(), nil, &PageParams{MaxID: 1096765100000000004, SinceID: 100, Count: 2, IncludeRetweets: &falseValue, ExcludeReplies: &trueValue})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := server.Requests()[0].Query
+	for key, value := range map[string]string{
+		"until_id":    "1096765100000000005",
+		"since_id":    "100",
+		"max_results": "5",
+		"exclude":     "retweets,replies",
+	} {
+		if query.Get(key) != value {
+			t.Errorf("%v = %q", key, query.Get(key))
+		}
+	}
+	if expansions := query.Get("expansions"); !strings.Contains(expansions, "attachments.media_keys") || !strings.Contains(expansions, "referenced_tweets.id") || !strings.Contains(expansions, "author_id") {
+		t.Errorf("expansions = %q", expansions)
+	}
+	if len(tweets) != 2 {
+		// the page is trimmed to Count.
+		t.Errorf("len(tweets) = %v", len(tweets))
+	}
+}
+
+func TestV2Errors(t *testing.T) {
+	server, httpClient := newFakeTwitterServer(t)
+	defer server.Close()
+	client := NewV2Client(httpClient)
+
+	for _, test := range []struct {
+		userID int64
+		class  ErrorClass
+	}{
+		{96, AuthInvalid},
+		{97, RateLimited},
+		{98, TargetSuspended},
+		{99, TargetNotFound},
+	} {
+		source := &V2UserTweetsSource{Client: client, UserID: test.userID}
+		_, resp, err := source.Fetch(context.Background(), nil, &PageParams{Count: 200})
+		if cerr := Classify(resp, err); cerr == nil || cerr.Class != test.class {
+			t.Errorf("user %v : Classify() = %+v", test.userID, cerr)
+		}
+	}
+}
+
+func TestV2Retweeter(t *testing.T) {
+	server, httpClient := newFakeTwitterServer(t)
+	defer server.Close()
+	r := NewV2Retweeter(NewV2Client(httpClient), 1)
+	ctx := context.Background()
+
+	if err := r.Retweet(ctx, 1096765100000000005); err != nil {
+		t.Errorf("Retweet() = %v", err)
+	}
+	var body v2RetweetRequest
+	requests := server.Requests()
+	if err := json.Unmarshal([]byte(requests[0].Body), &body); err != nil || body.TweetID != "1096765100000000005" || requests[0].Method+" "+requests[0].Path != "POST /2/users/1/retweets" {
+		t.Errorf("request = %+v", requests[0])
+	}
+	err := r.Unretweet(ctx, 1096765100000000005)
+	if requests = server.Requests(); err != nil || requests[1].Method+" "+requests[1].Path != "DELETE /2/users/1/retweets/1096765100000000005" {
+		t.Errorf("Unretweet() = %v, request = %+v", err, requests[1])
+	}
+	// retweets API of v2 returns retweeted whether the tweet is already retweeted or not.
+	if err := r.Retweet(ctx, 1096765100000000005); err != nil || len(server.Requests()) != 3 {
+		t.Errorf("Retweet() again = %v, requests = %+v", err, server.Requests())
+	}
+	for _, test := range []struct {
+		tweetID int64
+		class   ErrorClass
+	}{
+		{1096765100000000006, TweetDeleted},
+		{1096765100000000007, RetweetNotPermitted},
+	} {
+		err := r.Unretweet(ctx, test.tweetID)
+		if cerr, ok := err.(*ClassifiedError); !ok || cerr.Class != test.class {
+			t.Errorf("Unretweet(%v) = %v", test.tweetID, err)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package twilter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/dghubble/go-twitter/twitter"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WordList is a list of terms loaded from a file. it can be reloaded while filtering.
+//
+// the file has one term per line. a line written as "/<regex>/" is a regular expression.
+// empty lines are ignored. terms are matched as substrings ignoring case.
+// terms are matched by Aho-Corasick automaton, so thousands of terms are fast.
+type WordList struct {
+	path string
+
+	mu      sync.RWMutex
+	matcher *wordMatcher
+	modTime time.Time
+	size    int64
+}
+
+// wordMatcher matches terms and regular expressions.
+type wordMatcher struct {
+	terms   *ahoCorasick
+	pattern *regexp.Regexp // nil when no regular expression
+	count   int
+}
+
+// LoadWordList loads the file and returns WordList.
+func LoadWordList(path string) (*WordList, error) {
+	l := &WordList{path: path}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Path returns the path of the file.
+func (l *WordList) Path() string {
+	return l.path
+}
+
+// Len returns the number of terms and regular expressions.
+func (l *WordList) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.matcher.count
+}
+
+// Reload loads the file again. the old list is kept if failed.
+// modified time and size are recorded even if failed, so ReloadIfModified does not retry the broken file until it is modified again.
+func (l *WordList) Reload() error {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	matcher, err := l.load(file)
+	l.mu.Lock()
+	if err == nil {
+		l.matcher = matcher
+	}
+	l.modTime = info.ModTime()
+	l.size = info.Size()
+	l.mu.Unlock()
+	return err
+}
+
+// load reads terms and regular expressions from the file.
+func (l *WordList) load(file *os.File) (*wordMatcher, error) {
+	var (
+		terms    []string
+		patterns []string
+	)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		term := strings.TrimSpace(scanner.Text())
+		if term == "" {
+			continue
+		}
+		if len(term) > 2 && term[0] == '/' && term[len(term)-1] == '/' {
+			pattern := term[1 : len(term)-1]
+			if _, err := regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("%v:%d : %v", l.path, line, err)
+			}
+			patterns = append(patterns, "(?:"+pattern+")")
+		} else {
+			terms = append(terms, strings.ToLower(term))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	matcher := &wordMatcher{terms: newAhoCorasick(terms), count: len(terms) + len(patterns)}
+	if len(patterns) > 0 {
+		var err error
+		if matcher.pattern, err = regexp.Compile("(?i)" + strings.Join(patterns, "|")); err != nil {
+			return nil, fmt.Errorf("%v : %v", l.path, err)
+		}
+	}
+	return matcher, nil
+}
+
+// ReloadIfModified reloads the file if modified time or size of the file is changed.
+func (l *WordList) ReloadIfModified() (bool, error) {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return false, err
+	}
+	l.mu.RLock()
+	modified := !info.ModTime().Equal(l.modTime) || info.Size() != l.size
+	l.mu.RUnlock()
+	if !modified {
+		return false, nil
+	}
+	return true, l.Reload()
+}
+
+// Watch checks the file every interval and reloads it if modified until ctx is done.
+func (l *WordList) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if reloaded, err := l.ReloadIfModified(); err != nil {
+				log.Printf("failed to reload %v : %v\n", l.path, err)
+			} else if reloaded {
+				log.Printf("reloaded %v (%d terms)\n", l.path, l.Len())
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Contains checks text contains any term.
+func (l *WordList) Contains(text string) bool {
+	l.mu.RLock()
+	matcher := l.matcher
+	l.mu.RUnlock()
+	if matcher.terms.match(strings.ToLower(text)) {
+		return true
+	}
+	return matcher.pattern != nil && matcher.pattern.MatchString(text)
+}
+
+// ahoCorasick is Aho-Corasick automaton which checks text contains any of terms.
+type ahoCorasick struct {
+	nodes []acNode
+}
+
+type acNode struct {
+	next map[byte]int
+	fail int
+	// out is true if any term ends at this node or its fail nodes.
+	out bool
+}
+
+func newAhoCorasick(terms []string) *ahoCorasick {
+	ac := &ahoCorasick{nodes: []acNode{{next: make(map[byte]int)}}}
+
+	// build trie
+	for _, term := range terms {
+		cur := 0
+		for i := 0; i < len(term); i++ {
+			next, ok := ac.nodes[cur].next[term[i]]
+			if !ok {
+				next = len(ac.nodes)
+				ac.nodes = append(ac.nodes, acNode{next: make(map[byte]int)})
+				ac.nodes[cur].next[term[i]] = next
+			}
+			cur = next
+		}
+		ac.nodes[cur].out = true
+	}
+
+	// build fail links by breadth first search
+	queue := make([]int, 0, len(ac.nodes))
+	for _, child := range ac.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for c, child := range ac.nodes[cur].next {
+			fail := ac.nodes[cur].fail
+			for {
+				if next, ok := ac.nodes[fail].next[c]; ok {
+					ac.nodes[child].fail = next
+					break
+				} else if fail == 0 {
+					ac.nodes[child].fail = 0
+					break
+				}
+				fail = ac.nodes[fail].fail
+			}
+			ac.nodes[child].out = ac.nodes[child].out || ac.nodes[ac.nodes[child].fail].out
+			queue = append(queue, child)
+		}
+	}
+	return ac
+}
+
+// match checks text contains any term.
+func (ac *ahoCorasick) match(text string) bool {
+	cur := 0
+	for i := 0; i < len(text); i++ {
+		for {
+			if next, ok := ac.nodes[cur].next[text[i]]; ok {
+				cur = next
+				break
+			} else if cur == 0 {
+				break
+			}
+			cur = ac.nodes[cur].fail
+		}
+		if ac.nodes[cur].out {
+			return true
+		}
+	}
+	return false
+}
+
+// WordListFilter filters tweets which contain any term of WordList.
+type WordListFilter struct {
+	List *WordList
+}
+
+// Match ...
+func (f WordListFilter) Match(tweet *twitter.Tweet) bool {
+	return f.List.Contains(originalText(tweet))
+}
+
+// String returns wordlist
+func (f WordListFilter) String() string {
+	return fmt.Sprintf("wordlist(%v)", f.List.Path())
+}
+
+// BlockListFilter filters tweets which contain no term of WordList.
+type BlockListFilter struct {
+	List *WordList
+}
+
+// Match ...
+func (f BlockListFilter) Match(tweet *twitter.Tweet) bool {
+	return !f.List.Contains(originalText(tweet))
+}
+
+// String returns blocklist
+func (f BlockListFilter) String() string {
+	return fmt.Sprintf("blocklist(%v)", f.List.Path())
+}
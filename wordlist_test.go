@@ -0,0 +1,93 @@
+package twilter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAhoCorasick(t *testing.T) {
+	ac := newAhoCorasick([]string{"he", "she", "his", "hers", "ネタバレ"})
+	for _, test := range []struct {
+		text    string
+		matched bool
+	}{
+		{"ushers", true},
+		{"ahishers", true},
+		{"hxs", false},
+		{"今週のネタバレ注意", true},
+		{"ネタ", false},
+		{"", false},
+	} {
+		if matched := ac.match(test.text); matched != test.matched {
+			t.Errorf("match(%q) = %v, expected %v", test.text, matched, test.matched)
+		}
+	}
+}
+
+func TestWordList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wordlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "words.txt")
+
+	if err = ioutil.WriteFile(path, []byte("Spoiler\n\n/ep(isode)? ?[0-9]+/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	list, err := LoadWordList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		text    string
+		matched bool
+	}{
+		{"SPOILER alert", true},
+		{"watched Episode 12", true},
+		{"nothing here", false},
+	} {
+		if matched := list.Contains(test.text); matched != test.matched {
+			t.Errorf("Contains(%q) = %v, expected %v", test.text, matched, test.matched)
+		}
+	}
+
+	// reload modified file
+	if err = ioutil.WriteFile(path, []byte("nothing\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := list.ReloadIfModified(); err != nil || !reloaded {
+		t.Fatalf("ReloadIfModified() = (%v, %v)", reloaded, err)
+	}
+	if !list.Contains("nothing here") || list.Contains("spoiler") {
+		t.Errorf("list is not reloaded")
+	}
+
+	// invalid file keeps old list
+	if err = ioutil.WriteFile(path, []byte("/(/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = list.Reload(); err == nil {
+		t.Errorf("invalid regex must fail")
+	}
+	if !list.Contains("nothing here") {
+		t.Errorf("old list must be kept")
+	}
+
+	// invalid file is not reloaded again until modified
+	if err = os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := list.ReloadIfModified(); err == nil || !reloaded {
+		t.Errorf("ReloadIfModified() = (%v, %v)", reloaded, err)
+	}
+	if reloaded, err := list.ReloadIfModified(); err != nil || reloaded {
+		t.Errorf("ReloadIfModified() of failed file = (%v, %v)", reloaded, err)
+	}
+}